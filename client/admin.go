@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	pb "github.com/FelipeMarchantVargas/sync-service/proto"
+	"github.com/urfave/cli"
+	"google.golang.org/grpc"
+)
+
+// ------------------------- ADMINISTRACIÓN --------------------------------
+
+// Conectarse al servidor y ejecutar fn con el cliente del servicio de administración
+func withAdminClient(fn func(client pb.AdminServiceClient, ctx context.Context) error) error {
+	conn, err := grpc.Dial("localhost:50051", grpc.WithInsecure())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	authClient := pb.NewAuthServiceClient(conn)
+	ctx, err := getAuthContext(authClient)
+	if err != nil {
+		return err
+	}
+	return fn(pb.NewAdminServiceClient(conn), ctx)
+}
+
+// Cambiar el rol de una cuenta
+func setUserRole(client pb.AdminServiceClient, username, role string, ctx context.Context) error {
+	if _, err := client.SetRole(ctx, &pb.RoleRequest{Username: username, Role: role}); err != nil {
+		log.Printf("[ERROR] No se pudo cambiar el rol de %s: %v", username, err)
+		return err
+	}
+	log.Printf("[SUCCESS] (%s) Rol de %s cambiado a %s", time.Now().Format("15:04:05"), username, role)
+	fmt.Printf("Rol de %s cambiado a %s\n", username, role)
+	return nil
+}
+
+// Mostrar las cuentas del servidor
+func listUsers(client pb.AdminServiceClient, ctx context.Context) error {
+	resp, err := client.ListUsers(ctx, &pb.Empty{})
+	if err != nil {
+		log.Printf("[ERROR] No se pudo listar las cuentas: %v", err)
+		return err
+	}
+	for _, user := range resp.Users {
+		state := "habilitada"
+		if user.Disabled {
+			state = "deshabilitada"
+		}
+		fmt.Printf("%s\t%s\t%s\t%d archivos\t%d bytes\t%d conexiones\n", user.Username, user.Role, state, user.Files, user.Bytes, user.Connections)
+	}
+	return nil
+}
+
+// Ejecutar una operación sobre una cuenta e informar el resultado
+func adminUserAction(name, usage, done string, call func(pb.AdminServiceClient, context.Context, *pb.UserRequest, ...grpc.CallOption) (*pb.Empty, error)) cli.Command {
+	return cli.Command{
+		Name:      name,
+		Usage:     usage,
+		ArgsUsage: "<usuario>",
+		Action: func(c *cli.Context) error {
+			if c.NArg() < 1 {
+				return fmt.Errorf("debes proporcionar el usuario")
+			}
+			username := c.Args().Get(0)
+			return withAdminClient(func(client pb.AdminServiceClient, ctx context.Context) error {
+				if _, err := call(client, ctx, &pb.UserRequest{Username: username}); err != nil {
+					log.Printf("[ERROR] No se pudo completar la operación sobre %s: %v", username, err)
+					return err
+				}
+				log.Printf("[SUCCESS] (%s) %s: %s", time.Now().Format("15:04:05"), username, done)
+				fmt.Printf("%s: %s\n", username, done)
+				return nil
+			})
+		},
+	}
+}
+
+// Mostrar los streams SyncUpdates conectados
+func listSubscribers(client pb.AdminServiceClient, ctx context.Context) error {
+	resp, err := client.ListSubscribers(ctx, &pb.Empty{})
+	if err != nil {
+		log.Printf("[ERROR] No se pudo listar las conexiones: %v", err)
+		return err
+	}
+	for _, sub := range resp.Subscribers {
+		fmt.Printf("%s\t%s\t%s\tdesde %s", sub.Username, sub.Peer, sub.Device, time.Unix(sub.ConnectedAt, 0).Format("2006-01-02 15:04:05"))
+		if len(sub.Include) > 0 {
+			fmt.Printf("\tincluye %s", strings.Join(sub.Include, ","))
+		}
+		if len(sub.Exclude) > 0 {
+			fmt.Printf("\texcluye %s", strings.Join(sub.Exclude, ","))
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+// Rotar la clave de un usuario o grupo
+func rotateKey(client pb.AdminServiceClient, holder string, ctx context.Context) error {
+	resp, err := client.RotateKey(ctx, &pb.UserRequest{Username: holder})
+	if err != nil {
+		log.Printf("[ERROR] No se pudo rotar la clave de %s: %v", holder, err)
+		return err
+	}
+	log.Printf("[SUCCESS] (%s) Clave de %s rotada (%d archivos)", time.Now().Format("15:04:05"), holder, resp.Files)
+	fmt.Printf("Clave de %s rotada (%d archivos actualizados)\n", holder, resp.Files)
+	return nil
+}
+
+// Revisar la integridad de los archivos guardados
+func checkIntegrity(client pb.AdminServiceClient, owner string, ctx context.Context) error {
+	resp, err := client.CheckIntegrity(ctx, &pb.UserRequest{Username: owner})
+	if err != nil {
+		log.Printf("[ERROR] No se pudo revisar los archivos: %v", err)
+		return err
+	}
+	for _, problem := range resp.Problems {
+		fmt.Printf("%s/%s\t%s\n", problem.Owner, problem.Path, problem.Problem)
+	}
+	fmt.Printf("%d archivos revisados, %d problemas\n", resp.Checked, len(resp.Problems))
+	if len(resp.Problems) > 0 {
+		return fmt.Errorf("se encontraron %d problemas", len(resp.Problems))
+	}
+	return nil
+}
+
+// Subcomandos de "admin"
+var adminCommands = []cli.Command{
+	{
+		Name:      "set-role",
+		Usage:     "Cambiar el rol de una cuenta (admin, user, read-only o service)",
+		ArgsUsage: "<usuario> <rol>",
+		Action: func(c *cli.Context) error {
+			if c.NArg() < 2 {
+				return fmt.Errorf("debes proporcionar el usuario y el rol")
+			}
+			return withAdminClient(func(client pb.AdminServiceClient, ctx context.Context) error {
+				return setUserRole(client, c.Args().Get(0), c.Args().Get(1), ctx)
+			})
+		},
+	},
+	{
+		Name:  "users",
+		Usage: "Listar las cuentas con su rol, estado, archivos y conexiones",
+		Action: func(c *cli.Context) error {
+			return withAdminClient(func(client pb.AdminServiceClient, ctx context.Context) error {
+				return listUsers(client, ctx)
+			})
+		},
+	},
+	adminUserAction("disable", "Deshabilitar una cuenta y cerrar sus sesiones", "cuenta deshabilitada", pb.AdminServiceClient.DisableUser),
+	adminUserAction("enable", "Volver a habilitar una cuenta", "cuenta habilitada", pb.AdminServiceClient.EnableUser),
+	adminUserAction("logout", "Cerrar todas las sesiones de una cuenta", "sesiones cerradas", pb.AdminServiceClient.ForceLogout),
+	{
+		Name:      "reset-password",
+		Usage:     "Cambiar la contraseña de una cuenta y cerrar sus sesiones",
+		ArgsUsage: "<usuario>",
+		Flags: []cli.Flag{
+			cli.StringFlag{Name: "password", Usage: "Contraseña nueva (si no se indica, se pide por la terminal)"},
+		},
+		Action: func(c *cli.Context) error {
+			if c.NArg() < 1 {
+				return fmt.Errorf("debes proporcionar el usuario")
+			}
+			username := c.Args().Get(0)
+			password := c.String("password")
+			if password == "" {
+				var err error
+				if password, err = promptPassword("Contraseña nueva: "); err != nil {
+					return err
+				}
+			}
+			return withAdminClient(func(client pb.AdminServiceClient, ctx context.Context) error {
+				if _, err := client.ResetPassword(ctx, &pb.PasswordRequest{Username: username, Password: password}); err != nil {
+					log.Printf("[ERROR] No se pudo cambiar la contraseña de %s: %v", username, err)
+					return err
+				}
+				log.Printf("[SUCCESS] (%s) Contraseña de %s cambiada", time.Now().Format("15:04:05"), username)
+				fmt.Printf("Contraseña de %s cambiada\n", username)
+				return nil
+			})
+		},
+	},
+	{
+		Name:  "subscribers",
+		Usage: "Listar los clientes conectados recibiendo cambios",
+		Action: func(c *cli.Context) error {
+			return withAdminClient(func(client pb.AdminServiceClient, ctx context.Context) error {
+				return listSubscribers(client, ctx)
+			})
+		},
+	},
+	{
+		Name:      "rotate-key",
+		Usage:     "Rotar la clave de cifrado de un usuario o de un grupo (team:<grupo>)",
+		ArgsUsage: "<usuario|team:grupo>",
+		Action: func(c *cli.Context) error {
+			if c.NArg() < 1 {
+				return fmt.Errorf("debes proporcionar el usuario o el grupo")
+			}
+			return withAdminClient(func(client pb.AdminServiceClient, ctx context.Context) error {
+				return rotateKey(client, c.Args().Get(0), ctx)
+			})
+		},
+	},
+	{
+		Name:      "check",
+		Usage:     "Revisar la integridad de los archivos guardados (de un usuario o grupo, o de todos)",
+		ArgsUsage: "[usuario|team:grupo]",
+		Action: func(c *cli.Context) error {
+			return withAdminClient(func(client pb.AdminServiceClient, ctx context.Context) error {
+				return checkIntegrity(client, c.Args().Get(0), ctx)
+			})
+		},
+	},
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	pb "github.com/FelipeMarchantVargas/sync-service/proto"
+	"github.com/urfave/cli"
+	"google.golang.org/grpc"
+)
+
+// ------------------------- API KEYS --------------------------------
+
+// Conectarse al servidor y ejecutar fn con el cliente de autenticación
+func withAuthClient(fn func(client pb.AuthServiceClient, ctx context.Context) error) error {
+	conn, err := grpc.Dial("localhost:50051", grpc.WithInsecure())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	authClient := pb.NewAuthServiceClient(conn)
+	ctx, err := getAuthContext(authClient)
+	if err != nil {
+		return err
+	}
+	return fn(authClient, ctx)
+}
+
+// Crear una API key y mostrarla (el servidor no la vuelve a entregar)
+func createAPIKey(client pb.AuthServiceClient, name string, scopes []string, ttl time.Duration, ctx context.Context) error {
+	resp, err := client.CreateApiKey(ctx, &pb.ApiKeyRequest{Name: name, Scopes: scopes, TtlSeconds: int64(ttl / time.Second)})
+	if err != nil {
+		log.Printf("[ERROR] No se pudo crear la API key %s: %v", name, err)
+		return err
+	}
+	log.Printf("[SUCCESS] (%s) API key %s creada", time.Now().Format("15:04:05"), name)
+	fmt.Printf("API key %s (%s), expira el %s:\n", resp.Name, strings.Join(resp.Scopes, ","), time.Unix(resp.Expires, 0).Format("2006-01-02 15:04"))
+	fmt.Println(resp.Key)
+	fmt.Printf("Guárdala ahora: no se vuelve a mostrar. Úsala con %s=<api key>\n", apiKeyEnv)
+	return nil
+}
+
+// Mostrar las API keys vigentes
+func listAPIKeys(client pb.AuthServiceClient, ctx context.Context) error {
+	resp, err := client.ListApiKeys(ctx, &pb.Empty{})
+	if err != nil {
+		log.Printf("[ERROR] No se pudo listar las API keys: %v", err)
+		return err
+	}
+	for _, key := range resp.Keys {
+		lastUsed := "nunca usada"
+		if key.LastUsed > 0 {
+			lastUsed = "usada el " + time.Unix(key.LastUsed, 0).Format("2006-01-02 15:04")
+		}
+		fmt.Printf("%s\t%s\texpira el %s\t%s\n", key.Name, strings.Join(key.Scopes, ","), time.Unix(key.Expires, 0).Format("2006-01-02 15:04"), lastUsed)
+	}
+	return nil
+}
+
+// Revocar una API key
+func revokeAPIKey(client pb.AuthServiceClient, name string, ctx context.Context) error {
+	if _, err := client.RevokeApiKey(ctx, &pb.ApiKeyRequest{Name: name}); err != nil {
+		log.Printf("[ERROR] No se pudo revocar la API key %s: %v", name, err)
+		return err
+	}
+	log.Printf("[SUCCESS] (%s) API key %s revocada", time.Now().Format("15:04:05"), name)
+	fmt.Printf("API key %s revocada\n", name)
+	return nil
+}
+
+// Subcomandos de "apikey"
+var apiKeyCommands = []cli.Command{
+	{
+		Name:      "create",
+		Usage:     "Crear una API key con permisos limitados",
+		ArgsUsage: "<nombre>",
+		Flags: []cli.Flag{
+			cli.StringSliceFlag{Name: "scope", Usage: "Permiso de la API key: read, write, share, groups o admin (se puede repetir; por defecto read)"},
+			cli.DurationFlag{Name: "ttl", Value: 90 * 24 * time.Hour, Usage: "Duración de la API key (máximo 8760h)"},
+		},
+		Action: func(c *cli.Context) error {
+			if c.NArg() < 1 {
+				return fmt.Errorf("debes proporcionar el nombre de la API key")
+			}
+			return withAuthClient(func(client pb.AuthServiceClient, ctx context.Context) error {
+				return createAPIKey(client, c.Args().First(), c.StringSlice("scope"), c.Duration("ttl"), ctx)
+			})
+		},
+	},
+	{
+		Name:  "list",
+		Usage: "Listar tus API keys vigentes",
+		Action: func(c *cli.Context) error {
+			return withAuthClient(func(client pb.AuthServiceClient, ctx context.Context) error {
+				return listAPIKeys(client, ctx)
+			})
+		},
+	},
+	{
+		Name:      "revoke",
+		Usage:     "Revocar una API key",
+		ArgsUsage: "<nombre>",
+		Action: func(c *cli.Context) error {
+			if c.NArg() < 1 {
+				return fmt.Errorf("debes proporcionar el nombre de la API key")
+			}
+			return withAuthClient(func(client pb.AuthServiceClient, ctx context.Context) error {
+				return revokeAPIKey(client, c.Args().First(), ctx)
+			})
+		},
+	},
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	pb "github.com/FelipeMarchantVargas/sync-service/proto"
+)
+
+// ------------------------- PERMISOS, FECHAS Y ENLACES --------------------------------
+
+// Qué hacer con los enlaces simbólicos que apuntan fuera de la carpeta sincronizada (se ajusta con --symlinks).
+// Los que apuntan dentro siempre se sincronizan como enlaces.
+const (
+	symlinksSkip   = "skip"   // No sincronizarlos
+	symlinksLink   = "link"   // Sincronizarlos como enlaces, con el destino tal cual
+	symlinksFollow = "follow" // Sincronizar el contenido del archivo al que apuntan
+)
+
+var symlinkPolicy = symlinksSkip
+
+func validateSymlinkPolicy() error {
+	switch symlinkPolicy {
+	case symlinksSkip, symlinksLink, symlinksFollow:
+		return nil
+	}
+	return fmt.Errorf("modo de enlaces simbólicos no soportado: %s (usa skip, link o follow)", symlinkPolicy)
+}
+
+// Atributos de un archivo que se conservan al sincronizarlo
+type fileAttrs struct {
+	Mode       uint32 // Permisos POSIX (0 = sin información)
+	MTime      int64  // mtime (UnixNano, 0 = sin información)
+	LinkTarget string // Enlace simbólico: destino (el contenido sincronizado es el propio destino)
+}
+
+// Atributos recibidos en el primer fragmento de una descarga
+func chunkAttrs(chunk *pb.FileChunk) fileAttrs {
+	return fileAttrs{Mode: chunk.Mode & 0777, MTime: chunk.Mtime, LinkTarget: chunk.LinkTarget}
+}
+
+// Atributos de un archivo local (se sigan o no los enlaces, según cómo se obtuvo info)
+func statAttrs(info os.FileInfo) fileAttrs {
+	return fileAttrs{Mode: uint32(info.Mode().Perm()), MTime: info.ModTime().UnixNano()}
+}
+
+// Indicar si el destino de un enlace de la carpeta sincronizada queda fuera de ella
+func (e *syncEngine) linkOutsideRoot(path, target string) bool {
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(e.localPath(path)), target)
+	}
+	rel, err := filepath.Rel(e.root, filepath.Clean(target))
+	return err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Obtener lo que se sincroniza de una ruta local: la info del archivo y, si se sincroniza como enlace, su destino.
+// Devuelve info nil si la ruta no existe o no se sincroniza (p. ej. un enlace hacia fuera con --symlinks skip).
+func (e *syncEngine) syncedInfo(path string) (os.FileInfo, string, error) {
+	localPath := e.localPath(path)
+	info, err := os.Lstat(localPath)
+	if os.IsNotExist(err) {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(localPath)
+		if err != nil {
+			return nil, "", err
+		}
+		if !e.linkOutsideRoot(path, target) || symlinkPolicy == symlinksLink {
+			return info, target, nil
+		}
+		if symlinkPolicy != symlinksFollow {
+			return nil, "", nil
+		}
+
+		// Se sigue el enlace: se sincroniza el archivo al que apunta (las carpetas no se siguen)
+		info, err = os.Stat(localPath)
+		if os.IsNotExist(err) {
+			return nil, "", nil
+		}
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	if !info.Mode().IsRegular() {
+		return nil, "", nil
+	}
+	return info, "", nil
+}
+
+// Indicar si una ruta local es un enlace que no se sincroniza (hacia fuera de la carpeta con --symlinks skip,
+// o hacia una carpeta o un destino inexistente fuera de ella con --symlinks follow)
+func (e *syncEngine) skipLink(path string) bool {
+	info, err := os.Lstat(e.localPath(path))
+	if err != nil || info.Mode()&os.ModeSymlink == 0 {
+		return false
+	}
+	synced, _, err := e.syncedInfo(path)
+	return err == nil && synced == nil
+}
+
+// Indicar si un enlace del servidor no debe crearse localmente (apunta fuera de la carpeta con --symlinks skip)
+func (e *syncEngine) skipRemoteLink(path string, target string) bool {
+	return target != "" && symlinkPolicy == symlinksSkip && e.linkOutsideRoot(path, target)
+}
+
+// Leer el contenido que se sube de una ruta local y sus atributos (en un enlace, el contenido es su destino)
+func (e *syncEngine) readLocal(path string) ([]byte, fileAttrs, error) {
+	info, target, err := e.syncedInfo(path)
+	if err != nil {
+		return nil, fileAttrs{}, err
+	}
+	if info == nil {
+		return nil, fileAttrs{}, os.ErrNotExist
+	}
+	if target != "" {
+		return []byte(target), fileAttrs{MTime: info.ModTime().UnixNano(), LinkTarget: target}, nil
+	}
+
+	data, err := os.ReadFile(e.localPath(path))
+	if err != nil {
+		return nil, fileAttrs{}, err
+	}
+	return data, statAttrs(info), nil
+}
+
+// Verificar que ninguna carpeta entre la raíz y una ruta sea un enlace simbólico,
+// para no escribir fuera de la carpeta sincronizada a través de él
+func (e *syncEngine) checkNoLinkedParents(path string) error {
+	parts := strings.Split(path, "/")
+	for i := 1; i < len(parts); i++ {
+		dir := strings.Join(parts[:i], "/")
+		info, err := os.Lstat(e.localPath(dir))
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("%s está dentro de un enlace simbólico (%s)", path, dir)
+		}
+	}
+	return nil
+}
+
+// Ruta en el disco donde se escribe un archivo: con --symlinks follow, un enlace hacia fuera se escribe en su destino
+func (e *syncEngine) writeTarget(path string) string {
+	localPath := e.localPath(path)
+	if symlinkPolicy != symlinksFollow {
+		return localPath
+	}
+	info, err := os.Lstat(localPath)
+	if err != nil || info.Mode()&os.ModeSymlink == 0 {
+		return localPath
+	}
+	target, err := os.Readlink(localPath)
+	if err != nil || !e.linkOutsideRoot(path, target) {
+		return localPath
+	}
+	if resolved, err := filepath.EvalSymlinks(localPath); err == nil {
+		return resolved
+	}
+	return localPath
+}
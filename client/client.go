@@ -1,24 +1,29 @@
 package main
 
 import (
-	"bytes"
-	"compress/gzip"
+	"bufio"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
+	"golang.org/x/term"
 
+	"github.com/FelipeMarchantVargas/sync-service/compression"
 	pb "github.com/FelipeMarchantVargas/sync-service/proto"
 	"github.com/FelipeMarchantVargas/sync-service/server/auth"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 // Estructura para almacenar credenciales
@@ -30,8 +35,17 @@ type Credentials struct {
 // Configurar logrus con archivo de logs
 var log = logrus.New()
 
+// Modo de compresión de las transferencias: "auto", "zstd", "gzip" o "none"
+var compressionMode = "auto"
+
+// Archivos propios del cliente en el directorio de trabajo (nunca se sincronizan)
+const (
+	logFileName         = "client.log"
+	credentialsFileName = "credentials.json"
+)
+
 func init() {
-	file, err := os.OpenFile("client.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	file, err := os.OpenFile(logFileName, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
 	if err != nil {
 		log.Fatalf("No se pudo abrir el archivo de logs: %v", err)
 	}
@@ -43,7 +57,7 @@ func init() {
 
 // Guardar credenciales en un archivo JSON
 func saveCredentials(creds Credentials) error {
-	file, err := os.Create("credentials.json")
+	file, err := os.Create(credentialsFileName)
 	if err != nil {
 		return err
 	}
@@ -56,7 +70,7 @@ func saveCredentials(creds Credentials) error {
 // Cargar credenciales desde un archivo JSON
 func loadCredentials() (Credentials, error) {
 	var creds Credentials
-	file, err := os.Open("credentials.json")
+	file, err := os.Open(credentialsFileName)
 	if err != nil {
 		return creds, err
 	}
@@ -82,35 +96,36 @@ func refreshAuthToken(authClient pb.AuthServiceClient, refreshToken string) (str
 	return resp.Token, resp.RefreshToken, nil
 }
 
-// Iniciar sesión o usar tokens guardados
-func authenticate(authClient pb.AuthServiceClient) (string, string, error) {
-	creds, err := loadCredentials()
-	if err == nil {
-		return creds.Token, creds.RefreshToken, nil
-	}
+// Variable de entorno con una API key: si está definida se usa en lugar de la sesión guardada (p. ej. en CI)
+const apiKeyEnv = "SYNC_API_KEY"
 
-	// Si no hay credenciales almacenadas, iniciar sesión
-	token, refreshToken, err := login(authClient, "admin", "password")
+// Usar la API key del entorno o los tokens guardados por "login"
+func authenticate() (string, string, error) {
+	if apiKey := os.Getenv(apiKeyEnv); apiKey != "" {
+		return apiKey, "", nil
+	}
+	creds, err := loadCredentials()
 	if err != nil {
-		return "", "", err
+		return "", "", fmt.Errorf("no hay una sesión iniciada: usa \"login <usuario>\" o define %s", apiKeyEnv)
 	}
-	saveCredentials(Credentials{Token: token, RefreshToken: refreshToken})
-	return token, refreshToken, nil
+	return creds.Token, creds.RefreshToken, nil
 }
 
 // Obtener contexto con autenticación
 func getAuthContext(authClient pb.AuthServiceClient) (context.Context, error) {
-	token, refreshToken, err := authenticate(authClient)
+	token, refreshToken, err := authenticate()
 	if err != nil {
 		return nil, err
 	}
 
-	// Intentar renovar el token si ha expirado
-	newToken, newRefreshToken, err := refreshAuthToken(authClient, refreshToken)
-	if err == nil {
-		token = newToken
-		refreshToken = newRefreshToken
-		saveCredentials(Credentials{Token: token, RefreshToken: refreshToken})
+	// Intentar renovar el token si ha expirado (una API key no se renueva)
+	if refreshToken != "" {
+		newToken, newRefreshToken, err := refreshAuthToken(authClient, refreshToken)
+		if err == nil {
+			token = newToken
+			refreshToken = newRefreshToken
+			saveCredentials(Credentials{Token: token, RefreshToken: refreshToken})
+		}
 	}
 
 	// Crear contexto con token en metadata
@@ -120,6 +135,25 @@ func getAuthContext(authClient pb.AuthServiceClient) (context.Context, error) {
 
 // ------------------------- SINCRONIZACIÓN --------------------------------
 
+// Elegir el códec para subir un archivo (en modo auto se omite la compresión si el contenido no la aprovecha)
+func uploadCodec(data []byte) string {
+	if compressionMode != "auto" {
+		return compressionMode
+	}
+	if compression.IsCompressible(data) {
+		return compression.Zstd
+	}
+	return compression.None
+}
+
+// Códecs que el cliente acepta al descargar, en orden de preferencia
+func acceptedCodecs() []string {
+	if compressionMode != "auto" {
+		return []string{compressionMode}
+	}
+	return []string{compression.Zstd, compression.Gzip, compression.None}
+}
+
 func uploadFile(client pb.SyncServiceClient, filePath string, ctx context.Context) error {
 	startTime := time.Now()
 
@@ -139,53 +173,19 @@ func uploadFile(client pb.SyncServiceClient, filePath string, ctx context.Contex
 
 	log.Printf("[INFO] (%s) Subiendo %s (%d KB)", time.Now().Format("15:04:05"), filename, fileSize/1024)
 
-	// Abrir el archivo original
-	file, err := os.Open(filePath)
+	// Leer el archivo original
+	data, err := os.ReadFile(filePath)
 	if err != nil {
 		log.Fatalf("[ERROR] No se pudo abrir el archivo: %v", err)
 	}
-	defer file.Close()
-
-	// Comprimir el archivo en memoria
-	var compressedBuffer bytes.Buffer
-	gzipWriter := gzip.NewWriter(&compressedBuffer)
 
-	_, err = io.Copy(gzipWriter, file)
+	// Comprimir y subir el archivo (en partes por varios streams si es grande)
+	resp, err := pushData(client, filename, data, nil, statAttrs(fileInfo), ctx)
 	if err != nil {
-		log.Fatalf("[ERROR] No se pudo comprimir el archivo: %v", err)
-	}
-	gzipWriter.Close()
-
-	// Crear stream para enviar el archivo comprimido
-	stream, err := client.UploadFile(ctx)
-	if err != nil {
-		log.Fatalf("[ERROR] No se pudo iniciar la subida: %v", err)
-	}
-
-	chunkSize := 1024
-	compressedData := compressedBuffer.Bytes()
-	for i := 0; i < len(compressedData); i += chunkSize {
-		end := i + chunkSize
-		if end > len(compressedData) {
-			end = len(compressedData)
-		}
-
-		err := stream.Send(&pb.FileChunk{
-			Filename: filename, // 🔥 No agregamos ".gz"
-			Data:     compressedData[i:end],
-		})
-		if err != nil {
-			log.Fatalf("[ERROR] No se pudo enviar el fragmento: %v", err)
-		}
-	}
-
-	// Cerrar transmisión
-	_, err = stream.CloseAndRecv()
-	if err != nil {
-		log.Fatalf("[ERROR] Error al cerrar la subida: %v", err)
+		log.Fatalf("[ERROR] No se pudo subir el archivo: %v", err)
 	}
 	elapsed := time.Since(startTime)
-	log.Printf("[SUCCESS] (%s) %s subido en %.2f s", time.Now().Format("15:04:05"), filename, elapsed.Seconds())
+	log.Printf("[SUCCESS] (%s) %s subido como versión %d en %.2f s", time.Now().Format("15:04:05"), filename, resp.Version, elapsed.Seconds())
 	return nil
 }
 
@@ -193,33 +193,10 @@ func downloadFile(client pb.SyncServiceClient, filename string, ctx context.Cont
 	startTime := time.Now()
 	log.Printf("[INFO] (%s) Descargando %s...", time.Now().Format("15:04:05"), filename)
 
-	stream, err := client.DownloadFile(ctx, &pb.FileRequest{Filename: filename})
+	// Descargar y descomprimir el archivo (por rangos en paralelo si es grande)
+	decompressedData, _, attrs, err := fetchFile(client, filename, ctx)
 	if err != nil {
-		log.Fatalf("[ERROR] No se pudo solicitar el archivo: %v", err)
-	}
-
-	var compressedBuffer bytes.Buffer
-	for {
-		chunk, err := stream.Recv()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			log.Fatalf("[ERROR] No se pudo recibir el fragmento: %v", err)
-		}
-		compressedBuffer.Write(chunk.Data)
-	}
-
-	// Descomprimir archivo
-	reader, err := gzip.NewReader(&compressedBuffer)
-	if err != nil {
-		log.Fatalf("[ERROR] No se pudo descomprimir el archivo: %v", err)
-	}
-
-	decompressedData, err := io.ReadAll(reader)
-	reader.Close()
-	if err != nil {
-		log.Fatalf("[ERROR] Error al leer archivo descomprimido: %v", err)
+		log.Fatalf("[ERROR] No se pudo descargar el archivo: %v", err)
 	}
 
 	// 🔥 Si el archivo tiene `.gz`, eliminarlo del nombre antes de guardar
@@ -228,9 +205,9 @@ func downloadFile(client pb.SyncServiceClient, filename string, ctx context.Cont
 		cleanFilename = filename[:len(filename)-3]
 	}
 
-	// Guardar el archivo descomprimido con su nombre correcto
+	// Guardar el archivo descomprimido con su nombre correcto, sus permisos y su mtime
 	filePath := filepath.Join("./", cleanFilename)
-	err = os.WriteFile(filePath, decompressedData, 0644)
+	err = writeLocalFile(filePath, decompressedData, attrs)
 	if err != nil {
 		log.Fatalf("[ERROR] No se pudo guardar el archivo: %v", err)
 	}
@@ -292,6 +269,27 @@ func listFiles(client pb.SyncServiceClient, ctx context.Context) error {
 	return nil
 }
 
+// Mostrar los cambios registrados en el servidor desde una secuencia
+func listChanges(client pb.SyncServiceClient, ctx context.Context, since int64) error {
+	for {
+		resp, err := client.GetChanges(ctx, &pb.ChangesRequest{Since: since})
+		if err != nil {
+			log.Printf("[ERROR] No se pudo obtener la lista de cambios: %v", err)
+			return err
+		}
+
+		for _, change := range resp.Changes {
+			fmt.Printf("#%d\t%s\t%s\t%s\n", change.Sequence, time.Unix(change.Timestamp, 0).Format("2006-01-02 15:04:05"), change.Action, change.Filename)
+			since = change.Sequence
+		}
+
+		if !resp.HasMore {
+			log.Printf("[INFO] Última secuencia en el servidor: %d", resp.Latest)
+			return nil
+		}
+	}
+}
+
 func deleteFile(client pb.SyncServiceClient, filePath string, ctx context.Context) error {
 	startTime := time.Now()
 
@@ -311,85 +309,276 @@ func deleteFile(client pb.SyncServiceClient, filePath string, ctx context.Contex
 	return nil
 }
 
-func login(client pb.AuthServiceClient, username, password string) (string, string, error) {
+// Mover o renombrar un archivo en el servidor sin volver a subirlo
+func moveFile(client pb.SyncServiceClient, from, to string, ctx context.Context) error {
+	log.Printf("[INFO] (%s) Moviendo %s a %s en el servidor...", time.Now().Format("15:04:05"), from, to)
+
+	resp, err := client.MoveFile(ctx, &pb.MoveRequest{From: from, To: to})
+	if err != nil {
+		log.Printf("[ERROR] No se pudo mover el archivo en el servidor: %v", err)
+		return err
+	}
+
+	log.Printf("[SUCCESS] (%s) %s movido a %s (versión %d)", time.Now().Format("15:04:05"), from, to, resp.Version)
+	return nil
+}
+
+func login(client pb.AuthServiceClient, username, password, otp string) (string, string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
 
 	resp, err := client.Login(ctx, &pb.LoginRequest{
 		Username: username,
 		Password: password,
+		Otp:      otp,
 	})
 	if err != nil {
 		log.Fatalf("[ERROR] No se pudo autenticar: %v", err)
 	}
+
+	// La cuenta tiene el segundo factor activado: pedir el código y volver a intentar
+	if resp.OtpRequired {
+		code, err := promptLine("Código de verificación (o código de recuperación): ")
+		if err != nil {
+			return "", "", err
+		}
+		if code == "" {
+			return "", "", fmt.Errorf("la cuenta pide un código de verificación")
+		}
+		return login(client, username, password, code)
+	}
 	log.Println("[SUCCESS] Token obtenido:", resp.Token)
 	return resp.Token, resp.RefreshToken, nil
 }
 
-func watchDirectory(syncClient pb.SyncServiceClient, dirPath string, ctx context.Context) {
+// Pedir una línea en la terminal (p. ej. un código de verificación)
+func promptLine(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("no se pudo leer la respuesta: %v", err)
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// Pedir una contraseña en la terminal sin mostrarla
+func promptPassword(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	password, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("no se pudo leer la contraseña: %v", err)
+	}
+	return string(password), nil
+}
+
+// Observar la carpeta sincronizada (y sus subcarpetas) y sincronizar cada archivo que cambie.
+// Si el servidor no responde se sigue observando y los cambios esperan en la cola.
+func (e *syncEngine) watchDirectory() error {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
-		log.Fatalf("[ERROR] No se pudo iniciar el watcher: %v", err)
+		return fmt.Errorf("no se pudo iniciar el watcher: %v", err)
 	}
 	defer watcher.Close()
 
-	// Agregar el directorio a la lista de observados
-	err = watcher.Add(dirPath)
+	// Agregar el directorio y sus subdirectorios a la lista de observados
+	err = e.addWatchRecursive(watcher, e.root)
 	if err != nil {
-		log.Fatalf("[ERROR] No se pudo observar el directorio: %v", err)
+		return fmt.Errorf("no se pudo observar el directorio: %v", err)
 	}
 
-	log.Println("[INFO] Monitoreando cambios en:", dirPath)
+	log.Println("[INFO] Monitoreando cambios en:", e.root)
+
+	// Los eventos se agrupan por ruta y se sincronizan en orden desde una cola
+	changes := newDebouncer(debounceWindow, e.localPath)
+	go e.runWatchWorker(changes)
 
 	for {
 		select {
 		case event, ok := <-watcher.Events:
 			if !ok {
-				return
+				return nil
 			}
 
-			// Detectar si es creación o modificación
-			if event.Op&fsnotify.Create == fsnotify.Create || event.Op&fsnotify.Write == fsnotify.Write {
-				log.Printf("[INFO] Detectado nuevo archivo/modificación: %s", event.Name)
-				uploadFile(syncClient, event.Name, ctx)
+			path, ok := e.relPath(event.Name)
+			if !ok {
+				continue
 			}
-			// Detectar eliminación de archivos
-			if event.Op&fsnotify.Remove == fsnotify.Remove {
-				log.Printf("[INFO] (%s) Detectada eliminación: %s", time.Now().Format("15:04:05"), event.Name)
-				deleteFile(syncClient, event.Name, ctx)
+			// Un enlace a una carpeta se sincroniza como enlace, sin entrar en ella
+			info, err := os.Lstat(event.Name)
+			isDir := err == nil && info.IsDir()
+			if e.skipPath(path, isDir) {
+				continue
+			}
+
+			// Carpeta nueva: observarla y sincronizar lo que ya tenga adentro
+			if isDir {
+				if event.Op&fsnotify.Create == fsnotify.Create {
+					log.Printf("[INFO] Detectada nueva carpeta: %s", path)
+					e.addWatchRecursive(watcher, event.Name)
+					e.touchTree(changes, event.Name)
+				}
+				continue
+			}
+
+			// Chmod: un cambio de permisos también se sincroniza
+			if event.Op&(fsnotify.Create|fsnotify.Write|fsnotify.Remove|fsnotify.Rename|fsnotify.Chmod) == 0 {
+				continue
+			}
+
+			// Un renombre llega como Rename en la ruta anterior y Create en la nueva: se guardan para emparejarlos
+			if event.Op&(fsnotify.Rename|fsnotify.Create) != 0 {
+				e.noteMoveHint(path, event.Op&fsnotify.Rename != 0)
+			}
+
+			// Una carpeta borrada o movida afecta a todos los archivos sincronizados que contenía
+			changes.touch(path)
+			for _, p := range e.trackedUnder(path) {
+				changes.touch(p)
 			}
 
 		case err, ok := <-watcher.Errors:
 			if !ok {
-				return
+				return nil
 			}
 			log.Printf("[ERROR] Error en watcher: %v", err)
+
+		case <-e.ctx.Done():
+			return e.stopped()
+		}
+	}
+}
+
+// Observar un directorio y todos sus subdirectorios (salvo los internos del cliente)
+func (e *syncEngine) addWatchRecursive(watcher *fsnotify.Watcher, dir string) error {
+	return filepath.WalkDir(dir, func(localPath string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return err
+		}
+		if path, ok := e.relPath(localPath); ok && e.skipPath(path, true) {
+			return filepath.SkipDir
+		}
+		return watcher.Add(localPath)
+	})
+}
+
+// Encolar todos los archivos dentro de una carpeta local (p. ej. una carpeta movida o renombrada)
+func (e *syncEngine) touchTree(changes *debouncer, dir string) {
+	filepath.WalkDir(dir, func(localPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		path, ok := e.relPath(localPath)
+		if !ok {
+			return nil
+		}
+		if e.skipPath(path, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() {
+			e.noteMoveHint(path, false)
+			changes.touch(path)
+		}
+		return nil
+	})
+}
+
+// Escuchar actualizaciones del servidor y aplicarlas a la carpeta local. Si se corta la conexión,
+// se reconecta con espera exponencial y se retoma desde el último cursor guardado.
+func (e *syncEngine) listenForUpdates() {
+	resyncAttempt := 0
+	for {
+		e.waitOnline()
+		if e.ctx.Err() != nil {
+			return
 		}
+		token := e.tokens.current()
+		err := e.streamUpdates()
+		if e.ctx.Err() != nil {
+			return
+		}
+
+		// El servidor ya descartó los cambios desde el cursor: comparar la carpeta completa, que deja el cursor al día
+		if status.Code(err) == codes.OutOfRange {
+			log.Printf("[INFO] (%s) %s", time.Now().Format("15:04:05"), status.Convert(err).Message())
+			err = e.syncAll()
+			if err == nil {
+				resyncAttempt = 0
+				continue
+			}
+			if isOffline(err) {
+				e.goOffline(err)
+				continue
+			}
+			log.Printf("[ERROR] Sincronización completa fallida: %v", err)
+			select {
+			case <-time.After(reconnectDelay(resyncAttempt)):
+			case <-e.ctx.Done():
+				return
+			}
+			resyncAttempt++
+			continue
+		}
+		// Token expirado o rechazado: renovarlo y volver a escuchar desde el mismo cursor
+		if status.Code(err) == codes.Unauthenticated && e.tokens.refresh(token) == nil {
+			continue
+		}
+		log.Printf("[ERROR] (%s) Se cortó el stream de actualizaciones: %v", time.Now().Format("15:04:05"), err)
+		e.goOffline(err)
 	}
 }
 
-func listenForUpdates(client pb.SyncServiceClient, ctx context.Context) {
-	stream, err := client.SyncUpdates(ctx, &pb.Empty{})
+// Recibir y aplicar los cambios del servidor, empezando por los perdidos desde el último cursor guardado
+func (e *syncEngine) streamUpdates() error {
+	since := e.cursor()
+	include, exclude := e.selection()
+	stream, err := e.client.SyncUpdates(e.ctx, &pb.SyncRequest{Since: since, Resume: since > 0, Include: include, Exclude: exclude})
 	if err != nil {
-		log.Fatalf("[ERROR] No se pudo conectar al stream de actualizaciones: %v", err)
+		return err
 	}
 
-	log.Println("[INFO] Escuchando actualizaciones del servidor...")
+	log.Printf("[INFO] Escuchando actualizaciones del servidor desde la secuencia %d...", since)
 
 	for {
 		update, err := stream.Recv()
 		if err == io.EOF {
-			break
+			return fmt.Errorf("el servidor cerró el stream")
 		}
 		if err != nil {
-			log.Fatalf("[ERROR] Error al recibir actualización: %v", err)
+			return err
 		}
 
-		log.Printf("[INFO] (%s) Cambio en el servidor: %s - %s", time.Now().Format("15:04:05"), update.Action, update.Filename)
+		log.Printf("[INFO] (%s) Cambio #%d en el servidor: %s - %s", time.Now().Format("15:04:05"), update.Sequence, update.Action, update.Path)
+
+		// Movimiento hecho en otro dispositivo: renombrar localmente sin descargar
+		if update.Action == "renamed" && update.PreviousPath != "" {
+			if err := e.applyRemoteMove(update); err != nil {
+				if isOffline(err) {
+					return err
+				}
+				log.Printf("[ERROR] No se pudo aplicar el movimiento de %s a %s: %v", update.PreviousPath, update.Path, err)
+				continue
+			}
+			e.advanceCursor(update.Sequence)
+			continue
+		}
 
-		if update.Action == "created" {
-			downloadFile(client, update.Filename, ctx)
+		// Si ya tenemos esta versión (o una posterior) no hay nada que hacer. Al perder el acceso a un archivo
+		// compartido, el servidor ya no lo muestra y la copia local se borra.
+		if update.Action == "deleted" || update.Action == "unshared" || update.Version > e.syncedVersion(update.Path) {
+			if err := e.syncPath(update.Path); err != nil {
+				// Sin conexión, el cambio se vuelve a recibir al reconectar (el cursor no avanzó)
+				if isOffline(err) {
+					return err
+				}
+				log.Printf("[ERROR] No se pudo aplicar el cambio de %s: %v", update.Path, err)
+				continue
+			}
 		}
+		e.advanceCursor(update.Sequence)
 	}
 }
 
@@ -419,6 +608,11 @@ func getUsernameFromContext(ctx context.Context) (string, error) {
 	}
 
 	token := tokens[0]
+	// Una API key no lleva el usuario: se usa su identificador (sk_<id>_<secreto>)
+	if rest, ok := strings.CutPrefix(token, "sk_"); ok {
+		id, _, _ := strings.Cut(rest, "_")
+		return "apikey-" + id, nil
+	}
 	_, claims, err := auth.ValidateToken(token) // Debes asegurarte de tener `ValidateToken` en `auth`
 	if err != nil {
 		return "", fmt.Errorf("Token inválido: %v", err)
@@ -433,13 +627,143 @@ func getUsernameFromContext(ctx context.Context) (string, error) {
 }
 
 
+// Conectarse al servidor y ejecutar fn con el motor de sincronización de la carpeta indicada (por defecto ".")
+func withSyncEngine(c *cli.Context, fn func(engine *syncEngine) error) error {
+	dir := "."
+	if c.NArg() > 0 {
+		dir = c.Args().First()
+	}
+
+	// El token va en cada llamada y se renueva solo: el motor puede quedar observando por horas
+	conn, tokens, closeConn, err := dialWithSession()
+	if err != nil {
+		return err
+	}
+	defer closeConn()
+
+	engine, err := newSyncEngine(dir, pb.NewSyncServiceClient(conn), tokens)
+	if err != nil {
+		return err
+	}
+	defer engine.cancel()
+	return fn(engine)
+}
+
 // 🛠️ Configurar la CLI
 func main() {
 	app := &cli.App{
 		Name:  "SyncService Client",
 		Usage: "Cliente gRPC para sincronización de archivos",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:        "compression",
+				Value:       "auto",
+				Usage:       "Compresión de las transferencias: auto, zstd, gzip o none",
+				Destination: &compressionMode,
+			},
+			cli.IntFlag{
+				Name:        "parallel",
+				Value:       parallelism,
+				Usage:       "Streams simultáneos para transferir archivos grandes",
+				Destination: &parallelism,
+			},
+			cli.IntFlag{
+				Name:        "part-size",
+				Value:       partSize,
+				Usage:       "Tamaño en bytes de cada parte transferida en paralelo",
+				Destination: &partSize,
+			},
+			cli.IntFlag{
+				Name:        "chunk-size",
+				Value:       chunkSize,
+				Usage:       "Tamaño en bytes de cada fragmento enviado por el stream",
+				Destination: &chunkSize,
+			},
+			cli.StringFlag{
+				Name:        "conflict",
+				Value:       conflictPolicy,
+				Usage:       "Resolución de conflictos al sincronizar: keep-both, newest, local, remote o prompt",
+				Destination: &conflictPolicy,
+			},
+			cli.BoolTFlag{
+				Name:        "merge",
+				Usage:       "Combinar automáticamente los conflictos en archivos de texto (--merge=false para desactivarlo)",
+				Destination: &mergeText,
+			},
+			cli.StringFlag{
+				Name:        "symlinks",
+				Value:       symlinkPolicy,
+				Usage:       "Enlaces simbólicos que apuntan fuera de la carpeta: skip (no sincronizar), link (como enlaces) o follow (su contenido)",
+				Destination: &symlinkPolicy,
+			},
+			cli.DurationFlag{
+				Name:        "debounce",
+				Value:       debounceWindow,
+				Usage:       "Tiempo sin cambios que se espera antes de sincronizar un archivo modificado",
+				Destination: &debounceWindow,
+			},
+		},
+		Before: func(c *cli.Context) error {
+			if compressionMode != "auto" && !compression.Supported(compressionMode) {
+				return fmt.Errorf("modo de compresión no soportado: %s", compressionMode)
+			}
+			if err := validateConflictPolicy(); err != nil {
+				return err
+			}
+			if err := validateSymlinkPolicy(); err != nil {
+				return err
+			}
+			return validateTransferConfig()
+		},
 		Commands: []cli.Command{
 			{
+				Name:      "login",
+				Usage:     "Iniciar sesión con una cuenta del servidor o con su proveedor OIDC (las credenciales se guardan en credentials.json)",
+				ArgsUsage: "<usuario>",
+				Flags: []cli.Flag{
+					cli.StringFlag{Name: "password", Usage: "Contraseña (si no se indica, se pide en la terminal)"},
+					cli.StringFlag{Name: "otp", Usage: "Código de verificación del segundo factor (si la cuenta lo pide y no se indica, se pide en la terminal)"},
+					cli.BoolFlag{Name: "oidc", Usage: "Iniciar sesión en el navegador con el proveedor de identidad del servidor"},
+					cli.BoolFlag{Name: "device", Usage: "Como --oidc, pero ingresando un código en otro dispositivo (sin navegador local)"},
+				},
+				Action: func(c *cli.Context) error {
+					external := c.Bool("oidc") || c.Bool("device")
+					if c.NArg() < 1 && !external {
+						return fmt.Errorf("debes proporcionar el nombre de usuario (o usar --oidc)")
+					}
+					password := c.String("password")
+					if password == "" && !external {
+						var err error
+						if password, err = promptPassword("Contraseña: "); err != nil {
+							return err
+						}
+					}
+					conn, err := grpc.Dial("localhost:50051", grpc.WithInsecure())
+					if err != nil {
+						return err
+					}
+					defer conn.Close()
+
+					var token, refreshToken string
+					if external {
+						token, refreshToken, err = oidcLogin(pb.NewAuthServiceClient(conn), c.Bool("device"))
+					} else {
+						token, refreshToken, err = login(pb.NewAuthServiceClient(conn), c.Args().First(), password, c.String("otp"))
+					}
+					if err != nil {
+						return err
+					}
+					if err := saveCredentials(Credentials{Token: token, RefreshToken: refreshToken}); err != nil {
+						return err
+					}
+					if external {
+						fmt.Println("Sesión iniciada con el proveedor de identidad")
+					} else {
+						fmt.Printf("Sesión iniciada como %s\n", c.Args().First())
+					}
+					return nil
+				},
+			}, {
 				Name:    "upload",
 				Aliases: []string{"u"},
 				Usage:   "Subir un archivo al servidor",
@@ -508,6 +832,86 @@ func main() {
 					
 					return listFiles(syncClient, ctx)
 				},
+			}, {
+				Name:      "sync",
+				Aliases:   []string{"s"},
+				Usage:     "Sincronizar una carpeta con el servidor en ambos sentidos (una pasada)",
+				ArgsUsage: "[carpeta]",
+				Flags: []cli.Flag{
+					cli.BoolFlag{Name: "dry-run", Usage: "Mostrar el plan de sincronización sin aplicarlo"},
+				},
+				Action: func(c *cli.Context) error {
+					return withSyncEngine(c, func(engine *syncEngine) error {
+						if c.Bool("dry-run") {
+							return engine.printPlan()
+						}
+						return engine.syncAll()
+					})
+				},
+			}, {
+				Name:      "watch",
+				Aliases:   []string{"w"},
+				Usage:     "Sincronizar una carpeta en tiempo real (empieza reconciliando lo que cambió mientras no se observaba)",
+				ArgsUsage: "[carpeta]",
+				Flags: []cli.Flag{
+					cli.BoolFlag{Name: "dry-run", Usage: "Mostrar el plan de la reconciliación inicial sin aplicarlo ni empezar a observar"},
+				},
+				Action: func(c *cli.Context) error {
+					return withSyncEngine(c, func(engine *syncEngine) error {
+						if c.Bool("dry-run") {
+							return engine.printPlan()
+						}
+						go engine.listenForUpdates()
+						return engine.watchDirectory()
+					})
+				},
+			}, {
+				Name:      "select",
+				Usage:     "Elegir qué carpetas del servidor se sincronizan en una carpeta local",
+				ArgsUsage: "[carpeta]",
+				Flags: []cli.Flag{
+					cli.StringSliceFlag{Name: "include", Usage: "Sincronizar solo esta carpeta del servidor (se puede repetir)"},
+					cli.StringSliceFlag{Name: "exclude", Usage: "No sincronizar esta carpeta del servidor (se puede repetir)"},
+					cli.BoolFlag{Name: "all", Usage: "Volver a sincronizar todas las carpetas"},
+				},
+				Action: func(c *cli.Context) error {
+					return withSyncEngine(c, func(engine *syncEngine) error {
+						include, exclude := c.StringSlice("include"), c.StringSlice("exclude")
+						if !c.Bool("all") && len(include) == 0 && len(exclude) == 0 {
+							engine.printSelection()
+							return nil
+						}
+
+						// Se borra lo que quedó fuera y se descarga lo que entró
+						if err := engine.setSelection(include, exclude); err != nil {
+							return err
+						}
+						engine.printSelection()
+						return engine.syncAll()
+					})
+				},
+			}, {
+				Name:  "changes",
+				Usage: "Listar los cambios registrados en el servidor desde una secuencia",
+				Flags: []cli.Flag{
+					cli.Int64Flag{Name: "since", Usage: "Mostrar solo los cambios posteriores a esta secuencia"},
+				},
+				Action: func(c *cli.Context) error {
+					conn, err := grpc.Dial("localhost:50051", grpc.WithInsecure())
+					if err != nil {
+						return err
+					}
+					defer conn.Close()
+
+					syncClient := pb.NewSyncServiceClient(conn)
+					authClient := pb.NewAuthServiceClient(conn)
+					ctx, err := getAuthContext(authClient)
+					if err != nil {
+						return err
+					}
+
+					return listChanges(syncClient, ctx, c.Int64("since"))
+				},
 			},{
 				Name:    "delete",
 				Aliases: []string{"del"},
@@ -532,6 +936,146 @@ func main() {
 
 					return deleteFile(syncClient, filename, ctx)
 				},
+			}, {
+				Name:      "move",
+				Aliases:   []string{"mv"},
+				Usage:     "Mover o renombrar un archivo en el servidor",
+				ArgsUsage: "<origen> <destino>",
+				Action: func(c *cli.Context) error {
+					if c.NArg() < 2 {
+						return fmt.Errorf("debes proporcionar la ruta de origen y la de destino")
+					}
+					conn, err := grpc.Dial("localhost:50051", grpc.WithInsecure())
+					if err != nil {
+						return err
+					}
+					defer conn.Close()
+
+					syncClient := pb.NewSyncServiceClient(conn)
+					authClient := pb.NewAuthServiceClient(conn)
+					ctx, err := getAuthContext(authClient)
+					if err != nil {
+						return err
+					}
+
+					return moveFile(syncClient, c.Args().Get(0), c.Args().Get(1), ctx)
+				},
+			}, {
+				Name:      "share",
+				Usage:     "Compartir un archivo propio con otro usuario",
+				ArgsUsage: "<archivo> <usuario>",
+				Flags: []cli.Flag{
+					cli.BoolFlag{Name: "write", Usage: "Permitir también modificarlo y borrarlo (por defecto solo lectura)"},
+				},
+				Action: func(c *cli.Context) error {
+					if c.NArg() < 2 {
+						return fmt.Errorf("debes proporcionar el archivo y el usuario")
+					}
+					permission := "read"
+					if c.Bool("write") {
+						permission = "write"
+					}
+					conn, err := grpc.Dial("localhost:50051", grpc.WithInsecure())
+					if err != nil {
+						return err
+					}
+					defer conn.Close()
+
+					syncClient := pb.NewSyncServiceClient(conn)
+					authClient := pb.NewAuthServiceClient(conn)
+					ctx, err := getAuthContext(authClient)
+					if err != nil {
+						return err
+					}
+
+					return shareFile(syncClient, c.Args().Get(0), c.Args().Get(1), permission, ctx)
+				},
+			}, {
+				Name:      "unshare",
+				Usage:     "Dejar de compartir un archivo propio con otro usuario",
+				ArgsUsage: "<archivo> <usuario>",
+				Action: func(c *cli.Context) error {
+					if c.NArg() < 2 {
+						return fmt.Errorf("debes proporcionar el archivo y el usuario")
+					}
+					conn, err := grpc.Dial("localhost:50051", grpc.WithInsecure())
+					if err != nil {
+						return err
+					}
+					defer conn.Close()
+
+					syncClient := pb.NewSyncServiceClient(conn)
+					authClient := pb.NewAuthServiceClient(conn)
+					ctx, err := getAuthContext(authClient)
+					if err != nil {
+						return err
+					}
+
+					return unshareFile(syncClient, c.Args().Get(0), c.Args().Get(1), ctx)
+				},
+			}, {
+				Name:  "shared",
+				Usage: "Listar los archivos que otros usuarios compartieron contigo",
+				Action: func(c *cli.Context) error {
+					conn, err := grpc.Dial("localhost:50051", grpc.WithInsecure())
+					if err != nil {
+						return err
+					}
+					defer conn.Close()
+
+					syncClient := pb.NewSyncServiceClient(conn)
+					authClient := pb.NewAuthServiceClient(conn)
+					ctx, err := getAuthContext(authClient)
+					if err != nil {
+						return err
+					}
+
+					return listShared(syncClient, ctx)
+				},
+			}, {
+				Name:      "link",
+				Usage:     "Crear un enlace temporal para que alguien sin cuenta descargue un archivo",
+				ArgsUsage: "<archivo>",
+				Flags: []cli.Flag{
+					cli.DurationFlag{Name: "ttl", Value: 24 * time.Hour, Usage: "Duración del enlace (máximo 720h)"},
+					cli.StringFlag{Name: "password", Usage: "Contraseña para descargarlo (se envía con autenticación básica)"},
+					cli.IntFlag{Name: "max-downloads", Usage: "Máximo de descargas (0 = sin límite)"},
+				},
+				Action: func(c *cli.Context) error {
+					if c.NArg() < 1 {
+						return fmt.Errorf("debes proporcionar el archivo")
+					}
+					conn, err := grpc.Dial("localhost:50051", grpc.WithInsecure())
+					if err != nil {
+						return err
+					}
+					defer conn.Close()
+
+					syncClient := pb.NewSyncServiceClient(conn)
+					authClient := pb.NewAuthServiceClient(conn)
+					ctx, err := getAuthContext(authClient)
+					if err != nil {
+						return err
+					}
+
+					return createShareLink(syncClient, c.Args().First(), c.Duration("ttl"), c.String("password"), c.Int("max-downloads"), ctx)
+				},
+			}, {
+				Name:        "group",
+				Usage:       "Administrar grupos con carpetas de equipo (team:<grupo>/...)",
+				Subcommands: groupCommands,
+			}, {
+				Name:        "admin",
+				Usage:       "Administrar el servidor (requiere una cuenta con rol admin)",
+				Subcommands: adminCommands,
+			}, {
+				Name:        "2fa",
+				Usage:       "Activar o desactivar el segundo factor (códigos TOTP de una aplicación de autenticación)",
+				Subcommands: twoFactorCommands,
+			}, {
+				Name:        "apikey",
+				Usage:       "Administrar API keys para clientes sin sesión interactiva (se usan con " + apiKeyEnv + ")",
+				Subcommands: apiKeyCommands,
 			},
 		},
 	}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Políticas de resolución de conflictos
+const (
+	conflictKeepBoth = "keep-both" // Guardar la versión local como copia en conflicto y descargar la remota
+	conflictNewest   = "newest"    // Quedarse con la versión modificada más recientemente
+	conflictLocal    = "local"     // Quedarse con la versión local
+	conflictRemote   = "remote"    // Quedarse con la versión del servidor
+	conflictPrompt   = "prompt"    // Preguntar en la terminal
+)
+
+// Política usada cuando un archivo cambió localmente y en el servidor (se ajusta con --conflict)
+var conflictPolicy = conflictKeepBoth
+
+// Veces que se vuelve a decidir una acción que el servidor rechazó por conflicto de versiones
+const maxConflictRetries = 3
+
+// Evita que dos conflictos pregunten en la terminal a la vez
+var promptMu sync.Mutex
+
+// Validar la política de conflictos elegida
+func validateConflictPolicy() error {
+	switch conflictPolicy {
+	case conflictKeepBoth, conflictNewest, conflictLocal, conflictRemote, conflictPrompt:
+		return nil
+	}
+	return fmt.Errorf("política de conflictos no soportada: %s (keep-both, newest, local, remote o prompt)", conflictPolicy)
+}
+
+// Indicar si un error del servidor es un conflicto de versiones
+func isConflict(err error) bool {
+	return status.Code(err) == codes.Aborted
+}
+
+// Versión base a enviar al servidor según el estado remoto visto al decidir (0 = el archivo no debe existir)
+func baseVersion(action syncAction) *int64 {
+	var version int64
+	if action.Remote != nil {
+		version = action.Remote.Version
+	}
+	return &version
+}
+
+// Nombre de la copia en conflicto: "dir/nombre (conflicted copy from host 2006-01-02 150405).ext"
+func conflictCopyName(p string, now time.Time) string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "desconocido"
+	}
+	dir, file := path.Split(p)
+	ext := path.Ext(file)
+	name := strings.TrimSuffix(file, ext)
+	if name == "" {
+		// Archivos ocultos como ".bashrc": la extensión es todo el nombre
+		name, ext = file, ""
+	}
+	return fmt.Sprintf("%s%s (conflicted copy from %s %s)%s", dir, name, host, now.Format("2006-01-02 150405"), ext)
+}
+
+// Resolver un conflicto según la política configurada (debe llamarse con e.mu tomado)
+func (e *syncEngine) resolveConflict(action syncAction) error {
+	policy := conflictPolicy
+
+	// En archivos de texto se intenta primero combinar ambos cambios (salvo que se prefiera un lado)
+	if mergeText && policy != conflictLocal && policy != conflictRemote {
+		if merged, err := e.mergeConflict(action); merged || err != nil {
+			return err
+		}
+	}
+
+	if policy == conflictPrompt {
+		policy = promptConflict(action)
+	}
+	if policy == conflictNewest {
+		policy = conflictRemote
+		if action.Local.ModTime/int64(time.Second) >= action.Remote.ModTime {
+			policy = conflictLocal
+		}
+	}
+
+	log.Printf("[INFO] (%s) Conflicto en %s: cambió localmente y en el servidor (versión %d), se resuelve con %s", time.Now().Format("15:04:05"), action.Path, action.Remote.Version, policy)
+
+	switch policy {
+	case conflictLocal:
+		// Sobrescribir la versión remota que se vio al decidir
+		return e.applyUpload(action)
+	case conflictRemote:
+		return e.applyDownload(action)
+	}
+
+	// keep-both: apartar la versión local, descargar la remota en su lugar y subir la copia como archivo nuevo
+	copyPath := conflictCopyName(action.Path, time.Now())
+	if err := os.Rename(e.localPath(action.Path), e.localPath(copyPath)); err != nil {
+		return fmt.Errorf("no se pudo crear la copia en conflicto: %v", err)
+	}
+	e.noteOwnWrite(action.Path)
+	log.Printf("[INFO] (%s) Versión local de %s guardada como %s", time.Now().Format("15:04:05"), action.Path, copyPath)
+
+	download := action
+	download.Local = nil
+	if err := e.applyDownload(download); err != nil {
+		return err
+	}
+
+	local, err := e.statLocal(copyPath)
+	if err != nil || local == nil {
+		return err
+	}
+	return e.applyUpload(syncAction{Kind: actionUpload, Path: copyPath, Local: local})
+}
+
+// Preguntar en la terminal cómo resolver un conflicto
+func promptConflict(action syncAction) string {
+	promptMu.Lock()
+	defer promptMu.Unlock()
+
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Printf("\n⚠️ Conflicto en %s: cambió localmente y en el servidor (versión %d).\n", action.Path, action.Remote.Version)
+		fmt.Print("¿Qué versión conservar? [l]ocal, [r]emota, [a]mbas: ")
+
+		answer, err := reader.ReadString('\n')
+		if err != nil {
+			// Sin terminal no se puede preguntar: no perder ninguna de las dos versiones
+			return conflictKeepBoth
+		}
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "l", "local":
+			return conflictLocal
+		case "r", "remota", "remote":
+			return conflictRemote
+		case "a", "ambas", "both":
+			return conflictKeepBoth
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// Tiempo sin eventos que se espera antes de sincronizar una ruta (se ajusta con --debounce)
+var debounceWindow = 500 * time.Millisecond
+
+// Rutas que pueden esperar a ser sincronizadas; si se llena, se hace una sincronización completa
+const watchQueueSize = 1024
+
+// Cambio local pendiente: se sincroniza cuando la ruta deja de recibir eventos y de crecer
+type pendingChange struct {
+	timer   *time.Timer
+	exists  bool
+	size    int64
+	modTime int64 // UnixNano
+}
+
+// Agrupa los eventos del watcher por ruta y entrega cada ruta una sola vez cuando se estabiliza.
+// Un guardado atómico de un editor (escribir un temporal y renombrarlo encima, o mover el original
+// y crear uno nuevo) llega como varios eventos de la misma ruta y se entrega como una sola modificación.
+type debouncer struct {
+	quiet     time.Duration
+	localPath func(path string) string
+
+	mu       sync.Mutex
+	pending  map[string]*pendingChange
+	queued   map[string]bool
+	overflow bool
+	queue    chan string
+}
+
+func newDebouncer(quiet time.Duration, localPath func(path string) string) *debouncer {
+	return &debouncer{
+		quiet:     quiet,
+		localPath: localPath,
+		pending:   make(map[string]*pendingChange),
+		queued:    make(map[string]bool),
+		queue:     make(chan string, watchQueueSize),
+	}
+}
+
+// Registrar un evento de una ruta, reiniciando su espera
+func (d *debouncer) touch(path string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	change, ok := d.pending[path]
+	if ok {
+		change.timer.Stop()
+	} else {
+		change = &pendingChange{}
+		d.pending[path] = change
+	}
+	change.exists, change.size, change.modTime = d.observe(path)
+	change.timer = time.AfterFunc(d.quiet, func() { d.settle(path) })
+}
+
+// Tamaño y mtime actuales de una ruta
+func (d *debouncer) observe(path string) (bool, int64, int64) {
+	info, err := os.Lstat(d.localPath(path))
+	if err != nil {
+		return false, 0, 0
+	}
+	return true, info.Size(), info.ModTime().UnixNano()
+}
+
+// Fin de la espera: si el archivo siguió cambiando (p. ej. una copia grande sin eventos intermedios) se espera otra vez
+func (d *debouncer) settle(path string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	change, ok := d.pending[path]
+	if !ok {
+		return
+	}
+	exists, size, modTime := d.observe(path)
+	if exists != change.exists || size != change.size || modTime != change.modTime {
+		change.exists, change.size, change.modTime = exists, size, modTime
+		change.timer = time.AfterFunc(d.quiet, func() { d.settle(path) })
+		return
+	}
+	delete(d.pending, path)
+
+	if d.queued[path] {
+		return
+	}
+	select {
+	case d.queue <- path:
+		d.queued[path] = true
+	default:
+		// Cola llena: en vez de bloquear al watcher se hará una sincronización completa
+		d.overflow = true
+	}
+}
+
+// Tomar la próxima ruta de la cola (se bloquea hasta que haya una)
+func (d *debouncer) next() string {
+	path := <-d.queue
+	d.mu.Lock()
+	delete(d.queued, path)
+	d.mu.Unlock()
+	return path
+}
+
+// Indicar (y olvidar) si se descartaron rutas por tener la cola llena
+func (d *debouncer) takeOverflow() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	overflow := d.overflow
+	d.overflow = false
+	return overflow
+}
+
+// Pasar las rutas que entrega el debouncer a la cola persistente y sincronizarlas en orden
+// (sin conexión solo se acumulan hasta que vuelva el servidor)
+func (e *syncEngine) runWatchWorker(d *debouncer) {
+	// Reconciliación inicial: lo que cambió en ambos lados mientras el cliente no estaba observando
+	// (incluye los cambios que quedaron en la cola de una ejecución anterior). Sin conexión, queda
+	// pendiente hasta que vuelva el servidor.
+	log.Printf("[INFO] (%s) Reconciliando %s con el servidor antes de observar cambios", time.Now().Format("15:04:05"), e.root)
+	if err := e.pending.setFull(true); err != nil {
+		log.Printf("[ERROR] No se pudo guardar la cola de cambios: %v", err)
+	}
+	e.drainPending()
+
+	for {
+		path := d.next()
+		if err := e.pending.add(path); err != nil {
+			log.Printf("[ERROR] No se pudo guardar la cola de cambios: %v", err)
+		}
+		if d.takeOverflow() {
+			log.Printf("[INFO] (%s) Demasiados cambios pendientes, se sincronizará la carpeta completa", time.Now().Format("15:04:05"))
+			if err := e.pending.setFull(true); err != nil {
+				log.Printf("[ERROR] No se pudo guardar la cola de cambios: %v", err)
+			}
+		}
+
+		if !e.isOfflineMode() {
+			e.drainPending()
+		}
+	}
+}
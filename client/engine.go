@@ -0,0 +1,829 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	pb "github.com/FelipeMarchantVargas/sync-service/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Prefijo de los archivos temporales que el cliente usa al escribir descargas
+const tempFilePrefix = ".sync-tmp-"
+
+// Clave de la metadata gRPC con el identificador del dispositivo (el servidor no le reenvía sus propios cambios)
+const deviceMetadataKey = "device-id"
+
+// Tiempo durante el que se reconocen los eventos del watcher causados por una escritura propia
+const ownWriteTTL = 10 * time.Second
+
+// Acciones que puede decidir el motor para una ruta
+const (
+	actionUpload       = "upload"        // Subir la versión local
+	actionDownload     = "download"      // Descargar la versión remota
+	actionDeleteLocal  = "delete-local"  // Borrar el archivo local (se borró en el servidor)
+	actionDeleteRemote = "delete-remote" // Borrar el archivo remoto (se borró localmente)
+	actionRecord       = "record"        // Ambos lados ya coinciden: solo actualizar el estado
+	actionForget       = "forget"        // Se borró en ambos lados: olvidar la ruta
+	actionConflict     = "conflict"      // Ambos lados cambiaron de forma distinta
+	actionMove         = "move"          // Se movió localmente: mover en el servidor sin volver a subir
+	actionMoveLocal    = "move-local"    // Se movió en el servidor: renombrar localmente sin descargar
+)
+
+// Estado actual de un archivo local
+type localFile struct {
+	Hash       string
+	Size       int64
+	ModTime    int64  // UnixNano
+	Mode       uint32 // Permisos (0 en los enlaces)
+	LinkTarget string // Enlace simbólico: destino
+}
+
+// Acción a aplicar sobre una ruta
+type syncAction struct {
+	Kind   string
+	Path   string
+	From   string // Movimientos: ruta anterior
+	Local  *localFile
+	Remote *pb.FileInfo
+}
+
+// Resultado en el disco de una escritura o borrado hecho por el propio motor
+type ownWrite struct {
+	Deleted bool
+	Size    int64
+	ModTime int64 // UnixNano
+	At      time.Time
+}
+
+// Motor de sincronización bidireccional entre una carpeta local y el espacio del usuario en el servidor
+type syncEngine struct {
+	root   string
+	client pb.SyncServiceClient
+	tokens *tokenSource // Credenciales que la conexión adjunta a cada llamada
+	ctx    context.Context
+	cancel context.CancelFunc // Detiene el motor (ver stop)
+
+	mu        sync.Mutex // Serializa la aplicación de cambios y el acceso al estado
+	state     *syncState
+	ownWrites map[string]ownWrite // Para no tratar como cambios locales los archivos que escribe el motor
+
+	hintsMu sync.Mutex // Protege hints (lo actualiza el watcher sin esperar a e.mu)
+	hints   moveHints
+
+	ignore *ignoreMatcher
+
+	pending *pendingQueue // Cambios locales que esperan a sincronizarse
+	drainMu sync.Mutex    // Serializa la aplicación de la cola
+
+	connMu  sync.Mutex    // Protege offline, online y stopErr
+	offline bool          // No hay conexión con el servidor: los cambios se acumulan en la cola
+	online  chan struct{} // Se cierra al recuperar la conexión
+	stopErr error         // Motivo por el que se detuvo el motor (nil si sigue corriendo)
+}
+
+// Crear el motor para una carpeta, cargando su estado local. client debe estar conectado con tokens como
+// credenciales por llamada.
+func newSyncEngine(root string, client pb.SyncServiceClient, tokens *tokenSource) (*syncEngine, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	state, err := loadState(root)
+	if err != nil {
+		return nil, fmt.Errorf("no se pudo cargar el estado de sincronización: %v", err)
+	}
+
+	// Cada carpeta sincronizada es un dispositivo distinto para el servidor
+	if state.Device == "" {
+		if state.Device, err = newUploadID(); err != nil {
+			return nil, err
+		}
+		if err := state.save(root); err != nil {
+			return nil, fmt.Errorf("no se pudo guardar el estado de sincronización: %v", err)
+		}
+	}
+	ctx, cancel := context.WithCancel(metadata.AppendToOutgoingContext(context.Background(), deviceMetadataKey, state.Device))
+
+	pending, err := loadPendingQueue(root)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("no se pudo cargar la cola de cambios pendientes: %v", err)
+	}
+
+	return &syncEngine{
+		root:      root,
+		client:    client,
+		tokens:    tokens,
+		ctx:       ctx,
+		cancel:    cancel,
+		state:     state,
+		ownWrites: make(map[string]ownWrite),
+		hints:     moveHints{renamed: make(map[string]time.Time), created: make(map[string]time.Time)},
+		ignore:    newIgnoreMatcher(root),
+		pending:   pending,
+	}, nil
+}
+
+// ------------------------- ESTADO LOCAL Y REMOTO --------------------------------
+
+// Convertir una ruta del disco a la ruta relativa usada en el servidor
+func (e *syncEngine) relPath(localPath string) (string, bool) {
+	rel, err := filepath.Rel(e.root, localPath)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+func (e *syncEngine) localPath(path string) string {
+	return filepath.Join(e.root, filepath.FromSlash(path))
+}
+
+// Indicar si una ruta es interna del cliente y no debe sincronizarse
+// (los tokens y el log del cliente no pueden reincluirse con "!" en .syncignore)
+func isInternalPath(path string) bool {
+	first := strings.SplitN(path, "/", 2)[0]
+	if first == stateDirName || path == credentialsFileName || path == logFileName {
+		return true
+	}
+	return strings.HasPrefix(filepath.Base(path), tempFilePrefix)
+}
+
+// Indicar si una ruta queda fuera de la sincronización (interna del cliente, fuera de la selección, ignorada
+// por patrones o un enlace simbólico que no se sincroniza)
+func (e *syncEngine) skipPath(path string, isDir bool) bool {
+	return isInternalPath(path) || !e.state.selected(path, isDir) || e.ignore.Ignored(path, isDir) || e.skipLink(path)
+}
+
+// SHA-256 de un contenido (hex)
+func hashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// SHA-256 de un archivo local (hex)
+func hashFile(localPath string) (string, error) {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// Obtener el estado de un archivo local (nil si no existe). Reutiliza el hash guardado si el archivo no cambió.
+// El hash de un enlace simbólico es el de su destino.
+func (e *syncEngine) statLocal(path string) (*localFile, error) {
+	info, target, err := e.syncedInfo(path)
+	if err != nil || info == nil {
+		return nil, err
+	}
+	if target != "" {
+		return &localFile{Hash: hashBytes([]byte(target)), Size: int64(len(target)), ModTime: info.ModTime().UnixNano(), LinkTarget: target}, nil
+	}
+
+	local := &localFile{Size: info.Size(), ModTime: info.ModTime().UnixNano(), Mode: uint32(info.Mode().Perm())}
+	if base, ok := e.state.Files[path]; ok && base.Size == local.Size && base.ModTime == local.ModTime {
+		local.Hash = base.Hash
+		return local, nil
+	}
+
+	local.Hash, err = hashFile(e.localPath(path))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return local, err
+}
+
+// Recorrer la carpeta local y obtener el estado de cada archivo
+func (e *syncEngine) scanLocal() (map[string]*localFile, error) {
+	files := make(map[string]*localFile)
+	err := filepath.WalkDir(e.root, func(localPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		path, ok := e.relPath(localPath)
+		if !ok {
+			return nil
+		}
+		if e.skipPath(path, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !(d.Type().IsRegular() || d.Type()&fs.ModeSymlink != 0) {
+			return nil
+		}
+
+		local, err := e.statLocal(path)
+		if err != nil {
+			return err
+		}
+		if local != nil {
+			files[path] = local
+		}
+		return nil
+	})
+	return files, err
+}
+
+// Obtener la lista de archivos del servidor y la secuencia del journal al momento de listar
+func (e *syncEngine) listRemote() (map[string]*pb.FileInfo, int64, error) {
+	resp, err := e.client.ListFiles(e.ctx, &pb.Empty{})
+	if err != nil {
+		return nil, 0, err
+	}
+	files := make(map[string]*pb.FileInfo)
+	for _, info := range resp.Files {
+		files[info.Filename] = info
+	}
+	return files, resp.Latest, nil
+}
+
+// Obtener el estado remoto actual de una ruta (nil si no existe)
+func (e *syncEngine) statRemote(path string) (*pb.FileInfo, error) {
+	info, err := e.client.StatFile(e.ctx, &pb.FileRequest{Filename: path})
+	if status.Code(err) == codes.NotFound {
+		return nil, nil
+	}
+	return info, err
+}
+
+// ------------------------- DIFERENCIA A TRES BANDAS --------------------------------
+
+// Decidir qué hacer con una ruta comparando el estado local, el último sincronizado (base) y el remoto
+func decide(path string, local *localFile, base *fileState, remote *pb.FileInfo) syncAction {
+	action := syncAction{Path: path, Local: local, Remote: remote}
+
+	// Sin base: la ruta nunca se sincronizó
+	if base == nil {
+		switch {
+		case local == nil && remote == nil:
+			action.Kind = ""
+		case remote == nil:
+			action.Kind = actionUpload
+		case local == nil:
+			action.Kind = actionDownload
+		case local.Hash == remote.Hash:
+			action.Kind = actionRecord
+		default:
+			action.Kind = actionConflict
+		}
+		return action
+	}
+
+	// Un cambio de permisos (chmod) sin cambio de contenido también se sube
+	localChanged := local != nil && (local.Hash != base.Hash || (base.Mode != 0 && local.Mode != 0 && local.Mode != base.Mode))
+	remoteChanged := remote != nil && remote.Version != base.ServerVersion
+
+	switch {
+	case local == nil && remote == nil:
+		action.Kind = actionForget
+	case local == nil && remoteChanged:
+		// Una modificación remota gana sobre un borrado local
+		action.Kind = actionDownload
+	case local == nil:
+		action.Kind = actionDeleteRemote
+	case remote == nil && localChanged:
+		// Una modificación local gana sobre un borrado remoto
+		action.Kind = actionUpload
+	case remote == nil:
+		action.Kind = actionDeleteLocal
+	case localChanged && remoteChanged:
+		if local.Hash == remote.Hash {
+			action.Kind = actionRecord
+		} else {
+			action.Kind = actionConflict
+		}
+	case localChanged:
+		action.Kind = actionUpload
+	case remoteChanged:
+		action.Kind = actionDownload
+	default:
+		// Sin cambios; se actualiza el mtime guardado si solo cambió la fecha del archivo
+		if local.ModTime != base.ModTime || local.Size != base.Size {
+			action.Kind = actionRecord
+		}
+	}
+	return action
+}
+
+// Calcular el plan completo comparando la carpeta local con el servidor
+func (e *syncEngine) plan(local map[string]*localFile, remote map[string]*pb.FileInfo) []syncAction {
+	paths := make(map[string]bool)
+	for path := range local {
+		paths[path] = true
+	}
+	for path := range remote {
+		paths[path] = true
+	}
+	for path := range e.state.Files {
+		paths[path] = true
+	}
+
+	sorted := make([]string, 0, len(paths))
+	for path := range paths {
+		if !e.skipPath(path, false) {
+			sorted = append(sorted, path)
+		}
+	}
+	sort.Strings(sorted)
+
+	var actions []syncAction
+	for _, path := range sorted {
+		if r := remote[path]; r != nil && local[path] == nil && e.skipRemoteLink(path, r.LinkTarget) {
+			continue
+		}
+		action := decide(path, local[path], e.state.Files[path], remote[path])
+		if action.Kind != "" {
+			actions = append(actions, action)
+		}
+	}
+	return e.pairMoves(actions)
+}
+
+// Recorrer la carpeta local y el listado del servidor y calcular el plan completo,
+// junto con la secuencia del journal al momento de listar (debe llamarse con e.mu tomado)
+func (e *syncEngine) planAll() ([]syncAction, int64, error) {
+	local, err := e.scanLocal()
+	if err != nil {
+		return nil, 0, fmt.Errorf("no se pudo recorrer la carpeta local: %v", err)
+	}
+	remote, latest, err := e.listRemote()
+	if err != nil {
+		return nil, 0, fmt.Errorf("no se pudo obtener la lista de archivos del servidor: %w", err)
+	}
+	return e.plan(local, remote), latest, nil
+}
+
+// Mostrar lo que haría una sincronización completa sin aplicar nada
+func (e *syncEngine) printPlan() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	evicted := e.deselectedPaths()
+	actions, _, err := e.planAll()
+	if err != nil {
+		return err
+	}
+	if len(evicted) == 0 && len(actions) == 0 {
+		fmt.Printf("%s ya está sincronizada con el servidor\n", e.root)
+		return nil
+	}
+
+	fmt.Printf("Plan de sincronización de %s (%d acciones):\n", e.root, len(evicted)+len(actions))
+	for _, path := range evicted {
+		fmt.Printf("  %-13s %s (fuera de la selección)\n", actionDeleteLocal, path)
+	}
+	for _, action := range actions {
+		switch action.Kind {
+		case actionMove, actionMoveLocal:
+			fmt.Printf("  %-13s %s -> %s\n", action.Kind, action.From, action.Path)
+		default:
+			fmt.Printf("  %-13s %s\n", action.Kind, action.Path)
+		}
+	}
+	return nil
+}
+
+// ------------------------- APLICACIÓN DE CAMBIOS --------------------------------
+
+// Sincronizar toda la carpeta con el servidor en una pasada
+func (e *syncEngine) syncAll() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.evictDeselected()
+	actions, latest, err := e.planAll()
+	if err != nil {
+		return err
+	}
+	log.Printf("[INFO] Sincronización completa de %s: %d acciones", e.root, len(actions))
+
+	failed := 0
+	var offlineErr error
+	for _, action := range actions {
+		if err := e.applyChecked(action); err != nil {
+			log.Printf("[ERROR] %s %s: %v", action.Kind, action.Path, err)
+			failed++
+			if isOffline(err) {
+				offlineErr = err
+				break
+			}
+		}
+	}
+
+	// Solo se avanza el cursor si todo quedó aplicado; si no, los cambios se reintentan al reconectar
+	if failed == 0 && latest > e.state.Cursor {
+		e.state.Cursor = latest
+	}
+	if err := e.state.save(e.root); err != nil {
+		return fmt.Errorf("no se pudo guardar el estado de sincronización: %v", err)
+	}
+	if offlineErr != nil {
+		return fmt.Errorf("se perdió la conexión con el servidor: %w", offlineErr)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d acciones fallaron", failed)
+	}
+	return nil
+}
+
+// Sincronizar una sola ruta consultando su estado actual en ambos lados
+func (e *syncEngine) syncPath(path string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.syncPathLocked(path)
+}
+
+// Sincronizar una ruta tras un evento del watcher, salvo que el evento lo haya causado el propio motor
+func (e *syncEngine) syncLocalChange(path string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.isOwnWrite(path) {
+		return nil
+	}
+	log.Printf("[INFO] (%s) Detectado cambio local: %s", time.Now().Format("15:04:05"), path)
+	return e.syncPathLocked(path)
+}
+
+func (e *syncEngine) syncPathLocked(path string) error {
+	// Las rutas ignoradas no se suben ni se descargan
+	if e.skipPath(path, false) {
+		return nil
+	}
+
+	local, err := e.statLocal(path)
+	if err != nil {
+		return err
+	}
+	remote, err := e.statRemote(path)
+	if err != nil {
+		return err
+	}
+	if remote != nil && local == nil && e.skipRemoteLink(path, remote.LinkTarget) {
+		return nil
+	}
+
+	action := e.detectMove(decide(path, local, e.state.Files[path], remote))
+	if action.Kind == "" {
+		return nil
+	}
+	if err := e.applyChecked(action); err != nil {
+		return err
+	}
+	return e.state.save(e.root)
+}
+
+// Aplicar una acción; si el servidor la rechaza porque otro dispositivo escribió antes,
+// se vuelve a decidir con el estado remoto actual (debe llamarse con e.mu tomado)
+func (e *syncEngine) applyChecked(action syncAction) error {
+	for attempt := 0; ; attempt++ {
+		err := e.apply(action)
+		if !isConflict(err) || attempt == maxConflictRetries {
+			return err
+		}
+		log.Printf("[INFO] (%s) %s cambió en el servidor mientras se sincronizaba, se vuelve a comparar", time.Now().Format("15:04:05"), action.Path)
+
+		local, err := e.statLocal(action.Path)
+		if err != nil {
+			return err
+		}
+		remote, err := e.statRemote(action.Path)
+		if err != nil {
+			return err
+		}
+		action = decide(action.Path, local, e.state.Files[action.Path], remote)
+		if action.Kind == "" {
+			return nil
+		}
+	}
+}
+
+// Aplicar una acción y actualizar el estado (debe llamarse con e.mu tomado)
+func (e *syncEngine) apply(action syncAction) error {
+	switch action.Kind {
+	case actionUpload:
+		return e.applyUpload(action)
+	case actionDownload:
+		return e.applyDownload(action)
+	case actionDeleteRemote:
+		return e.applyDeleteRemote(action)
+	case actionDeleteLocal:
+		return e.applyDeleteLocal(action)
+	case actionMove:
+		return e.applyMove(action)
+	case actionMoveLocal:
+		return e.applyMoveLocal(action)
+	case actionRecord:
+		e.state.Files[action.Path] = &fileState{
+			Hash:          action.Local.Hash,
+			Size:          action.Local.Size,
+			ModTime:       action.Local.ModTime,
+			ServerVersion: action.Remote.Version,
+			Mode:          action.Local.Mode,
+		}
+		return nil
+	case actionForget:
+		delete(e.state.Files, action.Path)
+		return nil
+	case actionConflict:
+		return e.resolveConflict(action)
+	}
+	return fmt.Errorf("acción desconocida: %s", action.Kind)
+}
+
+func (e *syncEngine) applyUpload(action syncAction) error {
+	data, attrs, err := e.readLocal(action.Path)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[INFO] (%s) Subiendo %s (%d KB)", time.Now().Format("15:04:05"), action.Path, len(data)/1024)
+	resp, err := pushData(e.client, action.Path, data, baseVersion(action), attrs, e.ctx)
+	if err != nil {
+		return err
+	}
+
+	e.state.Files[action.Path] = &fileState{
+		Hash:          hashBytes(data),
+		Size:          int64(len(data)),
+		ModTime:       attrs.MTime,
+		ServerVersion: resp.Version,
+		Mode:          attrs.Mode,
+	}
+	log.Printf("[SUCCESS] (%s) %s subido como versión %d", time.Now().Format("15:04:05"), action.Path, resp.Version)
+	return nil
+}
+
+func (e *syncEngine) applyDownload(action syncAction) error {
+	log.Printf("[INFO] (%s) Descargando %s...", time.Now().Format("15:04:05"), action.Path)
+	data, version, attrs, err := fetchFile(e.client, action.Path, e.ctx)
+	if err != nil {
+		return err
+	}
+	if e.skipRemoteLink(action.Path, attrs.LinkTarget) {
+		log.Printf("[INFO] (%s) %s es un enlace hacia fuera de la carpeta (%s), no se crea", time.Now().Format("15:04:05"), action.Path, attrs.LinkTarget)
+		return nil
+	}
+
+	// No pisar un archivo local que cambió mientras se descargaba
+	if err := e.checkLocalUnchanged(action); err != nil {
+		return err
+	}
+
+	if err := e.recordLocal(action.Path, data, version, attrs); err != nil {
+		return err
+	}
+	log.Printf("[SUCCESS] (%s) %s descargado (versión %d)", time.Now().Format("15:04:05"), action.Path, version)
+	return nil
+}
+
+func (e *syncEngine) applyDeleteRemote(action syncAction) error {
+	log.Printf("[INFO] (%s) Eliminando %s del servidor...", time.Now().Format("15:04:05"), action.Path)
+	_, err := e.client.DeleteFile(e.ctx, &pb.FileRequest{Filename: action.Path, BaseVersion: baseVersion(action)})
+	if err != nil && status.Code(err) != codes.NotFound {
+		return err
+	}
+	delete(e.state.Files, action.Path)
+	return nil
+}
+
+func (e *syncEngine) applyDeleteLocal(action syncAction) error {
+	if err := e.checkLocalUnchanged(action); err != nil {
+		return err
+	}
+
+	log.Printf("[INFO] (%s) Eliminando %s localmente (se borró en el servidor)", time.Now().Format("15:04:05"), action.Path)
+	localPath := e.localPath(action.Path)
+	if err := os.Remove(localPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	e.noteOwnWrite(action.Path)
+	e.removeEmptyParents(filepath.Dir(localPath))
+	delete(e.state.Files, action.Path)
+	return nil
+}
+
+// Escribir un archivo de la carpeta sincronizada con sus atributos, recordando que el cambio es propio
+func (e *syncEngine) writeLocal(path string, data []byte, attrs fileAttrs) error {
+	if err := e.checkNoLinkedParents(path); err != nil {
+		return err
+	}
+	localPath := e.localPath(path)
+	if attrs.LinkTarget == "" {
+		localPath = e.writeTarget(path)
+	}
+	if err := writeLocalFile(localPath, data, attrs); err != nil {
+		return err
+	}
+	e.noteOwnWrite(path)
+	return nil
+}
+
+// Recordar cómo quedó en el disco una ruta que acaba de escribir o borrar el motor (debe llamarse con e.mu tomado)
+func (e *syncEngine) noteOwnWrite(path string) {
+	now := time.Now()
+	for p, w := range e.ownWrites {
+		if now.Sub(w.At) > ownWriteTTL {
+			delete(e.ownWrites, p)
+		}
+	}
+
+	w := ownWrite{At: now}
+	info, err := os.Lstat(e.localPath(path))
+	if err != nil {
+		w.Deleted = true
+	} else {
+		w.Size, w.ModTime = info.Size(), info.ModTime().UnixNano()
+	}
+	e.ownWrites[path] = w
+}
+
+// Indicar si una ruta sigue como la dejó el propio motor (debe llamarse con e.mu tomado)
+func (e *syncEngine) isOwnWrite(path string) bool {
+	w, ok := e.ownWrites[path]
+	if !ok {
+		return false
+	}
+	info, err := os.Lstat(e.localPath(path))
+	if w.Deleted && os.IsNotExist(err) {
+		return true
+	}
+	if !w.Deleted && err == nil && info.Size() == w.Size && info.ModTime().UnixNano() == w.ModTime {
+		return true
+	}
+
+	// El archivo cambió después: es un cambio del usuario
+	delete(e.ownWrites, path)
+	return false
+}
+
+// Registrar que el archivo local quedó sincronizado con una versión del servidor
+func (e *syncEngine) recordState(path string, data []byte, version int64) error {
+	info, target, err := e.syncedInfo(path)
+	if err != nil {
+		return err
+	}
+	if info == nil {
+		return os.ErrNotExist
+	}
+	state := &fileState{
+		Hash:          hashBytes(data),
+		Size:          int64(len(data)),
+		ModTime:       info.ModTime().UnixNano(),
+		ServerVersion: version,
+	}
+	if target == "" {
+		state.Mode = uint32(info.Mode().Perm())
+	}
+	e.state.Files[path] = state
+	return nil
+}
+
+// Verificar que el archivo local sigue como estaba al decidir la acción
+func (e *syncEngine) checkLocalUnchanged(action syncAction) error {
+	info, _, err := e.syncedInfo(action.Path)
+	if err != nil {
+		return err
+	}
+	if info == nil && action.Local == nil {
+		return nil
+	}
+	if info == nil {
+		return fmt.Errorf("el archivo local desapareció durante la sincronización")
+	}
+	if action.Local == nil || info.Size() != action.Local.Size || info.ModTime().UnixNano() != action.Local.ModTime {
+		return fmt.Errorf("el archivo local cambió durante la sincronización")
+	}
+	return nil
+}
+
+// Borrar los directorios que quedaron vacíos hasta la raíz
+func (e *syncEngine) removeEmptyParents(dir string) {
+	for dir != e.root && strings.HasPrefix(dir, e.root) {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// Escribir un archivo local de forma atómica (temporal en el mismo directorio + rename), restaurando
+// sus permisos y su mtime. Si es un enlace simbólico se crea el enlace en vez del archivo.
+func writeLocalFile(localPath string, data []byte, attrs fileAttrs) error {
+	if err := os.MkdirAll(filepath.Dir(localPath), os.ModePerm); err != nil {
+		return err
+	}
+
+	if attrs.LinkTarget != "" {
+		return writeLocalLink(localPath, attrs.LinkTarget)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(localPath), tempFilePrefix+"*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	mode := os.FileMode(attrs.Mode & 0777)
+	if mode == 0 {
+		mode = 0644
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	if attrs.MTime != 0 {
+		mtime := time.Unix(0, attrs.MTime)
+		if err := os.Chtimes(tmp.Name(), mtime, mtime); err != nil {
+			return err
+		}
+	}
+	return os.Rename(tmp.Name(), localPath)
+}
+
+// Crear (o reemplazar) un enlace simbólico de forma atómica
+func writeLocalLink(localPath, target string) error {
+	tmpName := filepath.Join(filepath.Dir(localPath), tempFilePrefix+filepath.Base(localPath)+".link")
+	os.Remove(tmpName)
+	if err := os.Symlink(target, tmpName); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpName, localPath); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	return nil
+}
+
+// Registrar que se aplicó un cambio del servidor
+func (e *syncEngine) advanceCursor(sequence int64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if sequence > e.state.Cursor {
+		e.state.Cursor = sequence
+		if err := e.state.save(e.root); err != nil {
+			log.Printf("[ERROR] No se pudo guardar el estado de sincronización: %v", err)
+		}
+	}
+}
+
+// Último cambio del servidor aplicado
+func (e *syncEngine) cursor() int64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.state.Cursor
+}
+
+// Versión del servidor con la que está sincronizada una ruta (0 si no está sincronizada)
+func (e *syncEngine) syncedVersion(path string) int64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if base, ok := e.state.Files[path]; ok {
+		return base.ServerVersion
+	}
+	return 0
+}
+
+// Rutas sincronizadas dentro de un directorio (para borrados o renombres de carpetas enteras)
+func (e *syncEngine) trackedUnder(dir string) []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var paths []string
+	for path := range e.state.Files {
+		if strings.HasPrefix(path, dir+"/") {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+
+	pb "github.com/FelipeMarchantVargas/sync-service/proto"
+)
+
+func TestDecide(t *testing.T) {
+	base := &fileState{Hash: "h1", Size: 10, ModTime: 100, ServerVersion: 3, Mode: 0644}
+	same := &localFile{Hash: "h1", Size: 10, ModTime: 100, Mode: 0644}
+	edited := &localFile{Hash: "h2", Size: 12, ModTime: 200, Mode: 0644}
+	touched := &localFile{Hash: "h1", Size: 10, ModTime: 300, Mode: 0644}
+	chmodded := &localFile{Hash: "h1", Size: 10, ModTime: 100, Mode: 0755}
+	remoteSame := &pb.FileInfo{Hash: "h1", Version: 3}
+	remoteEdited := &pb.FileInfo{Hash: "h3", Version: 4}
+	remoteLikeLocal := &pb.FileInfo{Hash: "h2", Version: 4}
+
+	tests := []struct {
+		name   string
+		local  *localFile
+		base   *fileState
+		remote *pb.FileInfo
+		want   string
+	}{
+		// Rutas nunca sincronizadas
+		{"nada en ningún lado", nil, nil, nil, ""},
+		{"nuevo local", edited, nil, nil, actionUpload},
+		{"nuevo remoto", nil, nil, remoteEdited, actionDownload},
+		{"nuevo igual en ambos lados", edited, nil, remoteLikeLocal, actionRecord},
+		{"nuevo distinto en ambos lados", edited, nil, remoteEdited, actionConflict},
+
+		// Rutas ya sincronizadas
+		{"sin cambios", same, base, remoteSame, ""},
+		{"solo cambió el mtime", touched, base, remoteSame, actionRecord},
+		{"cambio local", edited, base, remoteSame, actionUpload},
+		{"cambio de permisos", chmodded, base, remoteSame, actionUpload},
+		{"cambio remoto", same, base, remoteEdited, actionDownload},
+		{"el mismo cambio en ambos lados", edited, base, remoteLikeLocal, actionRecord},
+		{"cambios distintos en ambos lados", edited, base, remoteEdited, actionConflict},
+
+		// Borrados (la base queda como lápida del lado que ya no tiene el archivo)
+		{"borrado en ambos lados", nil, base, nil, actionForget},
+		{"borrado local", nil, base, remoteSame, actionDeleteRemote},
+		{"borrado local y cambio remoto", nil, base, remoteEdited, actionDownload},
+		{"borrado remoto", same, base, nil, actionDeleteLocal},
+		{"borrado remoto y cambio local", edited, base, nil, actionUpload},
+	}
+	for _, tt := range tests {
+		got := decide("doc.txt", tt.local, tt.base, tt.remote)
+		if got.Kind != tt.want {
+			t.Errorf("%s: acción %q, se esperaba %q", tt.name, got.Kind, tt.want)
+		}
+	}
+}
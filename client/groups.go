@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	pb "github.com/FelipeMarchantVargas/sync-service/proto"
+	"github.com/urfave/cli"
+	"google.golang.org/grpc"
+)
+
+// ------------------------- GRUPOS --------------------------------
+
+// Conectarse al servidor y ejecutar fn con el cliente del servicio de grupos
+func withGroupClient(fn func(client pb.GroupServiceClient, ctx context.Context) error) error {
+	conn, err := grpc.Dial("localhost:50051", grpc.WithInsecure())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	authClient := pb.NewAuthServiceClient(conn)
+	ctx, err := getAuthContext(authClient)
+	if err != nil {
+		return err
+	}
+	return fn(pb.NewGroupServiceClient(conn), ctx)
+}
+
+// Mostrar un grupo con sus miembros, su uso y su cuota
+func printGroup(group *pb.Group) {
+	quota := "sin límite"
+	if group.Quota > 0 {
+		quota = fmt.Sprintf("%d bytes", group.Quota)
+	}
+	fmt.Printf("team:%s\t%d bytes usados\tcuota: %s\n", group.Name, group.Usage, quota)
+	for _, member := range group.Members {
+		fmt.Printf("  %s\t%s\n", member.Username, member.Role)
+	}
+}
+
+// Crear un grupo con el usuario actual como dueño
+func createGroup(client pb.GroupServiceClient, name string, ctx context.Context) error {
+	group, err := client.CreateGroup(ctx, &pb.GroupRequest{Name: name})
+	if err != nil {
+		log.Printf("[ERROR] No se pudo crear el grupo %s: %v", name, err)
+		return err
+	}
+	log.Printf("[SUCCESS] (%s) Grupo %s creado", time.Now().Format("15:04:05"), name)
+	printGroup(group)
+	return nil
+}
+
+// Agregar un miembro a un grupo o cambiar su rol
+func addGroupMember(client pb.GroupServiceClient, name, username, role string, ctx context.Context) error {
+	group, err := client.AddMember(ctx, &pb.MemberRequest{Group: name, Username: username, Role: role})
+	if err != nil {
+		log.Printf("[ERROR] No se pudo agregar a %s al grupo %s: %v", username, name, err)
+		return err
+	}
+	log.Printf("[SUCCESS] (%s) %s agregado al grupo %s (%s)", time.Now().Format("15:04:05"), username, name, role)
+	printGroup(group)
+	return nil
+}
+
+// Quitar un miembro de un grupo
+func removeGroupMember(client pb.GroupServiceClient, name, username string, ctx context.Context) error {
+	group, err := client.RemoveMember(ctx, &pb.MemberRequest{Group: name, Username: username})
+	if err != nil {
+		log.Printf("[ERROR] No se pudo quitar a %s del grupo %s: %v", username, name, err)
+		return err
+	}
+	log.Printf("[SUCCESS] (%s) %s ya no es miembro del grupo %s", time.Now().Format("15:04:05"), username, name)
+	printGroup(group)
+	return nil
+}
+
+// Listar los grupos de los que el usuario es miembro
+func listGroups(client pb.GroupServiceClient, ctx context.Context) error {
+	resp, err := client.ListGroups(ctx, &pb.Empty{})
+	if err != nil {
+		log.Printf("[ERROR] No se pudo obtener la lista de grupos: %v", err)
+		return err
+	}
+	if len(resp.Groups) == 0 {
+		fmt.Println("No eres miembro de ningún grupo")
+		return nil
+	}
+	for _, group := range resp.Groups {
+		printGroup(group)
+	}
+	return nil
+}
+
+// Subcomandos de "group"
+var groupCommands = []cli.Command{
+	{
+		Name:      "create",
+		Usage:     "Crear un grupo (quedas como su dueño)",
+		ArgsUsage: "<grupo>",
+		Action: func(c *cli.Context) error {
+			if c.NArg() < 1 {
+				return fmt.Errorf("debes proporcionar el nombre del grupo")
+			}
+			return withGroupClient(func(client pb.GroupServiceClient, ctx context.Context) error {
+				return createGroup(client, c.Args().First(), ctx)
+			})
+		},
+	}, {
+		Name:      "add",
+		Usage:     "Agregar un miembro al grupo o cambiar su rol",
+		ArgsUsage: "<grupo> <usuario>",
+		Flags: []cli.Flag{
+			cli.StringFlag{Name: "role", Value: "member", Usage: "Rol del miembro: owner, member o viewer (solo lectura)"},
+		},
+		Action: func(c *cli.Context) error {
+			if c.NArg() < 2 {
+				return fmt.Errorf("debes proporcionar el grupo y el usuario")
+			}
+			return withGroupClient(func(client pb.GroupServiceClient, ctx context.Context) error {
+				return addGroupMember(client, c.Args().Get(0), c.Args().Get(1), c.String("role"), ctx)
+			})
+		},
+	}, {
+		Name:      "remove",
+		Usage:     "Quitar un miembro del grupo (o salir de él indicando tu propio usuario)",
+		ArgsUsage: "<grupo> <usuario>",
+		Action: func(c *cli.Context) error {
+			if c.NArg() < 2 {
+				return fmt.Errorf("debes proporcionar el grupo y el usuario")
+			}
+			return withGroupClient(func(client pb.GroupServiceClient, ctx context.Context) error {
+				return removeGroupMember(client, c.Args().Get(0), c.Args().Get(1), ctx)
+			})
+		},
+	}, {
+		Name:  "list",
+		Usage: "Listar tus grupos con sus miembros y su uso",
+		Action: func(c *cli.Context) error {
+			return withGroupClient(func(client pb.GroupServiceClient, ctx context.Context) error {
+				return listGroups(client, ctx)
+			})
+		},
+	},
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ------------------------- PATRONES IGNORADOS --------------------------------
+
+// Archivo con patrones a ignorar (sintaxis de .gitignore), en cualquier carpeta sincronizada
+const ignoreFileName = ".syncignore"
+
+// Patrones que se ignoran siempre, antes de los del usuario (que pueden reincluirlos con "!")
+var defaultIgnorePatterns = []string{
+	".git/", ".hg/", ".svn/",
+	"*.swp", "*.swo", "*.swx", "*~", ".#*", "#*#", "4913",
+	".DS_Store", "Thumbs.db", "desktop.ini",
+	"credentials.json", "client.log",
+}
+
+// Un patrón de un archivo de ignorados
+type ignoreRule struct {
+	base     string   // Carpeta del .syncignore que lo define ("" = raíz)
+	segments []string // Patrón separado por "/"
+	negate   bool     // "!patrón": vuelve a incluir
+	dirOnly  bool     // "patrón/": solo carpetas
+	anchored bool     // Contiene "/": relativo a base; si no, se compara con el nombre a cualquier profundidad
+}
+
+// Leer las reglas de un archivo de ignorados definido en la carpeta base
+func parseIgnoreRules(base string, lines []string) []ignoreRule {
+	var rules []ignoreRule
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		rule := ignoreRule{base: base}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\`) {
+			line = line[1:] // "\#" o "\!" al principio
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			rule.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		rule.segments = strings.Split(line, "/")
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// Indicar si la regla coincide con una ruta relativa a la raíz
+func (r ignoreRule) match(p string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	if r.base != "" {
+		if !strings.HasPrefix(p, r.base+"/") {
+			return false
+		}
+		p = p[len(r.base)+1:]
+	}
+
+	parts := strings.Split(p, "/")
+	if !r.anchored {
+		ok, _ := path.Match(r.segments[0], parts[len(parts)-1])
+		return ok
+	}
+	return matchSegments(r.segments, parts)
+}
+
+// Comparar un patrón por segmentos, donde "**" equivale a cualquier cantidad de carpetas
+func matchSegments(pattern, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			pattern = pattern[1:]
+			if len(pattern) == 0 {
+				return len(parts) > 0 // "dir/**" coincide con todo lo de adentro, no con dir
+			}
+			for i := 0; i <= len(parts); i++ {
+				if matchSegments(pattern, parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], parts[0]); !ok {
+			return false
+		}
+		pattern, parts = pattern[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
+
+// Archivo de ignorados leído del disco (se vuelve a leer si cambia)
+type ignoreFile struct {
+	size    int64
+	modTime int64
+	rules   []ignoreRule
+}
+
+// Decide qué rutas de una carpeta sincronizada se ignoran: patrones por defecto, el archivo global
+// del usuario, .sync/ignore (solo de este dispositivo) y los .syncignore de cada carpeta, que se
+// sincronizan como cualquier archivo (los más profundos tienen prioridad; gana la última regla)
+type ignoreMatcher struct {
+	root       string
+	globalPath string
+	defaults   []ignoreRule
+
+	mu    sync.Mutex
+	files map[string]*ignoreFile // Por ruta en el disco
+}
+
+// Ruta del archivo de ignorados global del usuario
+func globalIgnorePath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "sync-service", "syncignore")
+}
+
+func newIgnoreMatcher(root string) *ignoreMatcher {
+	return &ignoreMatcher{
+		root:       root,
+		globalPath: globalIgnorePath(),
+		defaults:   parseIgnoreRules("", defaultIgnorePatterns),
+		files:      make(map[string]*ignoreFile),
+	}
+}
+
+// Reglas de un archivo de ignorados (vacías si no existe)
+func (m *ignoreMatcher) load(filePath, base string) []ignoreRule {
+	if filePath == "" {
+		return nil
+	}
+	info, err := os.Stat(filePath)
+	if err != nil {
+		delete(m.files, filePath)
+		return nil
+	}
+	if cached, ok := m.files[filePath]; ok && cached.size == info.Size() && cached.modTime == info.ModTime().UnixNano() {
+		return cached.rules
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil
+	}
+	rules := parseIgnoreRules(base, strings.Split(string(data), "\n"))
+	m.files[filePath] = &ignoreFile{size: info.Size(), modTime: info.ModTime().UnixNano(), rules: rules}
+	return rules
+}
+
+// Reglas que aplican a una ruta, en orden de prioridad creciente
+func (m *ignoreMatcher) rulesFor(p string) []ignoreRule {
+	rules := append([]ignoreRule{}, m.defaults...)
+	rules = append(rules, m.load(m.globalPath, "")...)
+	rules = append(rules, m.load(filepath.Join(m.root, stateDirName, "ignore"), "")...)
+	rules = append(rules, m.load(filepath.Join(m.root, ignoreFileName), "")...)
+
+	parts := strings.Split(p, "/")
+	for i := 1; i < len(parts); i++ {
+		dir := strings.Join(parts[:i], "/")
+		rules = append(rules, m.load(filepath.Join(m.root, filepath.FromSlash(dir), ignoreFileName), dir)...)
+	}
+	return rules
+}
+
+func (m *ignoreMatcher) matchOne(p string, isDir bool) bool {
+	ignored := false
+	for _, rule := range m.rulesFor(p) {
+		if rule.match(p, isDir) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+// Indicar si una ruta relativa (separada por "/") se ignora. Lo que está dentro de una carpeta ignorada
+// se ignora siempre, igual que en git.
+func (m *ignoreMatcher) Ignored(p string, isDir bool) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	parts := strings.Split(p, "/")
+	for i := 1; i < len(parts); i++ {
+		if m.matchOne(strings.Join(parts[:i], "/"), true) {
+			return true
+		}
+	}
+	return m.matchOne(p, isDir)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnoreMatcher(t *testing.T) {
+	root := t.TempDir()
+	write := func(name, content string) {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(ignoreFileName, "# comentario\n*.log\n!keep.log\n/build\ncache/\ndocs/**/*.tmp\nvendor/**\n")
+	write("sub/"+ignoreFileName, "/local.txt\n!*.log\n")
+
+	m := newIgnoreMatcher(root)
+	m.globalPath = "" // Sin el archivo global del usuario que corre la prueba
+
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		// Patrones por defecto
+		{".git/config", false, true},
+		{"credentials.json", false, true},
+		{"notas.txt", false, false},
+
+		// Un nombre sin "/" coincide a cualquier profundidad; "!" vuelve a incluir
+		{"app.log", false, true},
+		{"a/b/app.log", false, true},
+		{"keep.log", false, false},
+		{"a/keep.log", false, false},
+
+		// "/x" solo coincide en la carpeta del .syncignore, y lo de adentro se ignora con ella
+		{"build", true, true},
+		{"build/out.o", false, true},
+		{"src/build", true, false},
+
+		// "dir/" solo coincide con carpetas
+		{"cache", true, true},
+		{"cache", false, false},
+		{"src/cache/x.bin", false, true},
+
+		// "**" equivale a cualquier cantidad de carpetas, incluso ninguna
+		{"docs/x.tmp", false, true},
+		{"docs/a/b/x.tmp", false, true},
+		{"otros/x.tmp", false, false},
+		{"vendor", true, false},
+		{"vendor/lib/x.go", false, true},
+
+		// Un .syncignore más profundo tiene prioridad y sus patrones anclados son relativos a su carpeta
+		{"sub/local.txt", false, true},
+		{"local.txt", false, false},
+		{"sub/otra/local.txt", false, false},
+		{"sub/app.log", false, false},
+	}
+	for _, tt := range tests {
+		if got := m.Ignored(tt.path, tt.isDir); got != tt.want {
+			t.Errorf("Ignored(%q, carpeta=%v) = %v, se esperaba %v", tt.path, tt.isDir, got, tt.want)
+		}
+	}
+}
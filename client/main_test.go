@@ -0,0 +1,19 @@
+package main
+
+import (
+	"io"
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// init abre client.log en el directorio del paquete; las pruebas no escriben en él
+	if file, ok := log.Out.(*os.File); ok {
+		file.Close()
+		if info, err := os.Stat(logFileName); err == nil && info.Size() == 0 {
+			os.Remove(logFileName)
+		}
+	}
+	log.Out = io.Discard
+	os.Exit(m.Run())
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ------------------------- COMBINACIÓN A TRES BANDAS --------------------------------
+
+// Intentar combinar automáticamente los conflictos en archivos de texto (se ajusta con --merge)
+var mergeText = true
+
+// Tamaño máximo de los archivos que se intentan combinar
+const maxMergeSize = 4 * 1024 * 1024
+
+// Celdas máximas de la tabla de la subsecuencia común (limita la memoria con archivos muy distintos)
+const maxMergeCells = 4 * 1024 * 1024
+
+// Indicar si un contenido parece texto (UTF-8 válido y sin bytes nulos)
+func isText(data []byte) bool {
+	return len(data) <= maxMergeSize && bytes.IndexByte(data, 0) < 0 && utf8.Valid(data)
+}
+
+// Separar un texto en líneas conservando el salto de línea de cada una
+func splitLines(data []byte) []string {
+	var lines []string
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			lines = append(lines, string(data))
+			break
+		}
+		lines = append(lines, string(data[:i+1]))
+		data = data[i+1:]
+	}
+	return lines
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Para cada línea de a, índice de la línea de b con la que se empareja en la subsecuencia común más larga (-1 si ninguna).
+// Devuelve false si la parte que difiere es demasiado grande para compararla.
+func matchLines(a, b []string) ([]int, bool) {
+	match := make([]int, len(a))
+	for i := range match {
+		match[i] = -1
+	}
+
+	// El principio y el final en común se emparejan directamente
+	start := 0
+	for start < len(a) && start < len(b) && a[start] == b[start] {
+		match[start] = start
+		start++
+	}
+	endA, endB := len(a), len(b)
+	for endA > start && endB > start && a[endA-1] == b[endB-1] {
+		endA--
+		endB--
+		match[endA] = endB
+	}
+
+	n, m := endA-start, endB-start
+	if n == 0 || m == 0 {
+		return match, true
+	}
+	if (n+1)*(m+1) > maxMergeCells {
+		return nil, false
+	}
+
+	// lcs[i][j] = largo de la subsecuencia común de a[start+i:endA] y b[start+j:endB]
+	width := m + 1
+	lcs := make([]int32, (n+1)*width)
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			switch {
+			case a[start+i] == b[start+j]:
+				lcs[i*width+j] = lcs[(i+1)*width+j+1] + 1
+			case lcs[(i+1)*width+j] >= lcs[i*width+j+1]:
+				lcs[i*width+j] = lcs[(i+1)*width+j]
+			default:
+				lcs[i*width+j] = lcs[i*width+j+1]
+			}
+		}
+	}
+
+	for i, j := 0, 0; i < n && j < m; {
+		switch {
+		case a[start+i] == b[start+j]:
+			match[start+i] = start + j
+			i++
+			j++
+		case lcs[(i+1)*width+j] >= lcs[i*width+j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return match, true
+}
+
+// Agregar un bloque de conflicto con marcadores de diff3
+func appendConflict(out []string, local, base, remote []string, labels [3]string) []string {
+	block := func(marker string, lines []string) {
+		out = append(out, marker+"\n")
+		out = append(out, lines...)
+		if len(lines) > 0 && !strings.HasSuffix(lines[len(lines)-1], "\n") {
+			out[len(out)-1] += "\n"
+		}
+	}
+	block("<<<<<<< "+labels[0], local)
+	block("||||||| "+labels[1], base)
+	block("=======", remote)
+	out = append(out, ">>>>>>> "+labels[2]+"\n")
+	return out
+}
+
+// Combinar línea a línea los cambios locales y remotos hechos sobre una versión común (diff3).
+// Devuelve el texto combinado (con marcadores donde ambos lados cambiaron lo mismo), la cantidad
+// de conflictos y false si los archivos son demasiado distintos para combinarlos.
+func merge3(base, local, remote []string, labels [3]string) (string, int, bool) {
+	matchLocal, ok := matchLines(base, local)
+	if !ok {
+		return "", 0, false
+	}
+	matchRemote, ok := matchLines(base, remote)
+	if !ok {
+		return "", 0, false
+	}
+
+	var out []string
+	conflicts := 0
+	i, l, r := 0, 0, 0
+	for i < len(base) || l < len(local) || r < len(remote) {
+		// Línea de la base que sigue igual en ambos lados
+		if i < len(base) && matchLocal[i] == l && matchRemote[i] == r {
+			out = append(out, base[i])
+			i, l, r = i+1, l+1, r+1
+			continue
+		}
+
+		// Tramo hasta la próxima línea de la base que se conserva en ambos lados
+		j := i
+		for j < len(base) && (matchLocal[j] < 0 || matchRemote[j] < 0) {
+			j++
+		}
+		nextLocal, nextRemote := len(local), len(remote)
+		if j < len(base) {
+			nextLocal, nextRemote = matchLocal[j], matchRemote[j]
+		}
+
+		baseChunk, localChunk, remoteChunk := base[i:j], local[l:nextLocal], remote[r:nextRemote]
+		switch {
+		case equalLines(localChunk, baseChunk):
+			out = append(out, remoteChunk...)
+		case equalLines(remoteChunk, baseChunk), equalLines(localChunk, remoteChunk):
+			out = append(out, localChunk...)
+		default:
+			conflicts++
+			out = appendConflict(out, localChunk, baseChunk, remoteChunk, labels)
+		}
+		i, l, r = j, nextLocal, nextRemote
+	}
+	return strings.Join(out, ""), conflicts, true
+}
+
+// Intentar resolver un conflicto combinando el texto con la versión común del historial del servidor.
+// Devuelve false (sin tocar nada) si el archivo no es de texto o no hay versión común (debe llamarse con e.mu tomado).
+func (e *syncEngine) mergeConflict(action syncAction) (bool, error) {
+	base := e.state.Files[action.Path]
+	if base == nil || base.ServerVersion == 0 || action.Local.Size > maxMergeSize || action.Remote.Size > maxMergeSize || action.Local.LinkTarget != "" {
+		return false, nil
+	}
+
+	localData, err := os.ReadFile(e.localPath(action.Path))
+	if err != nil {
+		return false, err
+	}
+	if hashBytes(localData) != action.Local.Hash {
+		return false, fmt.Errorf("el archivo local cambió durante la sincronización")
+	}
+	if !isText(localData) {
+		return false, nil
+	}
+
+	remoteData, remoteVersion, remoteAttrs, err := fetchFile(e.client, action.Path, e.ctx)
+	if err != nil {
+		return false, err
+	}
+	if remoteAttrs.LinkTarget != "" {
+		return false, nil
+	}
+	ancestorData, _, err := fetchVersion(e.client, action.Path, base.ServerVersion, e.ctx)
+	if status.Code(err) == codes.NotFound {
+		log.Printf("[INFO] (%s) La versión %d de %s ya no está en el historial, no se puede combinar", time.Now().Format("15:04:05"), base.ServerVersion, action.Path)
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !isText(remoteData) || !isText(ancestorData) {
+		return false, nil
+	}
+
+	labels := [3]string{"local", fmt.Sprintf("base (versión %d)", base.ServerVersion), fmt.Sprintf("servidor (versión %d)", remoteVersion)}
+	merged, conflicts, ok := merge3(splitLines(ancestorData), splitLines(localData), splitLines(remoteData), labels)
+	if !ok {
+		return false, nil
+	}
+	if err := e.checkLocalUnchanged(action); err != nil {
+		return false, err
+	}
+
+	// La combinación conserva los permisos locales
+	mergedAttrs := fileAttrs{Mode: action.Local.Mode}
+
+	// Con conflictos: la versión remota queda en su lugar y la combinación con marcadores como copia en conflicto
+	if conflicts > 0 {
+		copyPath := conflictCopyName(action.Path, time.Now())
+		log.Printf("[INFO] (%s) %s tiene %d conflictos al combinar, se guardan marcados en %s", time.Now().Format("15:04:05"), action.Path, conflicts, copyPath)
+
+		if err := e.writeLocal(copyPath, []byte(merged), mergedAttrs); err != nil {
+			return true, err
+		}
+		if err := e.recordLocal(action.Path, remoteData, remoteVersion, remoteAttrs); err != nil {
+			return true, err
+		}
+		local, err := e.statLocal(copyPath)
+		if err != nil || local == nil {
+			return true, err
+		}
+		return true, e.applyUpload(syncAction{Kind: actionUpload, Path: copyPath, Local: local})
+	}
+
+	// Sin conflictos: escribir la combinación localmente y subirla sobre la versión remota que se combinó
+	log.Printf("[INFO] (%s) %s combinado automáticamente con la versión %d del servidor", time.Now().Format("15:04:05"), action.Path, remoteVersion)
+	if hashBytes([]byte(merged)) == hashBytes(remoteData) {
+		return true, e.recordLocal(action.Path, remoteData, remoteVersion, remoteAttrs)
+	}
+	if err := e.writeLocal(action.Path, []byte(merged), mergedAttrs); err != nil {
+		return true, err
+	}
+	resp, err := pushData(e.client, action.Path, []byte(merged), &remoteVersion, mergedAttrs, e.ctx)
+	if err != nil {
+		return true, err
+	}
+	if err := e.recordState(action.Path, []byte(merged), resp.Version); err != nil {
+		return true, err
+	}
+	log.Printf("[SUCCESS] (%s) %s combinado subido como versión %d", time.Now().Format("15:04:05"), action.Path, resp.Version)
+	return true, nil
+}
+
+// Escribir un contenido del servidor (con sus atributos) en la carpeta local y registrarlo como sincronizado
+func (e *syncEngine) recordLocal(path string, data []byte, version int64, attrs fileAttrs) error {
+	if err := e.writeLocal(path, data, attrs); err != nil {
+		return err
+	}
+	return e.recordState(path, data, version)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestMatchLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []string
+		want []int
+	}{
+		{"iguales", []string{"a", "b"}, []string{"a", "b"}, []int{0, 1}},
+		{"línea cambiada", []string{"a", "b", "c"}, []string{"a", "x", "c"}, []int{0, -1, 2}},
+		{"todo borrado", []string{"a", "b"}, nil, []int{-1, -1}},
+		{"desplazadas", []string{"x", "a", "b"}, []string{"a", "b", "y"}, []int{-1, 0, 1}},
+		{"línea repetida", []string{"a", "a", "b"}, []string{"a", "b"}, []int{0, -1, 1}},
+		{"en medio", []string{"a", "b", "c", "d"}, []string{"a", "x", "c", "y", "d"}, []int{0, -1, 2, 4}},
+	}
+	for _, tt := range tests {
+		got, ok := matchLines(tt.a, tt.b)
+		if !ok {
+			t.Fatalf("%s: no se pudieron comparar", tt.name)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: matchLines = %v, se esperaba %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMerge3(t *testing.T) {
+	labels := [3]string{"local", "base", "servidor"}
+	tests := []struct {
+		name                string
+		base, local, remote string
+		want                string
+		wantConflicts       int
+	}{
+		{
+			name: "cambios en líneas distintas",
+			base: "a\nb\nc\nd\ne\n", local: "a\nB\nc\nd\ne\n", remote: "a\nb\nc\nD\ne\n",
+			want: "a\nB\nc\nD\ne\n",
+		},
+		{
+			name: "el mismo cambio en ambos lados",
+			base: "a\nb\nc\n", local: "a\nX\nc\n", remote: "a\nX\nc\n",
+			want: "a\nX\nc\n",
+		},
+		{
+			name: "conflicto",
+			base: "a\nb\nc\n", local: "a\nL\nc\n", remote: "a\nR\nc\n",
+			want:          "a\n<<<<<<< local\nL\n||||||| base\nb\n=======\nR\n>>>>>>> servidor\nc\n",
+			wantConflicts: 1,
+		},
+		{
+			name: "línea agregada al principio",
+			base: "a\nb\n", local: "x\na\nb\n", remote: "a\nB\n",
+			want: "x\na\nB\n",
+		},
+		{
+			name: "línea agregada al final",
+			base: "a\nb\n", local: "a\nb\nz\n", remote: "A\nb\n",
+			want: "A\nb\nz\n",
+		},
+		{
+			name: "sin salto de línea final",
+			base: "a\nb\nc", local: "A\nb\nc", remote: "a\nb\nC",
+			want: "A\nb\nC",
+		},
+		{
+			name: "conflicto en la última línea sin salto",
+			base: "a\nb", local: "a\nL", remote: "a\nR",
+			want:          "a\n<<<<<<< local\nL\n||||||| base\nb\n=======\nR\n>>>>>>> servidor\n",
+			wantConflicts: 1,
+		},
+	}
+	for _, tt := range tests {
+		got, conflicts, ok := merge3(splitLines([]byte(tt.base)), splitLines([]byte(tt.local)), splitLines([]byte(tt.remote)), labels)
+		if !ok {
+			t.Fatalf("%s: no se pudo combinar", tt.name)
+		}
+		if got != tt.want || conflicts != tt.wantConflicts {
+			t.Errorf("%s: merge3 = %q (%d conflictos), se esperaba %q (%d conflictos)", tt.name, got, conflicts, tt.want, tt.wantConflicts)
+		}
+	}
+}
+
+// Archivos demasiado distintos no se combinan (la tabla superaría maxMergeCells)
+func TestMerge3TooDifferent(t *testing.T) {
+	var base, local []string
+	for i := 0; i < 3000; i++ {
+		base = append(base, fmt.Sprintf("base %d\n", i))
+		local = append(local, fmt.Sprintf("local %d\n", i))
+	}
+	if _, ok := matchLines(base, local); ok {
+		t.Fatal("matchLines comparó archivos que superan maxMergeCells")
+	}
+	if _, _, ok := merge3(base, local, base, [3]string{"local", "base", "servidor"}); ok {
+		t.Fatal("merge3 combinó archivos que superan maxMergeCells")
+	}
+}
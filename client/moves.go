@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	pb "github.com/FelipeMarchantVargas/sync-service/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ------------------------- MOVIMIENTOS Y RENOMBRES --------------------------------
+
+// Tiempo durante el que un evento Rename/Create del watcher sirve para emparejar un movimiento
+const moveHintTTL = 10 * time.Second
+
+// Pistas del watcher para reconocer movimientos: rutas renombradas (origen) y creadas (posible destino)
+type moveHints struct {
+	renamed map[string]time.Time
+	created map[string]time.Time
+}
+
+// Registrar un evento del watcher que puede ser parte de un movimiento
+func (e *syncEngine) noteMoveHint(path string, renamed bool) {
+	e.hintsMu.Lock()
+	defer e.hintsMu.Unlock()
+
+	now := time.Now()
+	for _, hints := range []map[string]time.Time{e.hints.renamed, e.hints.created} {
+		for p, at := range hints {
+			if now.Sub(at) > moveHintTTL {
+				delete(hints, p)
+			}
+		}
+	}
+	if renamed {
+		e.hints.renamed[path] = now
+	} else {
+		e.hints.created[path] = now
+	}
+}
+
+// Indicar si una ruta (o una carpeta que la contiene) se renombró hace poco
+func (e *syncEngine) recentlyRenamed(path string) bool {
+	e.hintsMu.Lock()
+	defer e.hintsMu.Unlock()
+
+	for renamed, at := range e.hints.renamed {
+		if time.Since(at) <= moveHintTTL && (path == renamed || strings.HasPrefix(path, renamed+"/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// Rutas creadas hace poco
+func (e *syncEngine) recentlyCreated() []string {
+	e.hintsMu.Lock()
+	defer e.hintsMu.Unlock()
+
+	var paths []string
+	for path, at := range e.hints.created {
+		if time.Since(at) <= moveHintTTL {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// Buscar una ruta sincronizada que desapareció localmente y tenía el mismo contenido que un archivo nuevo
+func (e *syncEngine) findMoveSource(to string, hash string) string {
+	for path, base := range e.state.Files {
+		if path == to || base.Hash != hash {
+			continue
+		}
+		if _, err := os.Lstat(e.localPath(path)); os.IsNotExist(err) {
+			return path
+		}
+	}
+	return ""
+}
+
+// Buscar entre los archivos creados hace poco uno nuevo con el contenido de una ruta que se renombró
+func (e *syncEngine) findMoveTarget(from string, hash string) (string, *localFile) {
+	for _, path := range e.recentlyCreated() {
+		if path == from || e.skipPath(path, false) || e.state.Files[path] != nil {
+			continue
+		}
+		local, err := e.statLocal(path)
+		if err == nil && local != nil && local.Hash == hash {
+			return path, local
+		}
+	}
+	return "", nil
+}
+
+// Convertir una subida de un archivo nuevo o un borrado remoto en un movimiento si es parte de un renombre
+// (debe llamarse con e.mu tomado)
+func (e *syncEngine) detectMove(action syncAction) syncAction {
+	switch {
+	case action.Kind == actionUpload && action.Remote == nil && e.state.Files[action.Path] == nil:
+		if from := e.findMoveSource(action.Path, action.Local.Hash); from != "" {
+			base := e.state.Files[from]
+			remote := &pb.FileInfo{Filename: from, Size: base.Size, Version: base.ServerVersion, Hash: base.Hash}
+			return syncAction{Kind: actionMove, Path: action.Path, From: from, Local: action.Local, Remote: remote}
+		}
+	case action.Kind == actionDeleteRemote && e.recentlyRenamed(action.Path):
+		if to, local := e.findMoveTarget(action.Path, action.Remote.Hash); to != "" {
+			return syncAction{Kind: actionMove, Path: to, From: action.Path, Local: local, Remote: action.Remote}
+		}
+	}
+	return action
+}
+
+// Emparejar en un plan los archivos que desaparecieron de un lado con archivos nuevos de igual contenido
+// en el mismo lado, para moverlos en vez de borrarlos y volver a transferirlos
+func (e *syncEngine) pairMoves(actions []syncAction) []syncAction {
+	deletedRemote := make(map[string][]int) // Se borraron localmente
+	deletedLocal := make(map[string][]int)  // Se borraron en el servidor
+	for i, action := range actions {
+		switch action.Kind {
+		case actionDeleteRemote:
+			deletedRemote[action.Remote.Hash] = append(deletedRemote[action.Remote.Hash], i)
+		case actionDeleteLocal:
+			deletedLocal[action.Local.Hash] = append(deletedLocal[action.Local.Hash], i)
+		}
+	}
+
+	paired := make(map[int]bool)
+	for i, action := range actions {
+		if e.state.Files[action.Path] != nil {
+			continue
+		}
+		switch {
+		case action.Kind == actionUpload && action.Remote == nil:
+			if candidates := deletedRemote[action.Local.Hash]; len(candidates) > 0 {
+				j := candidates[0]
+				deletedRemote[action.Local.Hash] = candidates[1:]
+				actions[i] = syncAction{Kind: actionMove, Path: action.Path, From: actions[j].Path, Local: action.Local, Remote: actions[j].Remote}
+				paired[j] = true
+			}
+		case action.Kind == actionDownload && action.Local == nil:
+			if candidates := deletedLocal[action.Remote.Hash]; len(candidates) > 0 {
+				j := candidates[0]
+				deletedLocal[action.Remote.Hash] = candidates[1:]
+				actions[i] = syncAction{Kind: actionMoveLocal, Path: action.Path, From: actions[j].Path, Local: actions[j].Local, Remote: action.Remote}
+				paired[j] = true
+			}
+		}
+	}
+
+	result := actions[:0]
+	for i, action := range actions {
+		if !paired[i] {
+			result = append(result, action)
+		}
+	}
+	return result
+}
+
+// Mover un archivo en el servidor en vez de borrarlo y volver a subirlo
+func (e *syncEngine) applyMove(action syncAction) error {
+	log.Printf("[INFO] (%s) Moviendo %s a %s en el servidor...", time.Now().Format("15:04:05"), action.From, action.Path)
+	resp, err := e.client.MoveFile(e.ctx, &pb.MoveRequest{From: action.From, To: action.Path, BaseVersion: baseVersion(action)})
+	switch status.Code(err) {
+	case codes.OK:
+	case codes.NotFound, codes.AlreadyExists, codes.Aborted:
+		// El origen cambió en el servidor o el destino ya existe: se sincroniza cada ruta por separado
+		log.Printf("[INFO] (%s) No se pudo mover %s a %s (%v), se sincronizan por separado", time.Now().Format("15:04:05"), action.From, action.Path, status.Convert(err).Message())
+		if err := e.applyChecked(syncAction{Kind: actionUpload, Path: action.Path, Local: action.Local}); err != nil {
+			return err
+		}
+		remote, err := e.statRemote(action.From)
+		if err != nil {
+			return err
+		}
+		if fallback := decide(action.From, nil, e.state.Files[action.From], remote); fallback.Kind != "" {
+			return e.applyChecked(fallback)
+		}
+		return nil
+	default:
+		return err
+	}
+
+	delete(e.state.Files, action.From)
+	e.state.Files[action.Path] = &fileState{
+		Hash:          action.Local.Hash,
+		Size:          action.Local.Size,
+		ModTime:       action.Local.ModTime,
+		ServerVersion: resp.Version,
+		Mode:          action.Local.Mode,
+	}
+	log.Printf("[SUCCESS] (%s) %s movido a %s (versión %d)", time.Now().Format("15:04:05"), action.From, action.Path, resp.Version)
+	return nil
+}
+
+// Aplicar localmente un movimiento hecho en otro dispositivo: si el archivo local no cambió,
+// se renombra sin descargarlo; si no, cada ruta se sincroniza por separado
+func (e *syncEngine) applyRemoteMove(update *pb.FileUpdate) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	from, to := update.PreviousPath, update.Path
+	base := e.state.Files[from]
+	local, err := e.statLocal(from)
+	if err != nil {
+		return err
+	}
+	_, targetErr := os.Lstat(e.localPath(to))
+
+	if base == nil || local == nil || local.Hash != base.Hash || base.Hash != update.Hash || !os.IsNotExist(targetErr) || e.skipPath(to, false) {
+		for _, path := range []string{from, to} {
+			if err := e.syncPathLocked(path); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	action := syncAction{Kind: actionMoveLocal, Path: to, From: from, Local: local, Remote: &pb.FileInfo{Filename: to, Version: update.Version, Hash: update.Hash, Size: update.Size}}
+	if err := e.applyMoveLocal(action); err != nil {
+		return err
+	}
+	return e.state.save(e.root)
+}
+
+// Renombrar localmente un archivo que se movió en el servidor (el contenido ya coincide)
+func (e *syncEngine) applyMoveLocal(action syncAction) error {
+	if err := e.checkLocalUnchanged(syncAction{Path: action.From, Local: action.Local}); err != nil {
+		return err
+	}
+	if _, err := os.Lstat(e.localPath(action.Path)); !os.IsNotExist(err) {
+		return fmt.Errorf("ya existe un archivo local en %s", action.Path)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(e.localPath(action.Path)), os.ModePerm); err != nil {
+		return err
+	}
+	if err := os.Rename(e.localPath(action.From), e.localPath(action.Path)); err != nil {
+		return err
+	}
+	e.noteOwnWrite(action.From)
+	e.noteOwnWrite(action.Path)
+	e.removeEmptyParents(filepath.Dir(e.localPath(action.From)))
+
+	delete(e.state.Files, action.From)
+	e.state.Files[action.Path] = &fileState{
+		Hash:          action.Local.Hash,
+		Size:          action.Local.Size,
+		ModTime:       action.Local.ModTime,
+		ServerVersion: action.Remote.Version,
+		Mode:          action.Local.Mode,
+	}
+	log.Printf("[SUCCESS] (%s) %s movido localmente a %s", time.Now().Format("15:04:05"), action.From, action.Path)
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	pb "github.com/FelipeMarchantVargas/sync-service/proto"
+)
+
+// Resumen de un plan para compararlo: tipo, origen (en movimientos) y ruta de cada acción
+func describePlan(actions []syncAction) []string {
+	var plan []string
+	for _, action := range actions {
+		if action.From != "" {
+			plan = append(plan, action.Kind+" "+action.From+" -> "+action.Path)
+		} else {
+			plan = append(plan, action.Kind+" "+action.Path)
+		}
+	}
+	return plan
+}
+
+func TestPairMoves(t *testing.T) {
+	tracked := func(paths ...string) *syncEngine {
+		files := make(map[string]*fileState)
+		for _, path := range paths {
+			files[path] = &fileState{Hash: "h", ServerVersion: 1}
+		}
+		return &syncEngine{state: &syncState{Files: files}}
+	}
+	upload := func(path, hash string) syncAction {
+		return syncAction{Kind: actionUpload, Path: path, Local: &localFile{Hash: hash}}
+	}
+	download := func(path, hash string) syncAction {
+		return syncAction{Kind: actionDownload, Path: path, Remote: &pb.FileInfo{Hash: hash}}
+	}
+	deleteRemote := func(path, hash string) syncAction {
+		return syncAction{Kind: actionDeleteRemote, Path: path, Remote: &pb.FileInfo{Hash: hash}}
+	}
+	deleteLocal := func(path, hash string) syncAction {
+		return syncAction{Kind: actionDeleteLocal, Path: path, Local: &localFile{Hash: hash}}
+	}
+
+	tests := []struct {
+		name    string
+		engine  *syncEngine
+		actions []syncAction
+		want    []string
+	}{
+		{
+			name:    "renombre local",
+			engine:  tracked("a.txt"),
+			actions: []syncAction{deleteRemote("a.txt", "h"), upload("b.txt", "h")},
+			want:    []string{"move a.txt -> b.txt"},
+		},
+		{
+			name:    "renombre remoto",
+			engine:  tracked("a.txt"),
+			actions: []syncAction{deleteLocal("a.txt", "h"), download("b.txt", "h")},
+			want:    []string{"move-local a.txt -> b.txt"},
+		},
+		{
+			name:    "contenido distinto",
+			engine:  tracked("a.txt"),
+			actions: []syncAction{deleteRemote("a.txt", "h"), upload("b.txt", "otro")},
+			want:    []string{"delete-remote a.txt", "upload b.txt"},
+		},
+		{
+			name:   "contenidos repetidos: cada origen se usa una vez",
+			engine: tracked("a.txt", "b.txt"),
+			actions: []syncAction{
+				deleteRemote("a.txt", "h"), deleteRemote("b.txt", "h"),
+				upload("c.txt", "h"), upload("d.txt", "h"), upload("e.txt", "h"),
+			},
+			want: []string{"move a.txt -> c.txt", "move b.txt -> d.txt", "upload e.txt"},
+		},
+		{
+			name:    "el destino ya estaba sincronizado",
+			engine:  tracked("a.txt", "b.txt"),
+			actions: []syncAction{deleteRemote("a.txt", "h"), upload("b.txt", "h")},
+			want:    []string{"delete-remote a.txt", "upload b.txt"},
+		},
+		{
+			name:    "el destino remoto ya estaba sincronizado",
+			engine:  tracked("a.txt", "b.txt"),
+			actions: []syncAction{deleteLocal("a.txt", "h"), download("b.txt", "h")},
+			want:    []string{"delete-local a.txt", "download b.txt"},
+		},
+	}
+	for _, tt := range tests {
+		got := describePlan(tt.engine.pairMoves(tt.actions))
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: plan %v, se esperaba %v", tt.name, got, tt.want)
+		}
+	}
+}
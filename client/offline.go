@@ -0,0 +1,378 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	pb "github.com/FelipeMarchantVargas/sync-service/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ------------------------- COLA SIN CONEXIÓN --------------------------------
+
+// Espera mínima y máxima entre intentos de reconexión con el servidor
+const (
+	reconnectMinDelay = time.Second
+	reconnectMaxDelay = time.Minute
+)
+
+// Tiempo máximo de la consulta que verifica si el servidor volvió
+const probeTimeout = 5 * time.Second
+
+// Indicar si un error se debe a que no hay conexión con el servidor (el cambio debe reintentarse más tarde)
+func isOffline(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	}
+	return false
+}
+
+// Espera antes del intento de reconexión número attempt (exponencial, con tope)
+func reconnectDelay(attempt int) time.Duration {
+	delay := reconnectMinDelay
+	for i := 0; i < attempt && delay < reconnectMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > reconnectMaxDelay {
+		delay = reconnectMaxDelay
+	}
+	return delay
+}
+
+// Cambios locales que todavía no se sincronizaron, guardados en disco para no perderlos si el
+// servidor no responde o el cliente se cierra. Se aplican en el orden en que ocurrieron.
+type pendingQueue struct {
+	mu   sync.Mutex
+	file string
+
+	Paths  []string `json:"paths"`            // Rutas con cambios locales pendientes, en orden
+	Full   bool     `json:"full,omitempty"`   // Se perdieron eventos: hace falta una sincronización completa
+	Failed []string `json:"failed,omitempty"` // Rutas que el servidor rechazó; se reintentan en la próxima sincronización completa
+}
+
+func pendingPath(root string) string {
+	return filepath.Join(root, stateDirName, "pending.json")
+}
+
+// Cargar la cola de una carpeta sincronizada (vacía si no hay cambios pendientes)
+func loadPendingQueue(root string) (*pendingQueue, error) {
+	q := &pendingQueue{file: pendingPath(root)}
+	data, err := os.ReadFile(q.file)
+	if os.IsNotExist(err) {
+		return q, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, q); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// Guardar la cola de forma atómica (debe llamarse con q.mu tomado)
+func (q *pendingQueue) save() error {
+	if err := os.MkdirAll(filepath.Dir(q.file), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(q, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := q.file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, q.file)
+}
+
+// Indicar si una ruta está en una lista
+func containsPath(paths []string, path string) bool {
+	for _, p := range paths {
+		if p == path {
+			return true
+		}
+	}
+	return false
+}
+
+// Quitar una ruta de una lista (devuelve la lista y si estaba)
+func removePath(paths []string, path string) ([]string, bool) {
+	for i, p := range paths {
+		if p == path {
+			return append(paths[:i], paths[i+1:]...), true
+		}
+	}
+	return paths, false
+}
+
+// Agregar una ruta al final de la cola (si ya estaba, conserva su lugar). Un nuevo cambio de una ruta
+// que había fallado se vuelve a intentar en orden.
+func (q *pendingQueue) add(path string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.Failed, _ = removePath(q.Failed, path)
+	if !containsPath(q.Paths, path) {
+		q.Paths = append(q.Paths, path)
+	}
+	return q.save()
+}
+
+// Quitar una ruta ya sincronizada
+func (q *pendingQueue) remove(path string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var queued, failed bool
+	q.Paths, queued = removePath(q.Paths, path)
+	q.Failed, failed = removePath(q.Failed, path)
+	if !queued && !failed {
+		return nil
+	}
+	return q.save()
+}
+
+// Pasar una ruta que el servidor rechazó a la lista de fallidas, para que no detenga al resto de la cola
+func (q *pendingQueue) fail(path string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.Paths, _ = removePath(q.Paths, path)
+	if !containsPath(q.Failed, path) {
+		q.Failed = append(q.Failed, path)
+	}
+	return q.save()
+}
+
+// Terminar una sincronización completa: si se aplicó todo no queda nada pendiente; si algo falló, las rutas
+// de la cola pasan a fallidas (las que no estaban en la cola siguen distintas de su último estado sincronizado
+// y la próxima pasada completa las vuelve a comparar)
+func (q *pendingQueue) finishFull(ok bool) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if ok {
+		q.Failed = nil
+	} else {
+		for _, path := range q.Paths {
+			if !containsPath(q.Failed, path) {
+				q.Failed = append(q.Failed, path)
+			}
+		}
+	}
+	q.Paths, q.Full = nil, false
+	return q.save()
+}
+
+// Programar una sincronización completa si hay rutas fallidas (p. ej. al recuperar la conexión)
+func (q *pendingQueue) retryFailed() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.Failed) == 0 || q.Full {
+		return nil
+	}
+	q.Full = true
+	return q.save()
+}
+
+// Marcar (o desmarcar) que hace falta una sincronización completa
+func (q *pendingQueue) setFull(full bool) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.Full == full {
+		return nil
+	}
+	q.Full = full
+	return q.save()
+}
+
+// Primera ruta pendiente y si hace falta una sincronización completa
+func (q *pendingQueue) peek() (string, bool, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.Paths) == 0 {
+		return "", false, q.Full
+	}
+	return q.Paths[0], true, q.Full
+}
+
+// Indicar si un error impide usar la conexión hasta reconectar: sin conexión con el servidor o con un
+// token que el servidor rechaza (reconnect lo renueva o detiene el motor). Un PermissionDenied puede ser
+// de un solo archivo (p. ej. compartido solo para lectura), así que no detiene la cola.
+func blocksConnection(err error) bool {
+	return isOffline(err) || status.Code(err) == codes.Unauthenticated
+}
+
+// Aplicar en orden los cambios pendientes. Cada ruta se vuelve a comparar con el estado actual del
+// servidor, así que los cambios remotos ocurridos mientras tanto se combinan o se marcan como conflicto.
+// Se detiene si se pierde la conexión; los cambios que faltan quedan en la cola. Una ruta sale de la cola
+// solo cuando se sincronizó: si el servidor la rechaza pasa a las fallidas, que se reintentan en la próxima
+// sincronización completa.
+func (e *syncEngine) drainPending() {
+	e.drainMu.Lock()
+	defer e.drainMu.Unlock()
+
+	for !e.isOfflineMode() && e.ctx.Err() == nil {
+		path, ok, full := e.pending.peek()
+		if full {
+			log.Printf("[INFO] (%s) Sincronizando la carpeta completa por cambios pendientes", time.Now().Format("15:04:05"))
+			err := e.syncAll()
+			if e.ctx.Err() != nil {
+				return
+			}
+			if isOffline(err) {
+				e.goOffline(err)
+				return
+			}
+			if err != nil {
+				log.Printf("[ERROR] Sincronización completa fallida: %v", err)
+			}
+			// La pasada completa también cubre las rutas pendientes
+			if err := e.pending.finishFull(err == nil); err != nil {
+				log.Printf("[ERROR] No se pudo guardar la cola de cambios: %v", err)
+			}
+			return
+		}
+		if !ok {
+			return
+		}
+
+		err := e.syncLocalChange(path)
+		if e.ctx.Err() != nil {
+			return
+		}
+		if blocksConnection(err) {
+			e.goOffline(err)
+			return
+		}
+		if err != nil {
+			log.Printf("[ERROR] No se pudo sincronizar %s, se reintentará en la próxima sincronización completa: %v", path, err)
+			err = e.pending.fail(path)
+		} else {
+			err = e.pending.remove(path)
+		}
+		if err != nil {
+			log.Printf("[ERROR] No se pudo guardar la cola de cambios: %v", err)
+		}
+	}
+}
+
+// Indicar si el cliente está esperando a que vuelva el servidor
+func (e *syncEngine) isOfflineMode() bool {
+	e.connMu.Lock()
+	defer e.connMu.Unlock()
+	return e.offline
+}
+
+// Pasar a modo sin conexión (o con la sesión rechazada): los cambios locales se acumulan en la cola y se reintenta conectar
+func (e *syncEngine) goOffline(cause error) {
+	e.connMu.Lock()
+	if e.offline {
+		e.connMu.Unlock()
+		return
+	}
+	e.offline = true
+	e.online = make(chan struct{})
+	e.connMu.Unlock()
+
+	if isOffline(cause) {
+		log.Printf("[ERROR] (%s) Sin conexión con el servidor (%v), los cambios locales quedan en cola", time.Now().Format("15:04:05"), status.Convert(cause).Message())
+	} else {
+		log.Printf("[ERROR] (%s) El servidor rechazó la sesión (%v), los cambios locales quedan en cola", time.Now().Format("15:04:05"), status.Convert(cause).Message())
+	}
+	go e.reconnect()
+}
+
+// Esperar (si hace falta) a que vuelva la conexión con el servidor o se detenga el motor
+func (e *syncEngine) waitOnline() {
+	e.connMu.Lock()
+	offline, online := e.offline, e.online
+	e.connMu.Unlock()
+	if offline {
+		select {
+		case <-online:
+		case <-e.ctx.Done():
+		}
+	}
+}
+
+// Detener el motor por un error que reintentar no resuelve (p. ej. una cuenta deshabilitada). Los cambios
+// en cola se conservan para la próxima ejecución.
+func (e *syncEngine) stop(err error) {
+	e.connMu.Lock()
+	if e.stopErr == nil {
+		e.stopErr = err
+	}
+	e.connMu.Unlock()
+	log.Printf("[ERROR] (%s) Se detiene la sincronización: %v", time.Now().Format("15:04:05"), err)
+	e.cancel()
+}
+
+// Motivo por el que se detuvo el motor (nil si sigue corriendo)
+func (e *syncEngine) stopped() error {
+	e.connMu.Lock()
+	defer e.connMu.Unlock()
+	return e.stopErr
+}
+
+// Decidir qué hacer con un rechazo del servidor al reconectar: con un token rechazado se renueva la sesión
+// y se reintenta; si la cuenta no tiene permiso (deshabilitada o sin el rol necesario) o la sesión ya no
+// se puede renovar, se detiene el motor. Devuelve false si hay que dejar de reintentar.
+func (e *syncEngine) handleRejection(token string, err error) bool {
+	switch status.Code(err) {
+	case codes.Unauthenticated:
+		refreshErr := e.tokens.refresh(token)
+		if refreshErr == nil || isOffline(refreshErr) {
+			return true
+		}
+		e.stop(fmt.Errorf("no se pudo renovar la sesión (inicia sesión de nuevo): %s", status.Convert(refreshErr).Message()))
+		return false
+	case codes.PermissionDenied:
+		e.stop(fmt.Errorf("el servidor rechazó la cuenta: %s", status.Convert(err).Message()))
+		return false
+	}
+	log.Printf("[ERROR] El servidor rechazó la reconexión: %v", err)
+	return true
+}
+
+// Reintentar la conexión con espera exponencial y, al volver, aplicar los cambios en cola
+func (e *syncEngine) reconnect() {
+	for attempt := 0; ; attempt++ {
+		select {
+		case <-time.After(reconnectDelay(attempt)):
+		case <-e.ctx.Done():
+			return
+		}
+
+		token := e.tokens.current()
+		ctx, cancel := context.WithTimeout(e.ctx, probeTimeout)
+		_, err := e.client.GetChanges(ctx, &pb.ChangesRequest{Since: e.cursor(), Limit: 1})
+		cancel()
+		// Un cursor demasiado antiguo también indica que el servidor responde (se resuelve al escuchar cambios)
+		if err == nil || status.Code(err) == codes.OutOfRange {
+			break
+		}
+		if e.ctx.Err() != nil {
+			return
+		}
+		if !isOffline(err) && !e.handleRejection(token, err) {
+			return
+		}
+	}
+
+	e.connMu.Lock()
+	e.offline = false
+	close(e.online)
+	e.connMu.Unlock()
+
+	log.Printf("[SUCCESS] (%s) Conexión con el servidor recuperada", time.Now().Format("15:04:05"))
+	// Las rutas que el servidor había rechazado se reintentan con una sincronización completa
+	if err := e.pending.retryFailed(); err != nil {
+		log.Printf("[ERROR] No se pudo guardar la cola de cambios: %v", err)
+	}
+	e.drainPending()
+}
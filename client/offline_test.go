@@ -0,0 +1,50 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Una ruta rechazada por el servidor no se pierde: pasa a las fallidas, queda guardada y se reintenta
+func TestPendingQueueKeepsFailedPaths(t *testing.T) {
+	root := t.TempDir()
+	q, err := loadPendingQueue(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"a.txt", "b.txt", "c.txt"} {
+		if err := q.add(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	q.remove("a.txt")
+	q.fail("b.txt")
+
+	reloaded, err := loadPendingQueue(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(reloaded.Paths, []string{"c.txt"}) || !reflect.DeepEqual(reloaded.Failed, []string{"b.txt"}) {
+		t.Fatalf("cola guardada: pendientes %v, fallidas %v", reloaded.Paths, reloaded.Failed)
+	}
+
+	// Al reconectar se programa una sincronización completa que, si termina bien, las da por sincronizadas
+	reloaded.retryFailed()
+	if _, _, full := reloaded.peek(); !full {
+		t.Fatal("las rutas fallidas no programaron una sincronización completa")
+	}
+	reloaded.finishFull(false)
+	if !reflect.DeepEqual(reloaded.Failed, []string{"b.txt", "c.txt"}) || len(reloaded.Paths) != 0 {
+		t.Fatalf("tras una sincronización completa fallida: pendientes %v, fallidas %v", reloaded.Paths, reloaded.Failed)
+	}
+
+	// Un nuevo cambio de una ruta fallida la devuelve a la cola
+	reloaded.add("b.txt")
+	if !reflect.DeepEqual(reloaded.Paths, []string{"b.txt"}) || !reflect.DeepEqual(reloaded.Failed, []string{"c.txt"}) {
+		t.Fatalf("tras un nuevo cambio: pendientes %v, fallidas %v", reloaded.Paths, reloaded.Failed)
+	}
+	reloaded.finishFull(true)
+	if len(reloaded.Paths) != 0 || len(reloaded.Failed) != 0 {
+		t.Fatalf("tras una sincronización completa correcta: pendientes %v, fallidas %v", reloaded.Paths, reloaded.Failed)
+	}
+}
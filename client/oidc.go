@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	pb "github.com/FelipeMarchantVargas/sync-service/proto"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// ------------------------- LOGIN CON OIDC --------------------------------
+
+// Tiempo máximo para completar el inicio de sesión en el navegador
+const oidcLoginTimeout = 5 * time.Minute
+
+// Valor aleatorio para state y nonce
+func randomToken() (string, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+// Iniciar sesión con el proveedor OIDC del servidor: obtener un ID token (con authorization code + PKCE
+// y una redirección a un puerto local, o con device code) y cambiarlo por los tokens del servidor
+func oidcLogin(authClient pb.AuthServiceClient, device bool) (string, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), oidcLoginTimeout)
+	defer cancel()
+
+	config, err := authClient.OidcConfig(ctx, &pb.Empty{})
+	if err != nil {
+		return "", "", err
+	}
+	if !config.Enabled {
+		return "", "", fmt.Errorf("el servidor no tiene configurado un proveedor OIDC")
+	}
+	provider, err := oidc.NewProvider(ctx, config.Issuer)
+	if err != nil {
+		return "", "", fmt.Errorf("no se pudo contactar al proveedor %s: %v", config.Issuer, err)
+	}
+	oauthConfig := &oauth2.Config{ClientID: config.ClientId, Endpoint: provider.Endpoint(), Scopes: config.Scopes}
+
+	var idToken string
+	if device {
+		idToken, err = oidcDeviceFlow(ctx, oauthConfig)
+	} else {
+		idToken, err = oidcLoopbackFlow(ctx, oauthConfig, provider)
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	resp, err := authClient.LoginOidc(ctx, &pb.OidcLoginRequest{IdToken: idToken})
+	if err != nil {
+		log.Printf("[ERROR] El servidor rechazó el ID token: %v", err)
+		return "", "", err
+	}
+	log.Printf("[SUCCESS] (%s) Sesión iniciada con el proveedor OIDC", time.Now().Format("15:04:05"))
+	return resp.Token, resp.RefreshToken, nil
+}
+
+// ID token de la respuesta del proveedor
+func idTokenFrom(token *oauth2.Token) (string, error) {
+	idToken, ok := token.Extra("id_token").(string)
+	if !ok || idToken == "" {
+		return "", fmt.Errorf("el proveedor no entregó un ID token (¿falta el scope openid?)")
+	}
+	return idToken, nil
+}
+
+// Authorization code con PKCE: el navegador vuelve a un servidor HTTP local con el código
+func oidcLoopbackFlow(ctx context.Context, config *oauth2.Config, provider *oidc.Provider) (string, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	defer listener.Close()
+	config.RedirectURL = fmt.Sprintf("http://%s/callback", listener.Addr())
+
+	state, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	// 1️⃣ Esperar la redirección del proveedor con el código
+	codes := make(chan string, 1)
+	errs := make(chan error, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/callback", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		switch {
+		case query.Get("state") != state:
+			http.Error(w, "state inválido", http.StatusBadRequest)
+			return
+		case query.Get("error") != "":
+			http.Error(w, "El proveedor rechazó el inicio de sesión", http.StatusUnauthorized)
+			errs <- fmt.Errorf("el proveedor rechazó el inicio de sesión: %s %s", query.Get("error"), query.Get("error_description"))
+			return
+		}
+		fmt.Fprintln(w, "Sesión iniciada. Ya puedes cerrar esta ventana.")
+		codes <- query.Get("code")
+	})
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+	defer server.Close()
+
+	// 2️⃣ Mandar al usuario al proveedor
+	authURL := config.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+	fmt.Fprintf(os.Stderr, "Abre esta dirección en el navegador para iniciar sesión:\n\n  %s\n\n", authURL)
+
+	var code string
+	select {
+	case code = <-codes:
+	case err := <-errs:
+		return "", err
+	case <-ctx.Done():
+		return "", fmt.Errorf("se agotó el tiempo para iniciar sesión en el navegador")
+	}
+
+	// 3️⃣ Cambiar el código por los tokens y revisar que el ID token sea el de este intento
+	token, err := config.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return "", fmt.Errorf("no se pudo obtener el token del proveedor: %v", err)
+	}
+	idToken, err := idTokenFrom(token)
+	if err != nil {
+		return "", err
+	}
+	parsed, err := provider.Verifier(&oidc.Config{ClientID: config.ClientID}).Verify(ctx, idToken)
+	if err != nil {
+		return "", fmt.Errorf("ID token inválido: %v", err)
+	}
+	if parsed.Nonce != nonce {
+		return "", fmt.Errorf("el ID token no corresponde a este inicio de sesión")
+	}
+	return idToken, nil
+}
+
+// Device code: el usuario ingresa un código en otro dispositivo mientras el cliente espera
+func oidcDeviceFlow(ctx context.Context, config *oauth2.Config) (string, error) {
+	if config.Endpoint.DeviceAuthURL == "" {
+		return "", fmt.Errorf("el proveedor no soporta el flujo device code")
+	}
+	auth, err := config.DeviceAuth(ctx)
+	if err != nil {
+		return "", fmt.Errorf("no se pudo iniciar el flujo device code: %v", err)
+	}
+	if auth.VerificationURIComplete != "" {
+		fmt.Fprintf(os.Stderr, "Abre %s (código %s) para iniciar sesión\n", auth.VerificationURIComplete, auth.UserCode)
+	} else {
+		fmt.Fprintf(os.Stderr, "Abre %s e ingresa el código %s para iniciar sesión\n", auth.VerificationURI, auth.UserCode)
+	}
+
+	token, err := config.DeviceAccessToken(ctx, auth)
+	if err != nil {
+		return "", fmt.Errorf("no se pudo completar el inicio de sesión: %v", err)
+	}
+	return idTokenFrom(token)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ------------------------- SINCRONIZACIÓN SELECTIVA --------------------------------
+
+// Normalizar las carpetas remotas de una selección ("docs/", "./fotos" -> "docs", "fotos")
+func normalizeSelection(dirs []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var result []string
+	for _, dir := range dirs {
+		dir = path.Clean(strings.Trim(filepath.ToSlash(dir), "/"))
+		if dir == "." || dir == ".." || strings.HasPrefix(dir, "../") {
+			return nil, fmt.Errorf("carpeta inválida: %s", dir)
+		}
+		if !seen[dir] {
+			seen[dir] = true
+			result = append(result, dir)
+		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// Indicar si una ruta está dentro de una carpeta (o es esa misma ruta)
+func withinDir(p, dir string) bool {
+	return p == dir || strings.HasPrefix(p, dir+"/")
+}
+
+// Indicar si una ruta entra en la selección de carpetas. Las exclusiones tienen prioridad y las carpetas
+// que contienen una carpeta incluida también se recorren (sin sincronizar los archivos que tengan sueltos).
+func (s *syncState) selected(p string, isDir bool) bool {
+	for _, dir := range s.Exclude {
+		if withinDir(p, dir) {
+			return false
+		}
+	}
+	if len(s.Include) == 0 {
+		return true
+	}
+	for _, dir := range s.Include {
+		if withinDir(p, dir) || (isDir && withinDir(dir, p)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Carpetas incluidas y excluidas de la sincronización
+func (e *syncEngine) selection() ([]string, []string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.state.Include, e.state.Exclude
+}
+
+// Cambiar las carpetas que se sincronizan. Lo que sale de la selección se borra localmente y lo que entra
+// se descarga en la próxima sincronización completa.
+func (e *syncEngine) setSelection(include, exclude []string) error {
+	include, err := normalizeSelection(include)
+	if err != nil {
+		return err
+	}
+	exclude, err = normalizeSelection(exclude)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.state.Include, e.state.Exclude = include, exclude
+	return e.state.save(e.root)
+}
+
+// Rutas sincronizadas que quedaron fuera de la selección (debe llamarse con e.mu tomado)
+func (e *syncEngine) deselectedPaths() []string {
+	var paths []string
+	for p := range e.state.Files {
+		if !e.state.selected(p, false) {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Borrar localmente los archivos sincronizados que quedaron fuera de la selección (debe llamarse con e.mu tomado).
+// Los que se modificaron localmente desde la última sincronización se conservan, pero dejan de sincronizarse.
+func (e *syncEngine) evictDeselected() {
+	for _, p := range e.deselectedPaths() {
+		base := e.state.Files[p]
+		local, err := e.statLocal(p)
+		if err != nil {
+			log.Printf("[ERROR] No se pudo revisar %s: %v", p, err)
+			continue
+		}
+		delete(e.state.Files, p)
+		if local == nil {
+			continue
+		}
+		if local.Hash != base.Hash {
+			log.Printf("[INFO] (%s) %s quedó fuera de la selección pero tiene cambios locales, se conserva sin sincronizar", time.Now().Format("15:04:05"), p)
+			continue
+		}
+
+		localPath := e.localPath(p)
+		if err := os.Remove(localPath); err != nil && !os.IsNotExist(err) {
+			log.Printf("[ERROR] No se pudo borrar %s: %v", p, err)
+			continue
+		}
+		e.noteOwnWrite(p)
+		e.removeEmptyParents(filepath.Dir(localPath))
+		log.Printf("[INFO] (%s) %s borrado localmente (fuera de la selección)", time.Now().Format("15:04:05"), p)
+	}
+}
+
+// Mostrar las carpetas que se sincronizan
+func (e *syncEngine) printSelection() {
+	include, exclude := e.selection()
+	if len(include) == 0 {
+		fmt.Println("Carpetas incluidas: todas")
+	} else {
+		fmt.Println("Carpetas incluidas:", strings.Join(include, ", "))
+	}
+	if len(exclude) > 0 {
+		fmt.Println("Carpetas excluidas:", strings.Join(exclude, ", "))
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	pb "github.com/FelipeMarchantVargas/sync-service/proto"
+	"github.com/golang-jwt/jwt/v4"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ------------------------- SESIÓN DEL MOTOR --------------------------------
+
+// Margen antes de la expiración del token de acceso en que se renueva
+const tokenRefreshMargin = time.Minute
+
+// Credenciales por llamada del motor de sincronización: adjuntan el token vigente a cada pedido y lo renuevan
+// con el refresh token (guardando las credenciales nuevas) cuando está por expirar o el servidor lo rechaza.
+// Así un "watch" de varias horas no se queda con el token con que empezó. Una API key no expira ni se renueva.
+type tokenSource struct {
+	auth pb.AuthServiceClient // En una conexión sin estas credenciales: RefreshToken no puede esperar a sí misma
+
+	mu           sync.Mutex
+	token        string
+	refreshToken string
+	expires      time.Time // Expiración del token de acceso (cero si no se conoce, p. ej. una API key)
+}
+
+// Crear la fuente con la API key del entorno o los tokens guardados por "login"
+func newTokenSource(authClient pb.AuthServiceClient) (*tokenSource, error) {
+	token, refreshToken, err := authenticate()
+	if err != nil {
+		return nil, err
+	}
+	return &tokenSource{auth: authClient, token: token, refreshToken: refreshToken, expires: tokenExpiry(token)}, nil
+}
+
+// Expiración de un JWT, sin verificar su firma (la verifica el servidor); cero si no es un JWT
+func tokenExpiry(token string) time.Time {
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(token, claims); err != nil {
+		return time.Time{}
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return time.Time{}
+	}
+	return time.Unix(int64(exp), 0)
+}
+
+// Token que se está usando
+func (t *tokenSource) current() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.token
+}
+
+// Pedir un token nuevo con el refresh token (debe llamarse con t.mu tomado)
+func (t *tokenSource) refreshLocked() error {
+	if t.refreshToken == "" {
+		return status.Errorf(codes.Unauthenticated, "la API key fue rechazada")
+	}
+	token, refreshToken, err := refreshAuthToken(t.auth, t.refreshToken)
+	if err != nil {
+		return err
+	}
+	t.token, t.refreshToken, t.expires = token, refreshToken, tokenExpiry(token)
+	log.Printf("[INFO] (%s) Token de acceso renovado", time.Now().Format("15:04:05"))
+	return nil
+}
+
+// Renovar el token después de que el servidor rechazara stale. Si otra llamada ya lo renovó no se pide otro.
+func (t *tokenSource) refresh(stale string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.token != stale {
+		return nil
+	}
+	return t.refreshLocked()
+}
+
+// Adjuntar el token a un pedido, renovándolo antes si está por expirar. Si no se puede renovar se envía el
+// actual: el servidor decide si todavía sirve y el rechazo se maneja como cualquier otro.
+func (t *tokenSource) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.refreshToken != "" && !t.expires.IsZero() && time.Until(t.expires) < tokenRefreshMargin {
+		if err := t.refreshLocked(); err != nil {
+			log.Printf("[ERROR] No se pudo renovar el token de acceso: %v", err)
+		}
+	}
+	return map[string]string{"authorization": t.token}, nil
+}
+
+// El servidor de desarrollo no usa TLS
+func (t *tokenSource) RequireTransportSecurity() bool {
+	return false
+}
+
+// Reintentar una vez con un token renovado las llamadas que el servidor rechaza por autenticación
+func (t *tokenSource) unaryInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	token := t.current()
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	if status.Code(err) != codes.Unauthenticated {
+		return err
+	}
+	if refreshErr := t.refresh(token); refreshErr != nil {
+		return err
+	}
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+// Conectarse al servidor con las credenciales de la sesión guardada. Devuelve la conexión y la fuente de
+// tokens; la conexión que usa la fuente para renovarlos se cierra junto con la principal.
+func dialWithSession() (*grpc.ClientConn, *tokenSource, func(), error) {
+	authConn, err := grpc.Dial("localhost:50051", grpc.WithInsecure())
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	tokens, err := newTokenSource(pb.NewAuthServiceClient(authConn))
+	if err != nil {
+		authConn.Close()
+		return nil, nil, nil, err
+	}
+	conn, err := grpc.Dial("localhost:50051", grpc.WithInsecure(), grpc.WithPerRPCCredentials(tokens), grpc.WithUnaryInterceptor(tokens.unaryInterceptor))
+	if err != nil {
+		authConn.Close()
+		return nil, nil, nil, err
+	}
+	closeAll := func() {
+		conn.Close()
+		authConn.Close()
+	}
+	return conn, tokens, closeAll, nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	pb "github.com/FelipeMarchantVargas/sync-service/proto"
+)
+
+// ------------------------- ARCHIVOS COMPARTIDOS --------------------------------
+
+// Dar acceso a otro usuario sobre un archivo propio ("read" o "write")
+func shareFile(client pb.SyncServiceClient, filename, username, permission string, ctx context.Context) error {
+	resp, err := client.ShareFile(ctx, &pb.ShareRequest{Filename: filename, Username: username, Permission: permission})
+	if err != nil {
+		log.Printf("[ERROR] No se pudo compartir %s con %s: %v", filename, username, err)
+		return err
+	}
+	log.Printf("[SUCCESS] (%s) %s compartido con %s (%s, versión %d)", time.Now().Format("15:04:05"), filename, username, permission, resp.Version)
+	fmt.Printf("%s compartido con %s (%s)\n", filename, username, permission)
+	return nil
+}
+
+// Quitar el acceso de otro usuario a un archivo propio
+func unshareFile(client pb.SyncServiceClient, filename, username string, ctx context.Context) error {
+	if _, err := client.UnshareFile(ctx, &pb.ShareRequest{Filename: filename, Username: username}); err != nil {
+		log.Printf("[ERROR] No se pudo dejar de compartir %s con %s: %v", filename, username, err)
+		return err
+	}
+	log.Printf("[SUCCESS] (%s) %s ya no está compartido con %s", time.Now().Format("15:04:05"), filename, username)
+	fmt.Printf("%s ya no está compartido con %s\n", filename, username)
+	return nil
+}
+
+// Mostrar los archivos que otros usuarios compartieron conmigo
+func listShared(client pb.SyncServiceClient, ctx context.Context) error {
+	resp, err := client.ListSharedWithMe(ctx, &pb.Empty{})
+	if err != nil {
+		log.Printf("[ERROR] No se pudo obtener la lista de archivos compartidos: %v", err)
+		return err
+	}
+	if len(resp.Files) == 0 {
+		fmt.Println("Nadie compartió archivos contigo")
+		return nil
+	}
+	for _, file := range resp.Files {
+		fmt.Printf("%s\t%s\t%s\tv%d\t%d bytes\n", file.Info.Filename, file.Owner, file.Permission, file.Info.Version, file.Info.Size)
+	}
+	return nil
+}
+
+// Crear un enlace público y temporal a un archivo, para entregarlo a alguien sin cuenta
+func createShareLink(client pb.SyncServiceClient, filename string, ttl time.Duration, password string, maxDownloads int, ctx context.Context) error {
+	resp, err := client.CreateShareLink(ctx, &pb.ShareLinkRequest{
+		Filename:     filename,
+		TtlSeconds:   int64(ttl / time.Second),
+		Password:     password,
+		MaxDownloads: int32(maxDownloads),
+	})
+	if err != nil {
+		log.Printf("[ERROR] No se pudo crear el enlace a %s: %v", filename, err)
+		return err
+	}
+	log.Printf("[SUCCESS] (%s) Enlace a %s creado", time.Now().Format("15:04:05"), filename)
+	fmt.Println(resp.Url)
+	fmt.Printf("Vence: %s\n", time.Unix(resp.Expires, 0).Format("2006-01-02 15:04:05"))
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// Directorio (dentro de la carpeta sincronizada) donde el cliente guarda su estado
+const stateDirName = ".sync"
+
+// Estado de un archivo la última vez que quedó sincronizado
+type fileState struct {
+	Hash          string `json:"hash"`           // SHA-256 del contenido local sincronizado
+	Size          int64  `json:"size"`           // Tamaño local
+	ModTime       int64  `json:"mod_time"`       // mtime local (UnixNano), para no recalcular el hash si no cambió
+	ServerVersion int64  `json:"server_version"` // Versión del servidor con la que coincide
+	Mode          uint32 `json:"mode,omitempty"` // Permisos locales (para detectar un chmod sin cambios de contenido)
+}
+
+// Base de datos local de la sincronización: qué se sincronizó por última vez y hasta qué cambio del servidor
+type syncState struct {
+	Device string                `json:"device"` // Identificador de esta copia de la carpeta ante el servidor
+	Cursor int64                 `json:"cursor"` // Última secuencia del journal del servidor aplicada
+	Files  map[string]*fileState `json:"files"`  // Por ruta relativa (separada por "/")
+
+	Include []string `json:"include,omitempty"` // Sincronización selectiva: carpetas remotas que se sincronizan (vacío = todas)
+	Exclude []string `json:"exclude,omitempty"` // Sincronización selectiva: carpetas remotas que no se sincronizan
+}
+
+func statePath(root string) string {
+	return filepath.Join(root, stateDirName, "state.json")
+}
+
+// Cargar el estado de una carpeta sincronizada (vacío si es la primera vez)
+func loadState(root string) (*syncState, error) {
+	state := &syncState{Files: make(map[string]*fileState)}
+
+	data, err := os.ReadFile(statePath(root))
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+	if state.Files == nil {
+		state.Files = make(map[string]*fileState)
+	}
+	return state, nil
+}
+
+// Guardar el estado de forma atómica
+func (s *syncState) save(root string) error {
+	if err := os.MkdirAll(filepath.Join(root, stateDirName), 0700); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := statePath(root) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, statePath(root))
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/FelipeMarchantVargas/sync-service/compression"
+	pb "github.com/FelipeMarchantVargas/sync-service/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Configuración de las transferencias (se ajusta con flags globales de la CLI)
+var (
+	parallelism = 4               // Streams simultáneos para archivos grandes
+	partSize    = 8 * 1024 * 1024 // Tamaño de cada parte transferida en paralelo
+	chunkSize   = 64 * 1024       // Tamaño de cada mensaje enviado por el stream
+)
+
+// Límite de tamaño de mensaje: gRPC rechaza mensajes de más de 4 MB por defecto
+const maxChunkSize = 2 * 1024 * 1024
+
+// Validar la configuración de transferencias
+func validateTransferConfig() error {
+	if parallelism < 1 {
+		return fmt.Errorf("el paralelismo debe ser al menos 1")
+	}
+	if chunkSize < 1 || chunkSize > maxChunkSize {
+		return fmt.Errorf("el tamaño de fragmento debe estar entre 1 y %d bytes", maxChunkSize)
+	}
+	if partSize < chunkSize {
+		return fmt.Errorf("el tamaño de parte debe ser mayor o igual al tamaño de fragmento")
+	}
+	return nil
+}
+
+// Enviar datos por un stream de subida en fragmentos de chunkSize (al menos uno, aunque esté vacío)
+func sendChunks(stream pb.SyncService_UploadFileClient, header *pb.FileChunk, data []byte) error {
+	for i := 0; i == 0 || i < len(data); i += chunkSize {
+		end := i + chunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+
+		err := stream.Send(&pb.FileChunk{
+			Filename:    header.Filename,
+			Data:        data[i:end],
+			Compression: header.Compression,
+			UploadId:    header.UploadId,
+			Part:        header.Part,
+			BaseVersion: header.BaseVersion,
+			Mode:        header.Mode,
+			Mtime:       header.Mtime,
+			LinkTarget:  header.LinkTarget,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Recibir todos los fragmentos de una descarga y descomprimirlos con el códec elegido por el servidor.
+// Devuelve también la versión y los atributos del archivo enviados por el servidor.
+func receiveChunks(stream pb.SyncService_DownloadFileClient) ([]byte, int64, fileAttrs, error) {
+	var codec string
+	var version int64
+	var attrs fileAttrs
+	var compressedBuffer bytes.Buffer
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, attrs, err
+		}
+		if codec == "" {
+			codec = compression.Normalize(chunk.Compression)
+			version = chunk.Version
+			attrs = chunkAttrs(chunk)
+		}
+		compressedBuffer.Write(chunk.Data)
+	}
+
+	data, err := compression.Decompress(codec, compressedBuffer.Bytes())
+	if err != nil {
+		return nil, 0, attrs, fmt.Errorf("no se pudo descomprimir (%s): %v", codec, err)
+	}
+	return data, version, attrs, nil
+}
+
+// Ejecutar n tareas con como máximo `parallelism` a la vez, cancelando el resto al primer error
+func runParallel(ctx context.Context, n int, task func(ctx context.Context, i int) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	semaphore := make(chan struct{}, parallelism)
+
+	for i := 0; i < n; i++ {
+		select {
+		case semaphore <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			if err := task(ctx, i); err != nil {
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if firstErr == nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return firstErr
+}
+
+// Generar un identificador aleatorio para una subida en partes
+func newUploadID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// Subir el contenido de un archivo con la ruta remota indicada y sus atributos (en partes si es grande).
+// Si baseVersion no es nil, el servidor rechaza la subida con codes.Aborted cuando esa no es la versión vigente.
+func pushData(client pb.SyncServiceClient, filename string, data []byte, baseVersion *int64, attrs fileAttrs, ctx context.Context) (*pb.UploadResponse, error) {
+	if parallelism > 1 && len(data) > partSize && attrs.LinkTarget == "" {
+		return uploadFileParallel(client, filename, data, baseVersion, attrs, ctx)
+	}
+
+	// Comprimir el archivo en memoria con el códec elegido
+	codec := uploadCodec(data)
+	compressedData, err := compression.Compress(codec, data)
+	if err != nil {
+		return nil, fmt.Errorf("no se pudo comprimir el archivo: %v", err)
+	}
+
+	// Crear stream para enviar el archivo comprimido
+	stream, err := client.UploadFile(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("no se pudo iniciar la subida: %w", err)
+	}
+
+	// 🔥 No agregamos ".gz" al nombre
+	header := &pb.FileChunk{Filename: filename, Compression: codec, BaseVersion: baseVersion, Mode: attrs.Mode, Mtime: attrs.MTime, LinkTarget: attrs.LinkTarget}
+	if err := sendChunks(stream, header, compressedData); err != nil {
+		return nil, fmt.Errorf("no se pudo enviar el fragmento: %w", err)
+	}
+
+	resp, err := stream.CloseAndRecv()
+	if status.Code(err) == codes.Aborted {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error al cerrar la subida: %w", err)
+	}
+	return resp, nil
+}
+
+// Subir un archivo grande en partes por varios streams y confirmar la subida al final
+func uploadFileParallel(client pb.SyncServiceClient, filename string, data []byte, baseVersion *int64, attrs fileAttrs, ctx context.Context) (*pb.UploadResponse, error) {
+	startTime := time.Now()
+
+	uploadID, err := newUploadID()
+	if err != nil {
+		return nil, err
+	}
+	parts := (len(data) + partSize - 1) / partSize
+
+	log.Printf("[INFO] (%s) Subiendo %s en %d partes con %d streams", time.Now().Format("15:04:05"), filename, parts, parallelism)
+
+	err = runParallel(ctx, parts, func(ctx context.Context, part int) error {
+		start := part * partSize
+		end := start + partSize
+		if end > len(data) {
+			end = len(data)
+		}
+
+		// Cada parte negocia su propio códec (una parte puede ser incompresible y otra no)
+		partData := data[start:end]
+		codec := uploadCodec(partData)
+		compressedData, err := compression.Compress(codec, partData)
+		if err != nil {
+			return fmt.Errorf("parte %d: no se pudo comprimir: %v", part, err)
+		}
+
+		stream, err := client.UploadFile(ctx)
+		if err != nil {
+			return fmt.Errorf("parte %d: no se pudo iniciar la subida: %w", part, err)
+		}
+		header := &pb.FileChunk{Filename: filename, Compression: codec, UploadId: uploadID, Part: int32(part)}
+		if err := sendChunks(stream, header, compressedData); err != nil {
+			return fmt.Errorf("parte %d: no se pudo enviar el fragmento: %w", part, err)
+		}
+		if _, err := stream.CloseAndRecv(); err != nil {
+			return fmt.Errorf("parte %d: error al cerrar la subida: %w", part, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.CommitUpload(ctx, &pb.CommitRequest{UploadId: uploadID, Filename: filename, Parts: int32(parts), BaseVersion: baseVersion, Mode: attrs.Mode, Mtime: attrs.MTime})
+	if status.Code(err) == codes.Aborted {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("no se pudo confirmar la subida: %w", err)
+	}
+
+	log.Printf("[SUCCESS] (%s) %s subido en %d partes en %.2f s", time.Now().Format("15:04:05"), filename, parts, time.Since(startTime).Seconds())
+	return resp, nil
+}
+
+// Descargar un archivo completo, por rangos en paralelo si es grande. Devuelve el contenido, su versión y sus atributos.
+func fetchFile(client pb.SyncServiceClient, filename string, ctx context.Context) ([]byte, int64, fileAttrs, error) {
+	if parallelism > 1 {
+		info, err := client.StatFile(ctx, &pb.FileRequest{Filename: filename})
+		if err == nil && info.Size > int64(partSize) {
+			return fetchFileParallel(client, filename, info.Size, ctx)
+		}
+	}
+
+	stream, err := client.DownloadFile(ctx, &pb.FileRequest{
+		Filename:          filename,
+		AcceptCompression: acceptedCodecs(),
+		ChunkSize:         int32(chunkSize),
+	})
+	if err != nil {
+		return nil, 0, fileAttrs{}, err
+	}
+	return receiveChunks(stream)
+}
+
+// Descargar una versión anterior de un archivo desde el historial del servidor
+func fetchVersion(client pb.SyncServiceClient, filename string, version int64, ctx context.Context) ([]byte, int64, error) {
+	stream, err := client.DownloadFile(ctx, &pb.FileRequest{
+		Filename:          filename,
+		AcceptCompression: acceptedCodecs(),
+		ChunkSize:         int32(chunkSize),
+		Version:           version,
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	data, version, _, err := receiveChunks(stream)
+	return data, version, err
+}
+
+// Descargar un archivo por rangos usando varios streams y ensamblarlo en orden
+func fetchFileParallel(client pb.SyncServiceClient, filename string, size int64, ctx context.Context) ([]byte, int64, fileAttrs, error) {
+	parts := int((size + int64(partSize) - 1) / int64(partSize))
+	data := make([]byte, size)
+	versions := make([]int64, parts)
+	var attrs fileAttrs
+
+	log.Printf("[INFO] (%s) Descargando %s en %d partes con %d streams", time.Now().Format("15:04:05"), filename, parts, parallelism)
+
+	err := runParallel(ctx, parts, func(ctx context.Context, part int) error {
+		offset := int64(part) * int64(partSize)
+		length := int64(partSize)
+		if offset+length > size {
+			length = size - offset
+		}
+
+		stream, err := client.DownloadFile(ctx, &pb.FileRequest{
+			Filename:          filename,
+			AcceptCompression: acceptedCodecs(),
+			Offset:            offset,
+			Length:            length,
+			ChunkSize:         int32(chunkSize),
+		})
+		if err != nil {
+			return fmt.Errorf("parte %d: no se pudo solicitar el rango: %w", part, err)
+		}
+		partData, version, partAttrs, err := receiveChunks(stream)
+		if err != nil {
+			return fmt.Errorf("parte %d: %w", part, err)
+		}
+		versions[part] = version
+		if part == 0 {
+			attrs = partAttrs
+		}
+		if int64(len(partData)) != length {
+			return fmt.Errorf("parte %d: se esperaban %d bytes y llegaron %d (¿cambió el archivo?)", part, length, len(partData))
+		}
+		copy(data[offset:], partData)
+		return nil
+	})
+	if err != nil {
+		return nil, 0, attrs, err
+	}
+
+	// Todas las partes deben venir de la misma versión del archivo
+	for _, version := range versions {
+		if version != versions[0] {
+			return nil, 0, attrs, fmt.Errorf("el archivo cambió durante la descarga")
+		}
+	}
+	return data, versions[0], attrs, nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	pb "github.com/FelipeMarchantVargas/sync-service/proto"
+	"github.com/urfave/cli"
+)
+
+// ------------------------- SEGUNDO FACTOR --------------------------------
+
+// Activar el segundo factor: mostrar el secreto, pedir un código de la aplicación y mostrar los códigos de recuperación
+func enableTwoFactor(client pb.AuthServiceClient, ctx context.Context) error {
+	enrollment, err := client.EnrollTotp(ctx, &pb.Empty{})
+	if err != nil {
+		log.Printf("[ERROR] No se pudo empezar a activar el segundo factor: %v", err)
+		return err
+	}
+	fmt.Println("Agrega esta cuenta a tu aplicación de autenticación (escaneando la URI como código QR o ingresando el secreto):")
+	fmt.Printf("  URI:     %s\n", enrollment.Uri)
+	fmt.Printf("  Secreto: %s\n", enrollment.Secret)
+
+	code, err := promptLine("Código que muestra la aplicación: ")
+	if err != nil {
+		return err
+	}
+	resp, err := client.ConfirmTotp(ctx, &pb.TotpRequest{Code: code})
+	if err != nil {
+		log.Printf("[ERROR] No se pudo activar el segundo factor: %v", err)
+		return err
+	}
+
+	log.Printf("[SUCCESS] (%s) Segundo factor activado", time.Now().Format("15:04:05"))
+	fmt.Println("Segundo factor activado. Códigos de recuperación (cada uno sirve una vez; guárdalos, no se vuelven a mostrar):")
+	for _, recovery := range resp.Codes {
+		fmt.Printf("  %s\n", recovery)
+	}
+	return nil
+}
+
+// Desactivar el segundo factor con un código de la aplicación o de recuperación
+func disableTwoFactor(client pb.AuthServiceClient, code string, ctx context.Context) error {
+	if code == "" {
+		var err error
+		if code, err = promptLine("Código de verificación (o código de recuperación): "); err != nil {
+			return err
+		}
+	}
+	if _, err := client.DisableTotp(ctx, &pb.TotpRequest{Code: code}); err != nil {
+		log.Printf("[ERROR] No se pudo desactivar el segundo factor: %v", err)
+		return err
+	}
+	log.Printf("[SUCCESS] (%s) Segundo factor desactivado", time.Now().Format("15:04:05"))
+	fmt.Println("Segundo factor desactivado")
+	return nil
+}
+
+// Subcomandos de "2fa"
+var twoFactorCommands = []cli.Command{
+	{
+		Name:  "enable",
+		Usage: "Activar el segundo factor en la cuenta con sesión iniciada",
+		Action: func(c *cli.Context) error {
+			return withAuthClient(func(client pb.AuthServiceClient, ctx context.Context) error {
+				return enableTwoFactor(client, ctx)
+			})
+		},
+	},
+	{
+		Name:  "disable",
+		Usage: "Desactivar el segundo factor",
+		Flags: []cli.Flag{
+			cli.StringFlag{Name: "code", Usage: "Código de la aplicación o de recuperación (si no se indica, se pide en la terminal)"},
+		},
+		Action: func(c *cli.Context) error {
+			return withAuthClient(func(client pb.AuthServiceClient, ctx context.Context) error {
+				return disableTwoFactor(client, c.String("code"), ctx)
+			})
+		},
+	},
+}
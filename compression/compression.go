@@ -0,0 +1,172 @@
+package compression
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Códecs soportados en las transferencias
+const (
+	None = "none"
+	Gzip = "gzip"
+	Zstd = "zstd"
+)
+
+// Tamaño de cada muestra usada para detectar contenido incompresible
+const sampleSize = 16 * 1024
+
+// Si la muestra comprimida ocupa más de este porcentaje del original, no vale la pena comprimir
+const incompressibleRatio = 0.9
+
+// Tamaño máximo de los datos descomprimidos: evita que una bomba de descompresión agote la memoria.
+// Los archivos grandes se transfieren en partes, así que el límite se aplica a cada parte.
+var MaxDecompressedSize int64 = 1 << 30
+
+// Error al descomprimir datos que superan el tamaño máximo
+var ErrTooLarge = errors.New("los datos descomprimidos superan el tamaño máximo")
+
+var zstdEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault))
+
+// Normalizar el nombre del códec (vacío equivale a gzip por compatibilidad con clientes antiguos)
+func Normalize(codec string) string {
+	if codec == "" {
+		return Gzip
+	}
+	return codec
+}
+
+// Indicar si el códec está soportado
+func Supported(codec string) bool {
+	switch Normalize(codec) {
+	case None, Gzip, Zstd:
+		return true
+	}
+	return false
+}
+
+// Comprimir datos con el códec indicado
+func Compress(codec string, data []byte) ([]byte, error) {
+	switch Normalize(codec) {
+	case None:
+		return data, nil
+	case Gzip:
+		var buffer bytes.Buffer
+		gzipWriter := gzip.NewWriter(&buffer)
+		if _, err := gzipWriter.Write(data); err != nil {
+			gzipWriter.Close()
+			return nil, err
+		}
+		if err := gzipWriter.Close(); err != nil {
+			return nil, err
+		}
+		return buffer.Bytes(), nil
+	case Zstd:
+		return zstdEncoder.EncodeAll(data, nil), nil
+	}
+	return nil, fmt.Errorf("códec de compresión no soportado: %s", codec)
+}
+
+// Descomprimir datos con el códec indicado, hasta MaxDecompressedSize bytes
+func Decompress(codec string, data []byte) ([]byte, error) {
+	return decompress(codec, data, MaxDecompressedSize)
+}
+
+// Descomprimir datos leyendo a lo más limit bytes; si hay más devuelve ErrTooLarge
+func decompress(codec string, data []byte, limit int64) ([]byte, error) {
+	var reader io.Reader
+	switch Normalize(codec) {
+	case None:
+		return data, nil
+	case Gzip:
+		gzipReader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	case Zstd:
+		// La ventana del decodificador también queda acotada por el límite
+		zstdReader, err := zstd.NewReader(bytes.NewReader(data), zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(uint64(limit)))
+		if err != nil {
+			return nil, err
+		}
+		defer zstdReader.Close()
+		reader = zstdReader
+	default:
+		return nil, fmt.Errorf("códec de compresión no soportado: %s", codec)
+	}
+
+	decompressed, err := io.ReadAll(io.LimitReader(reader, limit+1))
+	if errors.Is(err, zstd.ErrWindowSizeExceeded) || errors.Is(err, zstd.ErrDecoderSizeExceeded) {
+		return nil, ErrTooLarge
+	}
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(decompressed)) > limit {
+		return nil, ErrTooLarge
+	}
+	return decompressed, nil
+}
+
+// Detectar si el contenido vale la pena comprimirlo, tomando muestras al inicio, medio y final
+func IsCompressible(data []byte) bool {
+	if len(data) < 512 {
+		return false
+	}
+
+	var sample []byte
+	if len(data) <= 3*sampleSize {
+		sample = data
+	} else {
+		middle := len(data)/2 - sampleSize/2
+		sample = make([]byte, 0, 3*sampleSize)
+		sample = append(sample, data[:sampleSize]...)
+		sample = append(sample, data[middle:middle+sampleSize]...)
+		sample = append(sample, data[len(data)-sampleSize:]...)
+	}
+
+	// Se usa deflate en su nivel más rápido: es barato y su ratio es buen indicador para todos los códecs
+	var compressed bytes.Buffer
+	flateWriter, err := flate.NewWriter(&compressed, flate.BestSpeed)
+	if err != nil {
+		return true
+	}
+	flateWriter.Write(sample)
+	flateWriter.Close()
+	return float64(compressed.Len()) < float64(len(sample))*incompressibleRatio
+}
+
+// Elegir el códec para una transferencia según lo que acepta el otro extremo y el contenido.
+// Sin lista se usa gzip, como esperan los clientes anteriores a la negociación; si la lista no tiene
+// ningún códec soportado los datos se envían sin comprimir, que cualquier cliente puede leer.
+func Negotiate(accepted []string, data []byte) string {
+	if len(accepted) == 0 {
+		return Gzip
+	}
+
+	compressible := IsCompressible(data)
+	acceptsNone := false
+	for _, codec := range accepted {
+		if Normalize(codec) == None {
+			acceptsNone = true
+		}
+	}
+	if !compressible && acceptsNone {
+		return None
+	}
+
+	for _, codec := range accepted {
+		codec = Normalize(codec)
+		if codec != None && Supported(codec) {
+			return codec
+		}
+	}
+	return None
+}
@@ -0,0 +1,75 @@
+package compression
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte("sync-service "), 1000)
+	for _, codec := range []string{None, Gzip, Zstd, ""} {
+		compressed, err := Compress(codec, data)
+		if err != nil {
+			t.Fatalf("%q: error al comprimir: %v", codec, err)
+		}
+		decompressed, err := Decompress(codec, compressed)
+		if err != nil {
+			t.Fatalf("%q: error al descomprimir: %v", codec, err)
+		}
+		if !bytes.Equal(decompressed, data) {
+			t.Fatalf("%q: los datos no coinciden después de descomprimir", codec)
+		}
+	}
+}
+
+func TestDecompressLimit(t *testing.T) {
+	const limit = 1 << 20
+	bomb := make([]byte, 16*limit)
+	for _, codec := range []string{Gzip, Zstd} {
+		compressed, err := Compress(codec, bomb)
+		if err != nil {
+			t.Fatalf("%s: error al comprimir: %v", codec, err)
+		}
+		if _, err := decompress(codec, compressed, limit); !errors.Is(err, ErrTooLarge) {
+			t.Fatalf("%s: se esperaba ErrTooLarge, se obtuvo %v", codec, err)
+		}
+
+		exact, err := Compress(codec, bomb[:limit])
+		if err != nil {
+			t.Fatalf("%s: error al comprimir: %v", codec, err)
+		}
+		if data, err := decompress(codec, exact, limit); err != nil || len(data) != limit {
+			t.Fatalf("%s: datos del tamaño máximo rechazados: %d bytes, %v", codec, len(data), err)
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	compressible := bytes.Repeat([]byte("sync-service "), 1000)
+	random := make([]byte, 64*1024)
+	rand.Read(random)
+
+	tests := []struct {
+		name     string
+		accepted []string
+		data     []byte
+		want     string
+	}{
+		{"cliente antiguo sin lista", nil, compressible, Gzip},
+		{"cliente antiguo con datos aleatorios", nil, random, Gzip},
+		{"primer códec soportado", []string{Zstd, Gzip}, compressible, Zstd},
+		{"se saltan los desconocidos", []string{"br", Gzip}, compressible, Gzip},
+		{"vacío equivale a gzip", []string{""}, compressible, Gzip},
+		{"incomprimible sin comprimir", []string{Zstd, None}, random, None},
+		{"incomprimible sin aceptar none", []string{Zstd}, random, Zstd},
+		{"solo none", []string{None}, compressible, None},
+		{"ningún códec soportado", []string{"br", "lz4"}, compressible, None},
+	}
+	for _, tt := range tests {
+		if got := Negotiate(tt.accepted, tt.data); got != tt.want {
+			t.Errorf("%s: Negotiate(%v) = %s, se esperaba %s", tt.name, tt.accepted, got, tt.want)
+		}
+	}
+}
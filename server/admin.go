@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	pb "github.com/FelipeMarchantVargas/sync-service/proto"
+	"github.com/FelipeMarchantVargas/sync-service/server/policy"
+	"github.com/FelipeMarchantVargas/sync-service/server/users"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ------------------------ ADMINISTRACIÓN ------------------------
+
+// Servicio de administración: todas sus operaciones piden el rol admin
+type AdminServer struct {
+	pb.UnimplementedAdminServiceServer
+	sync     *SyncServer
+	rotating sync.Mutex // Las rotaciones de clave se hacen de a una
+}
+
+// Convertir los errores de las cuentas en el error gRPC que recibe el cliente
+func userStatus(username string, err error) error {
+	if errors.Is(err, users.ErrNotFound) {
+		return status.Errorf(codes.NotFound, "El usuario %s no existe", username)
+	}
+	log.Printf("[ERROR] Error actualizando la cuenta %s: %v", username, err)
+	return status.Errorf(codes.Internal, "Error actualizando la cuenta %s", username)
+}
+
+// Cambiar el rol de una cuenta. El cambio rige desde el siguiente pedido de la cuenta (checkSession usa el rol guardado).
+func (a *AdminServer) SetRole(ctx context.Context, req *pb.RoleRequest) (*pb.Empty, error) {
+	username, err := authorize(ctx, policy.Admin)
+	if err != nil {
+		return nil, err
+	}
+	if !users.ValidRole(req.Role) {
+		return nil, status.Errorf(codes.InvalidArgument, "Rol no soportado: %s (usa admin, user, read-only o service)", req.Role)
+	}
+
+	// No se puede dejar el servidor sin administradores
+	current := a.sync.users.Role(req.Username)
+	if current == users.RoleAdmin && req.Role != users.RoleAdmin && a.sync.users.CountRole(users.RoleAdmin) == 1 {
+		return nil, status.Errorf(codes.FailedPrecondition, "%s es el único administrador", req.Username)
+	}
+
+	if err := a.sync.users.SetRole(req.Username, req.Role); err != nil {
+		return nil, userStatus(req.Username, err)
+	}
+
+	log.Printf("[SUCCESS] (%s) %s cambió el rol de %s a %s", time.Now().Format("15:04:05"), username, req.Username, req.Role)
+	return &pb.Empty{}, nil
+}
+
+// Listar las cuentas con la cantidad y el tamaño de sus archivos y sus streams conectados
+func (a *AdminServer) ListUsers(ctx context.Context, req *pb.Empty) (*pb.UserList, error) {
+	if _, err := authorize(ctx, policy.Admin); err != nil {
+		return nil, err
+	}
+
+	connections := make(map[string]int32)
+	for _, sub := range a.sync.hub.Subscribers() {
+		connections[sub.User]++
+	}
+
+	resp := &pb.UserList{}
+	for _, user := range a.sync.users.List() {
+		info := &pb.UserInfo{
+			Username:    user.Username,
+			Role:        user.Role,
+			Disabled:    user.Disabled,
+			Created:     user.Created,
+			Connections: connections[user.Username],
+		}
+		entries, err := a.sync.meta.List(user.Username, false)
+		if err != nil {
+			log.Printf("[ERROR] No se pudo leer los archivos de %s: %v", user.Username, err)
+			return nil, status.Errorf(codes.Internal, "Error listando archivos")
+		}
+		for _, entry := range entries {
+			info.Files++
+			info.Bytes += entry.Size
+		}
+		resp.Users = append(resp.Users, info)
+	}
+	return resp, nil
+}
+
+// Deshabilitar una cuenta: no puede iniciar sesión, sus tokens dejan de valer y se cortan sus streams
+func (a *AdminServer) DisableUser(ctx context.Context, req *pb.UserRequest) (*pb.Empty, error) {
+	username, err := authorize(ctx, policy.Admin)
+	if err != nil {
+		return nil, err
+	}
+	if req.Username == username {
+		return nil, status.Errorf(codes.InvalidArgument, "No puedes deshabilitar tu propia cuenta")
+	}
+	if err := a.sync.users.SetDisabled(req.Username, true); err != nil {
+		return nil, userStatus(req.Username, err)
+	}
+	a.sync.hub.Disconnect(req.Username)
+
+	log.Printf("[SUCCESS] (%s) %s deshabilitó la cuenta %s", time.Now().Format("15:04:05"), username, req.Username)
+	return &pb.Empty{}, nil
+}
+
+// Volver a habilitar una cuenta
+func (a *AdminServer) EnableUser(ctx context.Context, req *pb.UserRequest) (*pb.Empty, error) {
+	username, err := authorize(ctx, policy.Admin)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.sync.users.SetDisabled(req.Username, false); err != nil {
+		return nil, userStatus(req.Username, err)
+	}
+
+	log.Printf("[SUCCESS] (%s) %s habilitó la cuenta %s", time.Now().Format("15:04:05"), username, req.Username)
+	return &pb.Empty{}, nil
+}
+
+// Cerrar las sesiones de una cuenta: sus tokens (y refresh tokens) dejan de valer y se cortan sus streams
+func (a *AdminServer) ForceLogout(ctx context.Context, req *pb.UserRequest) (*pb.Empty, error) {
+	username, err := authorize(ctx, policy.Admin)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.sync.users.RevokeTokens(req.Username); err != nil {
+		return nil, userStatus(req.Username, err)
+	}
+	streams := a.sync.hub.Disconnect(req.Username)
+
+	log.Printf("[SUCCESS] (%s) %s cerró las sesiones de %s (%d streams)", time.Now().Format("15:04:05"), username, req.Username, streams)
+	return &pb.Empty{}, nil
+}
+
+// Cambiar la contraseña de una cuenta, cerrando sus sesiones
+func (a *AdminServer) ResetPassword(ctx context.Context, req *pb.PasswordRequest) (*pb.Empty, error) {
+	username, err := authorize(ctx, policy.Admin)
+	if err != nil {
+		return nil, err
+	}
+	if req.Password == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "La contraseña no puede estar vacía")
+	}
+	if err := a.sync.users.SetPassword(req.Username, req.Password); err != nil {
+		return nil, userStatus(req.Username, err)
+	}
+	a.sync.hub.Disconnect(req.Username)
+
+	log.Printf("[SUCCESS] (%s) %s cambió la contraseña de %s", time.Now().Format("15:04:05"), username, req.Username)
+	return &pb.Empty{}, nil
+}
+
+// Listar los streams SyncUpdates conectados, ordenados por usuario y antigüedad
+func (a *AdminServer) ListSubscribers(ctx context.Context, req *pb.Empty) (*pb.SubscriberList, error) {
+	if _, err := authorize(ctx, policy.Admin); err != nil {
+		return nil, err
+	}
+
+	subs := a.sync.hub.Subscribers()
+	sort.Slice(subs, func(i, j int) bool {
+		if subs[i].User != subs[j].User {
+			return subs[i].User < subs[j].User
+		}
+		return subs[i].ConnectedAt.Before(subs[j].ConnectedAt)
+	})
+
+	resp := &pb.SubscriberList{}
+	for _, sub := range subs {
+		resp.Subscribers = append(resp.Subscribers, &pb.Subscriber{
+			Username:    sub.User,
+			Peer:        sub.Peer,
+			Device:      sub.Device,
+			ConnectedAt: sub.ConnectedAt.Unix(),
+			Include:     sub.Filter.Include,
+			Exclude:     sub.Filter.Exclude,
+		})
+	}
+	return resp, nil
+}
+
+// Rotar la clave de un usuario o de un grupo ("team:<grupo>")
+func (a *AdminServer) RotateKey(ctx context.Context, req *pb.UserRequest) (*pb.RotateKeyResponse, error) {
+	username, err := authorize(ctx, policy.Admin)
+	if err != nil {
+		return nil, err
+	}
+	if team, ok := teamName(req.Username); ok {
+		if _, ok := a.sync.groups.Get(team); !ok {
+			return nil, status.Errorf(codes.NotFound, "El grupo %s no existe", team)
+		}
+	} else if !a.sync.users.Exists(req.Username) {
+		return nil, status.Errorf(codes.NotFound, "El usuario %s no existe", req.Username)
+	}
+
+	a.rotating.Lock()
+	defer a.rotating.Unlock()
+	startTime := time.Now()
+	files, err := a.sync.rotateKey(req.Username)
+	if err != nil {
+		log.Printf("[ERROR] No se pudo rotar la clave de %s (%d archivos actualizados): %v", req.Username, files, err)
+		return nil, status.Errorf(codes.Internal, "Error rotando la clave de %s; se puede volver a intentar", req.Username)
+	}
+
+	log.Printf("[SUCCESS] (%s) %s rotó la clave de %s (%d archivos) en %.2f s", time.Now().Format("15:04:05"), username, req.Username, files, time.Since(startTime).Seconds())
+	return &pb.RotateKeyResponse{Files: files}, nil
+}
+
+// Revisar los archivos guardados de un usuario o grupo (o de todos)
+func (a *AdminServer) CheckIntegrity(ctx context.Context, req *pb.UserRequest) (*pb.IntegrityReport, error) {
+	if _, err := authorize(ctx, policy.Admin); err != nil {
+		return nil, err
+	}
+	if req.Username != "" {
+		if _, err := resolvePath(req.Username, "x"); err != nil && !isTeam(req.Username) {
+			return nil, status.Errorf(codes.InvalidArgument, "Usuario inválido: %s", req.Username)
+		}
+	}
+
+	checked, problems, err := a.sync.checkIntegrity(req.Username)
+	if err != nil {
+		log.Printf("[ERROR] No se pudo revisar la integridad de los archivos: %v", err)
+		return nil, status.Errorf(codes.Internal, "Error revisando los archivos")
+	}
+
+	resp := &pb.IntegrityReport{Checked: checked}
+	for _, problem := range problems {
+		resp.Problems = append(resp.Problems, &pb.IntegrityProblem{Owner: problem.Owner, Path: problem.Path, Problem: problem.Problem})
+	}
+	log.Printf("[INFO] (%s) Revisión de integridad: %d archivos, %d problemas", time.Now().Format("15:04:05"), checked, len(problems))
+	return resp, nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	pb "github.com/FelipeMarchantVargas/sync-service/proto"
+	"github.com/FelipeMarchantVargas/sync-service/server/apikeys"
+	"github.com/FelipeMarchantVargas/sync-service/server/policy"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ------------------------ API KEYS ------------------------
+
+// Duración por defecto y máxima de una API key
+const (
+	defaultAPIKeyTTL = 90 * 24 * time.Hour
+	maxAPIKeyTTL     = 365 * 24 * time.Hour
+)
+
+// Usuario y rol de una llamada que administra API keys: se pide una sesión iniciada con contraseña,
+// así una API key filtrada no sirve para crear otras
+func apiKeyOwner(ctx context.Context) (string, string, error) {
+	username, role, err := getIdentityFromContext(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	if apiKeyFromContext(ctx) != nil {
+		return "", "", status.Errorf(codes.PermissionDenied, "Las API keys se administran con una sesión iniciada, no con otra API key")
+	}
+	return username, role, nil
+}
+
+// Datos de una API key para el cliente (sin su hash)
+func apiKeyInfo(key *apikeys.Key) *pb.ApiKey {
+	return &pb.ApiKey{Name: key.Name, Scopes: key.Scopes, Created: key.Created, Expires: key.Expires, LastUsed: key.LastUsed}
+}
+
+// Crear una API key con permisos limitados y fecha de expiración
+func (s *AuthServer) CreateApiKey(ctx context.Context, req *pb.ApiKeyRequest) (*pb.ApiKey, error) {
+	username, role, err := apiKeyOwner(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// 1️⃣ Validar nombre, duración y permisos (una API key no puede tener más permisos que el rol de su dueño)
+	if !apikeys.ValidName(req.Name) {
+		return nil, status.Errorf(codes.InvalidArgument, "Nombre de API key inválido: %q (usa letras, números, '-', '_' o '.')", req.Name)
+	}
+	ttl := time.Duration(req.TtlSeconds) * time.Second
+	if ttl == 0 {
+		ttl = defaultAPIKeyTTL
+	}
+	if ttl < 0 || ttl > maxAPIKeyTTL {
+		return nil, status.Errorf(codes.InvalidArgument, "La duración de una API key debe estar entre 1 segundo y 365 días")
+	}
+	scopes := req.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{string(policy.Read)}
+	}
+	seen := make(map[string]bool)
+	var granted []string
+	for _, scope := range scopes {
+		action, ok := policy.ParseAction(scope)
+		if !ok {
+			return nil, status.Errorf(codes.InvalidArgument, "Permiso desconocido: %s (usa read, write, share, groups o admin)", scope)
+		}
+		if !policy.Allows(role, action) {
+			return nil, status.Errorf(codes.PermissionDenied, "Tu rol (%s) no permite %s", role, action.Describe())
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			granted = append(granted, scope)
+		}
+	}
+
+	// 2️⃣ Crear la API key; solo se guarda su hash
+	token, key, err := s.keys.Create(username, req.Name, granted, ttl)
+	if errors.Is(err, apikeys.ErrExists) {
+		return nil, status.Errorf(codes.AlreadyExists, "Ya tienes una API key llamada %s", req.Name)
+	}
+	if err != nil {
+		log.Printf("[ERROR] No se pudo crear la API key %s de %s: %v", req.Name, username, err)
+		return nil, status.Errorf(codes.Internal, "Error creando la API key")
+	}
+
+	log.Printf("[SUCCESS] (%s) %s creó la API key %s %v (expira %s)", time.Now().Format("15:04:05"), username, req.Name, granted, time.Unix(key.Expires, 0).Format(time.RFC3339))
+	info := apiKeyInfo(key)
+	info.Key = token
+	return info, nil
+}
+
+// Listar las API keys vigentes del usuario
+func (s *AuthServer) ListApiKeys(ctx context.Context, req *pb.Empty) (*pb.ApiKeyList, error) {
+	username, _, err := apiKeyOwner(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp := &pb.ApiKeyList{}
+	for _, key := range s.keys.List(username) {
+		resp.Keys = append(resp.Keys, apiKeyInfo(&key))
+	}
+	return resp, nil
+}
+
+// Revocar una API key del usuario; deja de valer en la siguiente llamada
+func (s *AuthServer) RevokeApiKey(ctx context.Context, req *pb.ApiKeyRequest) (*pb.Empty, error) {
+	username, _, err := apiKeyOwner(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = s.keys.Revoke(username, req.Name)
+	if errors.Is(err, apikeys.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "No tienes una API key llamada %s", req.Name)
+	}
+	if err != nil {
+		log.Printf("[ERROR] No se pudo revocar la API key %s de %s: %v", req.Name, username, err)
+		return nil, status.Errorf(codes.Internal, "Error revocando la API key")
+	}
+
+	log.Printf("[SUCCESS] (%s) %s revocó la API key %s", time.Now().Format("15:04:05"), username, req.Name)
+	return &pb.Empty{}, nil
+}
@@ -0,0 +1,249 @@
+package apikeys
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Archivo por defecto donde se guardan las API keys
+const DefaultFile = "./apikeys.json"
+
+// Prefijo de las API keys, que las distingue de los JWT en el metadata "authorization"
+const Prefix = "sk_"
+
+// Largo máximo del nombre de una API key
+const maxNameLength = 64
+
+// Cada cuánto se guarda a lo más el último uso de una API key
+const lastUsedInterval = time.Minute
+
+var (
+	ErrExists      = errors.New("ya existe una API key con ese nombre")
+	ErrNotFound    = errors.New("la API key no existe")
+	ErrInvalid     = errors.New("API key inválida")
+	ErrExpired     = errors.New("la API key expiró")
+	ErrInvalidName = errors.New("nombre de API key inválido")
+)
+
+// API key de un usuario: se muestra una sola vez al crearla y se guarda solo su hash SHA-256
+type Key struct {
+	ID       string   `json:"id"`
+	Owner    string   `json:"owner"`
+	Name     string   `json:"name"`
+	Hash     string   `json:"hash"`   // SHA-256 de la API key completa (hex)
+	Scopes   []string `json:"scopes"` // Acciones permitidas (read, write, share, groups, admin)
+	Created  int64    `json:"created"`
+	Expires  int64    `json:"expires"` // Momento en que deja de valer (Unix, segundos)
+	LastUsed int64    `json:"last_used,omitempty"`
+}
+
+// Indicar si la API key permite una acción
+func (k *Key) Allows(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// API keys guardadas en un archivo JSON
+type Store struct {
+	file string
+	mu   sync.Mutex
+	keys map[string]*Key // Por ID
+}
+
+// Abrir (o crear vacío) el archivo de API keys, descartando las que ya expiraron
+func Open(file string) (*Store, error) {
+	s := &Store{file: file, keys: make(map[string]*Key)}
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var list []*Key
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+	now := time.Now().Unix()
+	for _, key := range list {
+		if key.Expires > now {
+			s.keys[key.ID] = key
+		}
+	}
+	return s, nil
+}
+
+// Guardar las API keys de forma atómica (debe llamarse con s.mu tomado)
+func (s *Store) save() error {
+	list := make([]*Key, 0, len(s.keys))
+	for _, key := range s.keys {
+		list = append(list, key)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Created < list[j].Created })
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(s.file); dir != "." {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+	}
+	tmp := s.file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.file)
+}
+
+// Hash con que se guarda una API key
+func hashKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Indicar si un token del metadata es una API key
+func IsKey(token string) bool {
+	return strings.HasPrefix(token, Prefix)
+}
+
+// Indicar si un nombre de API key es válido
+func ValidName(name string) bool {
+	if name == "" || len(name) > maxNameLength {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// Crear una API key para un usuario. Devuelve la API key (que no se vuelve a poder obtener) y sus datos.
+func (s *Store) Create(owner, name string, scopes []string, ttl time.Duration) (string, *Key, error) {
+	if !ValidName(name) {
+		return "", nil, ErrInvalidName
+	}
+	idBytes := make([]byte, 8)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", nil, err
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, err
+	}
+	id := hex.EncodeToString(idBytes)
+	token := Prefix + id + "_" + hex.EncodeToString(secret)
+
+	now := time.Now()
+	key := &Key{
+		ID:      id,
+		Owner:   owner,
+		Name:    name,
+		Hash:    hashKey(token),
+		Scopes:  append([]string(nil), scopes...),
+		Created: now.Unix(),
+		Expires: now.Add(ttl).Unix(),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for existingID, existing := range s.keys {
+		if existing.Owner != owner || existing.Name != name {
+			continue
+		}
+		if existing.Expires > now.Unix() {
+			return "", nil, ErrExists
+		}
+		// Una API key expirada deja libre su nombre
+		delete(s.keys, existingID)
+	}
+	s.keys[id] = key
+	if err := s.save(); err != nil {
+		delete(s.keys, id)
+		return "", nil, err
+	}
+	copied := *key
+	return token, &copied, nil
+}
+
+// Listar las API keys vigentes de un usuario, de la más antigua a la más nueva
+func (s *Store) List(owner string) []Key {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().Unix()
+	var list []Key
+	for _, key := range s.keys {
+		if key.Owner == owner && key.Expires > now {
+			list = append(list, *key)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Created < list[j].Created })
+	return list
+}
+
+// Revocar una API key de un usuario por su nombre
+func (s *Store) Revoke(owner, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, key := range s.keys {
+		if key.Owner == owner && key.Name == name {
+			delete(s.keys, id)
+			if err := s.save(); err != nil {
+				s.keys[id] = key
+				return err
+			}
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// Validar una API key recibida en el metadata y registrar su uso
+func (s *Store) Validate(token string) (*Key, error) {
+	rest := strings.TrimPrefix(token, Prefix)
+	id, _, ok := strings.Cut(rest, "_")
+	if !IsKey(token) || !ok {
+		return nil, ErrInvalid
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, found := s.keys[id]
+	if !found || subtle.ConstantTimeCompare([]byte(key.Hash), []byte(hashKey(token))) != 1 {
+		return nil, ErrInvalid
+	}
+	now := time.Now()
+	if now.Unix() >= key.Expires {
+		return nil, ErrExpired
+	}
+
+	// El último uso se guarda como mucho una vez por minuto para no escribir el archivo en cada llamada
+	if now.Unix()-key.LastUsed >= int64(lastUsedInterval.Seconds()) {
+		key.LastUsed = now.Unix()
+		if err := s.save(); err != nil {
+			// La API key sigue valiendo: solo se pierde el registro de su último uso
+			log.Printf("[ERROR] No se pudo guardar el último uso de la API key %s de %s: %v", key.Name, key.Owner, err)
+		}
+	}
+	copied := *key
+	return &copied, nil
+}
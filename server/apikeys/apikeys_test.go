@@ -0,0 +1,146 @@
+package apikeys
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	s, err := Open(filepath.Join(t.TempDir(), "apikeys.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// Vencer una API key sin esperar a que pase su duración
+func expire(s *Store, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[id].Expires = time.Now().Unix() - 1
+}
+
+// El archivo guarda solo el hash de la API key, que se puede validar después de volver a abrirlo
+func TestKeysAreStoredHashed(t *testing.T) {
+	s := newTestStore(t)
+	token, key, err := s.Create("maria", "ci", []string{"read"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsKey(token) || !strings.HasPrefix(token, Prefix+key.ID+"_") {
+		t.Fatalf("formato de API key inesperado: %s", token)
+	}
+
+	data, err := os.ReadFile(s.file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := token[len(Prefix+key.ID+"_"):]
+	if strings.Contains(string(data), secret) {
+		t.Fatal("el archivo contiene la API key")
+	}
+	if !strings.Contains(string(data), hashKey(token)) {
+		t.Fatal("el archivo no contiene el hash de la API key")
+	}
+
+	reopened, err := Open(s.file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	validated, err := reopened.Validate(token)
+	if err != nil {
+		t.Fatalf("API key rechazada al volver a abrir el archivo: %v", err)
+	}
+	if validated.Owner != "maria" || !validated.Allows("read") || validated.Allows("write") {
+		t.Fatalf("API key validada: %+v", validated)
+	}
+
+	// Un secreto distinto con el mismo identificador no vale
+	tampered := token[:len(token)-1] + "x"
+	for _, bad := range []string{tampered, Prefix + key.ID, Prefix + "otro_" + secret, "eyJhbGciOi"} {
+		if _, err := reopened.Validate(bad); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%q: se esperaba ErrInvalid, se obtuvo %v", bad, err)
+		}
+	}
+}
+
+func TestExpiredKeys(t *testing.T) {
+	s := newTestStore(t)
+	token, key, err := s.Create("maria", "ci", []string{"read"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.Create("maria", "ci", []string{"read"}, time.Hour); !errors.Is(err, ErrExists) {
+		t.Fatalf("nombre repetido: se esperaba ErrExists, se obtuvo %v", err)
+	}
+	// Otro usuario puede usar el mismo nombre
+	if _, _, err := s.Create("jose", "ci", []string{"read"}, time.Hour); err != nil {
+		t.Fatalf("mismo nombre de otro usuario: %v", err)
+	}
+
+	expire(s, key.ID)
+	if _, err := s.Validate(token); !errors.Is(err, ErrExpired) {
+		t.Fatalf("API key vencida: se esperaba ErrExpired, se obtuvo %v", err)
+	}
+	if list := s.List("maria"); len(list) != 0 {
+		t.Fatalf("List incluye API keys vencidas: %+v", list)
+	}
+
+	// El nombre de una API key vencida queda libre, y la vencida se descarta
+	newToken, newKey, err := s.Create("maria", "ci", []string{"write"}, time.Hour)
+	if err != nil {
+		t.Fatalf("nombre de una API key vencida: %v", err)
+	}
+	if newKey.ID == key.ID {
+		t.Fatal("la API key nueva reutilizó el identificador")
+	}
+	if _, err := s.Validate(token); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("API key reemplazada: se esperaba ErrInvalid, se obtuvo %v", err)
+	}
+	if _, err := s.Validate(newToken); err != nil {
+		t.Fatalf("API key nueva rechazada: %v", err)
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	s := newTestStore(t)
+	token, _, err := s.Create("maria", "ci", []string{"read"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Revoke("jose", "ci"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("revocar la API key de otro usuario: se esperaba ErrNotFound, se obtuvo %v", err)
+	}
+	if err := s.Revoke("maria", "ci"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Validate(token); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("API key revocada: se esperaba ErrInvalid, se obtuvo %v", err)
+	}
+	if err := s.Revoke("maria", "ci"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("revocar dos veces: se esperaba ErrNotFound, se obtuvo %v", err)
+	}
+
+	// La revocación queda guardada
+	reopened, err := Open(s.file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reopened.Validate(token); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("API key revocada al volver a abrir: se esperaba ErrInvalid, se obtuvo %v", err)
+	}
+}
+
+func TestCreateRejectsInvalidNames(t *testing.T) {
+	s := newTestStore(t)
+	for _, name := range []string{"", "con espacio", "a/b", strings.Repeat("x", maxNameLength+1)} {
+		if _, _, err := s.Create("maria", name, nil, time.Hour); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("nombre %q: se esperaba ErrInvalidName, se obtuvo %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package audit
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Archivo por defecto del registro de auditoría
+const DefaultFile = "./audit.log"
+
+// Tipos de eventos de auditoría
+const (
+	UserLocked  = "user_locked"  // Un usuario quedó bloqueado por intentos fallidos
+	PeerLocked  = "peer_locked"  // Una dirección quedó bloqueada por intentos fallidos
+	RateLimited = "rate_limited" // El límite global de AuthService empezó a rechazar pedidos
+	LinkLocked  = "link_locked"  // Un enlace para compartir quedó bloqueado por contraseñas incorrectas
+)
+
+// Evento de auditoría (una línea JSON del registro)
+type Event struct {
+	Time     time.Time `json:"time"`
+	Type     string    `json:"type"`
+	Username string    `json:"username,omitempty"`
+	Peer     string    `json:"peer,omitempty"`
+	Detail   string    `json:"detail,omitempty"`
+}
+
+// Registro de auditoría: eventos de seguridad que se agregan a un archivo JSON por líneas
+type Log struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+// Abrir (o crear) el registro de auditoría
+func Open(file string) (*Log, error) {
+	if dir := filepath.Dir(file); dir != "." {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, err
+		}
+	}
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &Log{file: f, enc: json.NewEncoder(f)}, nil
+}
+
+// Agregar un evento al registro
+func (l *Log) Record(event Event) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.enc.Encode(event)
+}
@@ -10,10 +10,20 @@ import (
 // Clave secreta (⚠️ Mueve esto a una variable de entorno en producción)
 var jwtSecret = []byte("supersecreto")
 
-// Generar un nuevo token JWT válido por 1 hora
-func GenerateToken(username string) (string, error) {
+// Tipos de token (claim "typ"): el de acceso autoriza las llamadas y el refresh token solo sirve para pedir otro
+const (
+	AccessTokenType  = "access"
+	RefreshTokenType = "refresh"
+)
+
+// Generar un nuevo token JWT válido por 1 hora con el rol del usuario y la versión de sus tokens
+// (al cerrar sus sesiones la versión aumenta y los tokens anteriores dejan de valer)
+func GenerateToken(username, role string, version int64) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"username": username,
+		"role":     role,
+		"ver":      version,
+		"typ":      AccessTokenType,
 		"exp":      time.Now().Add(time.Hour).Unix(), // Expira en 1 hora
 	})
 
@@ -21,9 +31,11 @@ func GenerateToken(username string) (string, error) {
 }
 
 // Generar un Refresh Token válido por 7 días
-func GenerateRefreshToken(username string) (string, error) {
+func GenerateRefreshToken(username string, version int64) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"username": username,
+		"ver":      version,
+		"typ":      RefreshTokenType,
 		"exp":      time.Now().Add(7 * 24 * time.Hour).Unix(), // Expira en 7 días
 	})
 
@@ -53,3 +65,20 @@ func ValidateToken(tokenString string) (*jwt.Token, jwt.MapClaims, error) {
 	return token, claims, nil
 }
 
+// Versión de los tokens indicada en los claims (0 en los emitidos antes de existir)
+func TokenVersion(claims jwt.MapClaims) int64 {
+	version, _ := claims["ver"].(float64)
+	return int64(version)
+}
+
+// Tipo de un token según sus claims. Los emitidos antes de existir el claim se distinguen por el rol,
+// que solo llevan los tokens de acceso.
+func TokenType(claims jwt.MapClaims) string {
+	if typ, ok := claims["typ"].(string); ok {
+		return typ
+	}
+	if _, ok := claims["role"]; ok {
+		return AccessTokenType
+	}
+	return RefreshTokenType
+}
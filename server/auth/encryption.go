@@ -6,6 +6,7 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"errors"
+	"fmt"
 	"io"
 	"log"
 	"os"
@@ -99,3 +100,67 @@ func DecryptData(data []byte, key []byte) ([]byte, error) {
 
 	return data, nil
 }
+
+// Escritor que cifra con AES-256 lo que recibe (mismo formato que EncryptData: el IV y luego los datos),
+// para cifrar un archivo sin tenerlo completo en memoria
+func NewEncryptWriter(w io.Writer, key []byte) (io.Writer, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	iv := make([]byte, aes.BlockSize)
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(iv); err != nil {
+		return nil, err
+	}
+	return cipher.StreamWriter{S: cipher.NewCFBEncrypter(block, iv), W: w}, nil
+}
+
+// Lector que descifra datos cifrados con EncryptData a medida que se leen
+func NewDecryptReader(r io.Reader, key []byte) (io.Reader, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	iv := make([]byte, aes.BlockSize)
+	if _, err := io.ReadFull(r, iv); err != nil {
+		return nil, errors.New("cifrado incorrecto")
+	}
+	return cipher.StreamReader{S: cipher.NewCFBDecrypter(block, iv), R: r}, nil
+}
+
+// Tamaño original de datos cifrados con EncryptData que ocupan size bytes
+func DecryptedSize(size int64) int64 {
+	if size < aes.BlockSize {
+		return 0
+	}
+	return size - aes.BlockSize
+}
+
+// Descifrar solo length bytes desde offset de datos cifrados con EncryptData, leyendo únicamente los bloques
+// necesarios: en CFB cada bloque se descifra con el bloque cifrado anterior (o el IV), así que se puede
+// empezar en cualquiera. El rango debe estar dentro de los datos.
+func DecryptRange(r io.ReaderAt, key []byte, offset, length int64) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	// El bloque cifrado anterior al primero del rango está justo antes de él (el IV si es el primero)
+	first := offset / aes.BlockSize * aes.BlockSize
+	iv := make([]byte, aes.BlockSize)
+	if n, err := r.ReadAt(iv, first); n < len(iv) {
+		return nil, fmt.Errorf("cifrado incorrecto: %v", err)
+	}
+	data := make([]byte, offset-first+length)
+	if n, err := r.ReadAt(data, aes.BlockSize+first); n < len(data) {
+		return nil, fmt.Errorf("cifrado incorrecto: %v", err)
+	}
+
+	cipher.NewCFBDecrypter(block, iv).XORKeyStream(data, data)
+	return data[offset-first:], nil
+}
@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+)
+
+func TestEncryptWriterMatchesDecryptData(t *testing.T) {
+	key, _ := GenerateDataKey()
+	data := make([]byte, 100000)
+	rand.Read(data)
+
+	var sealed bytes.Buffer
+	w, err := NewSealWriter(&sealed, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Escribir en trozos que no coinciden con los bloques de AES
+	for i := 0; i < len(data); i += 777 {
+		end := i + 777
+		if end > len(data) {
+			end = len(data)
+		}
+		w.Write(data[i:end])
+	}
+
+	// OpenData descifra en el mismo buffer
+	opened, err := OpenData(append([]byte{}, sealed.Bytes()...), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(opened, data) {
+		t.Fatal("el contenido cifrado por partes no coincide")
+	}
+	if got := OpenedSize(int64(sealed.Len())); got != int64(len(data)) {
+		t.Fatalf("OpenedSize = %d, se esperaba %d", got, len(data))
+	}
+
+	reader, err := NewOpenReader(bytes.NewReader(sealed.Bytes()), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var streamed bytes.Buffer
+	streamed.ReadFrom(reader)
+	if !bytes.Equal(streamed.Bytes(), data) {
+		t.Fatal("el contenido descifrado por partes no coincide")
+	}
+}
+
+func TestOpenRange(t *testing.T) {
+	key, _ := GenerateDataKey()
+	data := make([]byte, 5000)
+	rand.Read(data)
+	sealed, err := SealData(data, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := bytes.NewReader(sealed)
+
+	ranges := [][2]int64{{0, 0}, {0, 5000}, {0, 1}, {15, 2}, {16, 16}, {17, 100}, {4999, 1}, {5000, 0}, {1234, 2345}}
+	for _, r := range ranges {
+		got, err := OpenRange(file, int64(len(sealed)), key, r[0], r[1])
+		if err != nil {
+			t.Fatalf("rango %v: %v", r, err)
+		}
+		if !bytes.Equal(got, data[r[0]:r[0]+r[1]]) {
+			t.Fatalf("rango %v: el contenido no coincide", r)
+		}
+	}
+
+	if _, err := OpenRange(file, int64(len(sealed)), key, 4990, 20); err == nil {
+		t.Fatal("se esperaba un error para un rango fuera del archivo")
+	}
+	if _, err := OpenRange(bytes.NewReader(sealed[len(sealedMagic):]), int64(len(sealed)-len(sealedMagic)), key, 0, 1); err == nil {
+		t.Fatal("se esperaba un error para un archivo sin clave de datos")
+	}
+}
+
+func TestDecryptRangeLegacy(t *testing.T) {
+	key, _ := GenerateDataKey()
+	data := []byte("contenido cifrado con la clave del dueño, en el formato anterior")
+	encrypted, err := EncryptData(data, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if DecryptedSize(int64(len(encrypted))) != int64(len(data)) {
+		t.Fatal("DecryptedSize no coincide")
+	}
+	got, err := DecryptRange(bytes.NewReader(encrypted), key, 10, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data[10:30]) {
+		t.Fatal("el contenido no coincide")
+	}
+}
@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+)
+
+// Cifrado en sobre: cada archivo se cifra con su propia clave de datos (DEK) y esa clave se guarda
+// envuelta con la clave de cada usuario que puede leerlo. Así se comparte un archivo sin entregar
+// la clave del dueño y se revoca un acceso borrando solo la clave envuelta de ese usuario.
+
+// Prefijo de los archivos cifrados con una clave de datos (los anteriores se cifraban con la clave del usuario)
+var sealedMagic = []byte("SYNCENV1")
+
+// Generar una clave de datos AES-256 para un archivo
+func GenerateDataKey() ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Envolver una clave de datos con la clave de un usuario (AES-GCM, en hex)
+func WrapKey(dataKey, userKey []byte) (string, error) {
+	gcm, err := newGCM(userKey)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(gcm.Seal(nonce, nonce, dataKey, nil)), nil
+}
+
+// Recuperar una clave de datos envuelta con la clave de un usuario
+func UnwrapKey(wrapped string, userKey []byte) ([]byte, error) {
+	data, err := hex.DecodeString(wrapped)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(userKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("clave envuelta incorrecta")
+	}
+	nonce, sealed := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	key, err := gcm.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return nil, errors.New("no se pudo desenvolver la clave del archivo")
+	}
+	return key, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Cifrar el contenido de un archivo con su clave de datos
+func SealData(data, dataKey []byte) ([]byte, error) {
+	encrypted, err := EncryptData(data, dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]byte{}, sealedMagic...), encrypted...), nil
+}
+
+// Descifrar el contenido de un archivo cifrado con SealData
+func OpenData(data, dataKey []byte) ([]byte, error) {
+	if !IsSealed(data) {
+		return nil, errors.New("el archivo no está cifrado con una clave de datos")
+	}
+	return DecryptData(data[len(sealedMagic):], dataKey)
+}
+
+// Indicar si un archivo cifrado usa una clave de datos propia (si no, está cifrado con la clave del dueño)
+func IsSealed(data []byte) bool {
+	return bytes.HasPrefix(data, sealedMagic)
+}
+
+// Escritor que cifra un archivo con su clave de datos a medida que lo recibe (mismo formato que SealData)
+func NewSealWriter(w io.Writer, dataKey []byte) (io.Writer, error) {
+	if _, err := w.Write(sealedMagic); err != nil {
+		return nil, err
+	}
+	return NewEncryptWriter(w, dataKey)
+}
+
+// Lector que descifra un archivo cifrado con SealData a medida que se lee (como OpenData, sin tenerlo completo)
+func NewOpenReader(r io.Reader, dataKey []byte) (io.Reader, error) {
+	prefix := make([]byte, len(sealedMagic))
+	if _, err := io.ReadFull(r, prefix); err != nil || !IsSealed(prefix) {
+		return nil, errors.New("el archivo no está cifrado con una clave de datos")
+	}
+	return NewDecryptReader(r, dataKey)
+}
+
+// Indicar si el archivo que se lee de r usa una clave de datos propia (como IsSealed, sin leerlo completo)
+func IsSealedAt(r io.ReaderAt) bool {
+	prefix := make([]byte, len(sealedMagic))
+	n, _ := r.ReadAt(prefix, 0)
+	return n == len(prefix) && IsSealed(prefix)
+}
+
+// Tamaño original de un archivo cifrado con SealData que ocupa size bytes
+func OpenedSize(size int64) int64 {
+	return DecryptedSize(size - int64(len(sealedMagic)))
+}
+
+// Descifrar solo length bytes desde offset de un archivo cifrado con SealData (ver DecryptRange)
+func OpenRange(r io.ReaderAt, size int64, dataKey []byte, offset, length int64) ([]byte, error) {
+	if !IsSealedAt(r) {
+		return nil, errors.New("el archivo no está cifrado con una clave de datos")
+	}
+	section := io.NewSectionReader(r, int64(len(sealedMagic)), size-int64(len(sealedMagic)))
+	return DecryptRange(section, dataKey, offset, length)
+}
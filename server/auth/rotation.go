@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"crypto/rand"
+	"errors"
+	"os"
+)
+
+// Rotación de claves: la clave nueva se guarda primero como <usuario>.key.next y las claves de datos de
+// los archivos se vuelven a envolver con ella; al terminar reemplaza a la anterior. Mientras tanto los
+// archivos nuevos se envuelven con la clave nueva y se aceptan ambas, así que una rotación interrumpida
+// se puede retomar sin perder acceso a nada.
+
+func pendingKeyFile(username string) string {
+	return keyStorageDir + "/" + username + ".key.next"
+}
+
+// Clave nueva de una rotación en curso (false si no hay una)
+func PendingAESKey(username string) ([]byte, bool) {
+	key, err := os.ReadFile(pendingKeyFile(username))
+	if err != nil || len(key) != 32 {
+		return nil, false
+	}
+	return key, true
+}
+
+// Iniciar (o retomar) la rotación de la clave de un usuario y devolver la clave nueva
+func BeginKeyRotation(username string) ([]byte, error) {
+	if key, ok := PendingAESKey(username); ok {
+		return key, nil
+	}
+	if _, err := GetAESKey(username); err != nil {
+		return nil, err
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	tmp := pendingKeyFile(username) + ".tmp"
+	if err := os.WriteFile(tmp, key, 0600); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp, pendingKeyFile(username)); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Terminar la rotación: la clave nueva reemplaza a la anterior
+func CompleteKeyRotation(username string) error {
+	if _, ok := PendingAESKey(username); !ok {
+		return errors.New("no hay una rotación de clave en curso")
+	}
+	return os.Rename(pendingKeyFile(username), keyStorageDir+"/"+username+".key")
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FelipeMarchantVargas/sync-service/server/audit"
+	"github.com/FelipeMarchantVargas/sync-service/server/throttle"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// ------------------------ PROTECCIÓN CONTRA FUERZA BRUTA ------------------------
+
+// Bloqueos por intentos fallidos de Login: el primero dura lockoutBase y cada fallo siguiente lo duplica
+// hasta lockoutMax. Los fallos se olvidan tras lockoutReset sin fallar.
+const (
+	lockoutBase  = 30 * time.Second
+	lockoutMax   = time.Hour
+	lockoutReset = 15 * time.Minute
+)
+
+// Una dirección puede fallar más veces que un usuario antes de bloquearse (varias personas pueden
+// compartir una IP)
+const peerAttemptsFactor = 4
+
+// Prefijo de los métodos del servicio de autenticación
+const authServicePrefix = "/sync.AuthService/"
+
+// Protección de AuthService: bloqueo exponencial por usuario y por dirección en Login y un límite
+// global de pedidos por segundo. También bloquea los enlaces para compartir (y las direcciones) que
+// reciben contraseñas incorrectas. Los bloqueos se anotan en el registro de auditoría.
+type loginGuard struct {
+	clock  throttle.Clock
+	users  *throttle.Lockout
+	peers  *throttle.Lockout
+	links  *throttle.Lockout
+	bucket *throttle.Bucket
+	audit  *audit.Log
+
+	mu       sync.Mutex
+	limiting bool // El límite global está rechazando pedidos (para anotar solo cuando empieza)
+}
+
+// Crear la protección: attempts es la cantidad de fallos seguidos que bloquea a un usuario, y rate y burst
+// el límite global de pedidos a AuthService
+func newLoginGuard(clock throttle.Clock, attempts int, rate float64, burst int, auditLog *audit.Log) *loginGuard {
+	return &loginGuard{
+		clock:  clock,
+		users:  throttle.NewLockout(clock, attempts, lockoutBase, lockoutMax, lockoutReset),
+		peers:  throttle.NewLockout(clock, attempts*peerAttemptsFactor, lockoutBase, lockoutMax, lockoutReset),
+		links:  throttle.NewLockout(clock, attempts, lockoutBase, lockoutMax, lockoutReset),
+		bucket: throttle.NewBucket(clock, rate, burst),
+		audit:  auditLog,
+	}
+}
+
+// Dirección (sin puerto) desde donde llega un pedido
+func peerHost(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	addr := p.Addr.String()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// Anotar un evento en el registro de auditoría y en el log
+func (g *loginGuard) record(event audit.Event) {
+	event.Time = g.clock.Now()
+	log.WithField("audit", event.Type).Printf("[AUDIT] (%s) %s usuario=%s dirección=%s %s", event.Time.Format("15:04:05"), event.Type, event.Username, event.Peer, event.Detail)
+	if err := g.audit.Record(event); err != nil {
+		log.Printf("[ERROR] No se pudo escribir el registro de auditoría: %v", err)
+	}
+}
+
+// Rechazar un intento de Login si el usuario o la dirección están bloqueados
+func (g *loginGuard) check(username, host string) error {
+	wait, locked := g.users.Locked(username)
+	if peerWait, peerLocked := g.peers.Locked(host); peerLocked && peerWait > wait {
+		wait, locked = peerWait, true
+	}
+	if locked {
+		return status.Errorf(codes.ResourceExhausted, "Demasiados intentos fallidos; intenta de nuevo en %s", wait.Round(time.Second))
+	}
+	return nil
+}
+
+// Registrar un intento fallido, bloqueando al usuario o la dirección si corresponde
+func (g *loginGuard) failure(username, host string) {
+	if lock := g.users.Failure(username); lock > 0 {
+		g.record(audit.Event{Type: audit.UserLocked, Username: username, Peer: host, Detail: fmt.Sprintf("bloqueado por %s", lock)})
+	}
+	if lock := g.peers.Failure(host); lock > 0 {
+		g.record(audit.Event{Type: audit.PeerLocked, Username: username, Peer: host, Detail: fmt.Sprintf("bloqueada por %s", lock)})
+	}
+}
+
+// Olvidar los fallos de un usuario después de un Login correcto (los de la dirección se olvidan con el tiempo)
+func (g *loginGuard) success(username string) {
+	g.users.Success(username)
+}
+
+// Tiempo que falta para poder probar otra contraseña en un enlace desde una dirección (0 si se puede ya)
+func (g *loginGuard) checkLink(id, host string) time.Duration {
+	wait, _ := g.links.Locked(id)
+	if peerWait, _ := g.peers.Locked(host); peerWait > wait {
+		wait = peerWait
+	}
+	return wait
+}
+
+// Registrar una contraseña incorrecta en un enlace, bloqueando el enlace o la dirección si corresponde
+func (g *loginGuard) linkFailure(id, host string) {
+	if lock := g.links.Failure(id); lock > 0 {
+		g.record(audit.Event{Type: audit.LinkLocked, Peer: host, Detail: fmt.Sprintf("enlace %s bloqueado por %s", id, lock)})
+	}
+	if lock := g.peers.Failure(host); lock > 0 {
+		g.record(audit.Event{Type: audit.PeerLocked, Peer: host, Detail: fmt.Sprintf("bloqueada por %s", lock)})
+	}
+}
+
+// Olvidar los fallos de un enlace después de una contraseña correcta
+func (g *loginGuard) linkSuccess(id string) {
+	g.links.Success(id)
+}
+
+// Interceptor que aplica el límite global a los pedidos de AuthService
+func (g *loginGuard) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if !strings.HasPrefix(info.FullMethod, authServicePrefix) {
+		return handler(ctx, req)
+	}
+
+	allowed := g.bucket.Allow()
+	g.mu.Lock()
+	started := !allowed && !g.limiting
+	g.limiting = !allowed
+	g.mu.Unlock()
+	if started {
+		g.record(audit.Event{Type: audit.RateLimited, Peer: peerHost(ctx), Detail: info.FullMethod})
+	}
+	if !allowed {
+		return nil, status.Errorf(codes.ResourceExhausted, "Demasiados pedidos de autenticación; intenta de nuevo en unos segundos")
+	}
+	return handler(ctx, req)
+}
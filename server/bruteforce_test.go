@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/FelipeMarchantVargas/sync-service/server/audit"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Reloj que solo avanza cuando la prueba lo pide
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+// Protección con un reloj falso y su registro de auditoría en un archivo temporal
+func newTestGuard(t *testing.T, attempts int, rate float64, burst int) (*loginGuard, *fakeClock, string) {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "audit.log")
+	auditLog, err := audit.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	return newLoginGuard(clock, attempts, rate, burst, auditLog), clock, file
+}
+
+// Eventos escritos en el registro de auditoría
+func readAudit(t *testing.T, file string) []audit.Event {
+	t.Helper()
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var events []audit.Event
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var event audit.Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestLoginGuardLocksUser(t *testing.T) {
+	g, clock, file := newTestGuard(t, 3, 100, 100)
+
+	// Los fallos de un usuario cuentan desde cualquier dirección
+	for i := 0; i < 3; i++ {
+		if err := g.check("maria", "10.0.0.1"); err != nil {
+			t.Fatalf("intento %d rechazado antes del bloqueo: %v", i+1, err)
+		}
+		g.failure("maria", fmt.Sprintf("10.0.0.%d", i+1))
+	}
+	if err := g.check("maria", "10.0.0.9"); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("se esperaba ResourceExhausted para un usuario bloqueado, se obtuvo %v", err)
+	}
+	if err := g.check("pedro", "10.0.0.1"); err != nil {
+		t.Fatalf("el bloqueo de un usuario afectó a otro: %v", err)
+	}
+
+	events := readAudit(t, file)
+	if len(events) != 1 || events[0].Type != audit.UserLocked || events[0].Username != "maria" || events[0].Peer != "10.0.0.3" {
+		t.Fatalf("registro de auditoría inesperado: %+v", events)
+	}
+	if !events[0].Time.Equal(clock.Now()) {
+		t.Fatalf("el evento no usa el reloj de la protección: %s", events[0].Time)
+	}
+
+	clock.Advance(lockoutBase)
+	if err := g.check("maria", "10.0.0.1"); err != nil {
+		t.Fatalf("el bloqueo sigue después de expirar: %v", err)
+	}
+	g.success("maria")
+	g.failure("maria", "10.0.0.1")
+	if err := g.check("maria", "10.0.0.1"); err != nil {
+		t.Fatalf("los fallos siguen contando después de un login correcto: %v", err)
+	}
+}
+
+func TestLoginGuardPeerThreshold(t *testing.T) {
+	const attempts = 2
+	g, _, file := newTestGuard(t, attempts, 100, 100)
+
+	// Una dirección se bloquea con peerAttemptsFactor veces más fallos que un usuario, aunque cada uno sea
+	// de un usuario distinto
+	for i := 0; i < attempts*peerAttemptsFactor-1; i++ {
+		g.failure(fmt.Sprintf("usuario%d", i), "10.0.0.1")
+	}
+	if err := g.check("nuevo", "10.0.0.1"); err != nil {
+		t.Fatalf("la dirección se bloqueó antes del umbral: %v", err)
+	}
+	g.failure("otro", "10.0.0.1")
+	if err := g.check("nuevo", "10.0.0.1"); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("se esperaba ResourceExhausted para una dirección bloqueada, se obtuvo %v", err)
+	}
+	if err := g.check("nuevo", "10.0.0.2"); err != nil {
+		t.Fatalf("el bloqueo de una dirección afectó a otra: %v", err)
+	}
+
+	events := readAudit(t, file)
+	if len(events) != 1 || events[0].Type != audit.PeerLocked || events[0].Peer != "10.0.0.1" || events[0].Username != "otro" {
+		t.Fatalf("registro de auditoría inesperado: %+v", events)
+	}
+}
+
+func TestLoginGuardRateLimit(t *testing.T) {
+	g, clock, file := newTestGuard(t, 5, 1, 2)
+
+	calls := 0
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		calls++
+		return nil, nil
+	}
+	call := func(method string) error {
+		_, err := g.unaryInterceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+		return err
+	}
+	login := authServicePrefix + "Login"
+
+	// Se admite la ráfaga y después se rechaza; solo se anota cuando empieza a rechazar
+	for i := 0; i < 5; i++ {
+		err := call(login)
+		if i < 2 && err != nil {
+			t.Fatalf("pedido %d rechazado dentro de la ráfaga: %v", i+1, err)
+		}
+		if i >= 2 && status.Code(err) != codes.ResourceExhausted {
+			t.Fatalf("pedido %d: se esperaba ResourceExhausted, se obtuvo %v", i+1, err)
+		}
+	}
+	if err := call("/sync.SyncService/ListFiles"); err != nil {
+		t.Fatalf("el límite se aplicó fuera de AuthService: %v", err)
+	}
+	if calls != 3 {
+		t.Fatalf("el handler se llamó %d veces, se esperaban 3", calls)
+	}
+	if events := readAudit(t, file); len(events) != 1 || events[0].Type != audit.RateLimited || events[0].Detail != login {
+		t.Fatalf("registro de auditoría inesperado: %+v", events)
+	}
+
+	// Al recargarse vuelve a admitir, y un nuevo periodo de rechazos se anota otra vez
+	clock.Advance(time.Second)
+	if err := call(login); err != nil {
+		t.Fatalf("pedido rechazado después de recargar: %v", err)
+	}
+	call(login)
+	call(login)
+	if events := readAudit(t, file); len(events) != 2 || events[1].Type != audit.RateLimited {
+		t.Fatalf("se esperaban dos eventos rate_limited: %+v", events)
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	pb "github.com/FelipeMarchantVargas/sync-service/proto"
+	"github.com/FelipeMarchantVargas/sync-service/server/hub"
+	"github.com/FelipeMarchantVargas/sync-service/server/meta"
+	"github.com/fsnotify/fsnotify"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+// Clave de la metadata gRPC con el identificador del dispositivo del cliente
+const deviceMetadataKey = "device-id"
+
+// Tiempo sin eventos que espera el watcher antes de revisar un archivo (una copia genera varios eventos)
+const externalChangeQuietPeriod = 500 * time.Millisecond
+
+// ------------------------ EVENTOS DE CAMBIOS ------------------------
+
+// Obtener el dispositivo que origina la llamada (vacío si el cliente no lo envía)
+func getDeviceFromContext(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	devices := md[deviceMetadataKey]
+	if len(devices) == 0 {
+		return ""
+	}
+	return devices[0]
+}
+
+// Normalizar las carpetas de una suscripción selectiva
+func subscriptionFilter(req *pb.SyncRequest) (hub.Filter, error) {
+	var filter hub.Filter
+	for _, dir := range req.Include {
+		dir, err := cleanPath(dir)
+		if err != nil {
+			return filter, err
+		}
+		filter.Include = append(filter.Include, dir)
+	}
+	for _, dir := range req.Exclude {
+		dir, err := cleanPath(dir)
+		if err != nil {
+			return filter, err
+		}
+		filter.Exclude = append(filter.Exclude, dir)
+	}
+	return filter, nil
+}
+
+// Construir el evento de un cambio a partir de los metadatos del archivo
+func fileUpdate(username string, entry *meta.FileMeta, action string) *pb.FileUpdate {
+	return &pb.FileUpdate{
+		Filename:  entry.Path,
+		Action:    action,
+		Timestamp: entry.ModTime,
+		User:      username,
+		Path:      entry.Path,
+		Version:   entry.Version,
+		Size:      entry.Size,
+		Hash:      entry.Hash,
+		Device:    entry.Device,
+	}
+}
+
+// Registrar un cambio en el journal y notificarlo a los clientes conectados del dueño
+// y de los usuarios con los que compartió el archivo. Se llama con el índice del dueño tomado
+// (meta.UpdateThen), para que las secuencias sigan el orden de las versiones.
+func (s *SyncServer) publishChange(owner string, entry *meta.FileMeta, action string) {
+	s.publishShared(owner, entry, fileUpdate(owner, entry, action))
+}
+
+// Registrar y notificar que un archivo se movió desde otra ruta
+func (s *SyncServer) publishMove(owner string, entry *meta.FileMeta, from string) {
+	update := fileUpdate(owner, entry, "renamed")
+	update.PreviousPath = from
+	s.publishShared(owner, entry, update)
+}
+
+// Publicar un cambio al dueño y a cada usuario con acceso al archivo, que lo recibe con la ruta "user:<dueño>/<ruta>".
+// Los cambios de un espacio de grupo se publican a todos sus miembros como "team:<grupo>/<ruta>".
+func (s *SyncServer) publishShared(owner string, entry *meta.FileMeta, update *pb.FileUpdate) {
+	if team, ok := teamName(owner); ok {
+		group, ok := s.groups.Get(team)
+		if !ok {
+			return
+		}
+		for _, member := range group.Usernames() {
+			s.publish(member, sharedUpdate(owner, update))
+		}
+		return
+	}
+
+	s.publish(owner, update)
+
+	grantees := make([]string, 0, len(entry.Shares))
+	for grantee := range entry.Shares {
+		grantees = append(grantees, grantee)
+	}
+	sort.Strings(grantees)
+	for _, grantee := range grantees {
+		s.publish(grantee, sharedUpdate(owner, update))
+	}
+}
+
+// Avisar a un usuario que se le dio ("shared") o se le quitó ("unshared") el acceso a un archivo
+func (s *SyncServer) publishShare(owner, grantee string, entry *meta.FileMeta, action string) {
+	update := sharedUpdate(owner, fileUpdate(owner, entry, action))
+	update.Device = "" // No lo originó ningún dispositivo del usuario: todos deben recibirlo
+	s.publish(grantee, update)
+}
+
+// Copia de un evento con las rutas que ve un usuario que no es dueño del archivo
+func sharedUpdate(owner string, update *pb.FileUpdate) *pb.FileUpdate {
+	shared := proto.Clone(update).(*pb.FileUpdate)
+	shared.Filename = externalPath(owner, update.Filename)
+	shared.Path = externalPath(owner, update.Path)
+	if update.PreviousPath != "" {
+		shared.PreviousPath = externalPath(owner, update.PreviousPath)
+	}
+	return shared
+}
+
+func (s *SyncServer) publish(username string, change *pb.FileUpdate) {
+	update, err := s.journal.Append(username, change)
+	if err != nil {
+		log.Printf("[ERROR] No se pudo registrar el cambio de %s en el journal de %s: %v", change.Path, username, err)
+		return
+	}
+	s.hub.Publish(username, update)
+}
+
+// Iniciar watcher sobre todo el árbol de almacenamiento para detectar cambios hechos fuera del servidor
+// (p. ej. un administrador restaurando archivos). Los cambios hechos por los handlers ya se notifican solos.
+func (s *SyncServer) watchServerDirectory() {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Fatalf("[ERROR] No se pudo iniciar el watcher en el servidor: %v", err)
+	}
+	defer watcher.Close()
+
+	if err := addWatchRecursive(watcher, storageDir); err != nil {
+		log.Fatalf("[ERROR] No se pudo observar el directorio: %v", err)
+	}
+
+	log.Println("[INFO] Monitoreando cambios externos en el servidor...")
+
+	// Un temporizador por archivo: se revisa cuando deja de recibir eventos
+	pending := make(map[string]*time.Timer)
+	var pendingMu sync.Mutex
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+
+			// Directorio nuevo (de un usuario o una subcarpeta): empezar a observarlo
+			if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+				if event.Op&fsnotify.Create == fsnotify.Create {
+					addWatchRecursive(watcher, event.Name)
+				}
+				continue
+			}
+
+			// storage/<usuario>/<ruta>.enc
+			rel, err := filepath.Rel(storageDir, event.Name)
+			if err != nil {
+				continue
+			}
+			parts := strings.SplitN(filepath.ToSlash(rel), "/", 2)
+			if len(parts) != 2 || !strings.HasSuffix(parts[1], ".enc") || strings.HasPrefix(filepath.Base(parts[1]), ".") {
+				continue
+			}
+			username, path := parts[0], strings.TrimSuffix(parts[1], ".enc")
+
+			pendingMu.Lock()
+			if timer, ok := pending[event.Name]; ok {
+				timer.Stop()
+			}
+			name := event.Name
+			pending[name] = time.AfterFunc(externalChangeQuietPeriod, func() {
+				pendingMu.Lock()
+				delete(pending, name)
+				pendingMu.Unlock()
+				s.reconcileExternalChange(username, path)
+			})
+			pendingMu.Unlock()
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("[ERROR] Error en watcher del servidor: %v", err)
+		}
+	}
+}
+
+// Observar un directorio y todos sus subdirectorios
+func addWatchRecursive(watcher *fsnotify.Watcher, root string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return watcher.Add(path)
+		}
+		return nil
+	})
+}
+
+// Comparar un archivo del disco con sus metadatos y registrar el cambio si no lo hizo el servidor
+func (s *SyncServer) reconcileExternalChange(username, path string) {
+	var action string
+	entry, err := s.meta.UpdateThen(username, path, func(current *meta.FileMeta) (*meta.FileMeta, error) {
+		encryptedData, err := os.ReadFile(userFilePath(username, path))
+		if os.IsNotExist(err) {
+			if current == nil || current.Deleted {
+				return nil, nil // Borrado ya registrado por DeleteFile
+			}
+			next := *current
+			next.Version++
+			next.Deleted = true
+			next.ModTime = time.Now().Unix()
+			next.Device = ""
+			action = "deleted"
+			return &next, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := decryptFor(username, username, current, encryptedData)
+		if err != nil {
+			return nil, err
+		}
+
+		hash := hashData(data)
+		if current != nil && !current.Deleted && current.Hash == hash {
+			return nil, nil // Escritura hecha por el propio servidor
+		}
+
+		next := &meta.FileMeta{Version: 1, Size: int64(len(data)), Hash: hash, ModTime: time.Now().Unix()}
+		action = "created"
+		if current != nil {
+			next.Version = current.Version + 1
+			next.Keys = current.Keys
+			if !current.Deleted {
+				action = "modified"
+				next.Mode = current.Mode // El contenido cambió fuera del servidor; los permisos y accesos se conservan
+				next.Shares = current.Shares
+			}
+		}
+		return next, nil
+	}, func(next *meta.FileMeta) {
+		s.publishChange(username, next, action)
+	})
+	if err != nil {
+		log.Printf("[ERROR] No se pudo revisar el cambio externo de %s (%s): %v", path, username, err)
+		return
+	}
+	if entry == nil {
+		return
+	}
+
+	log.Printf("[INFO] Cambio externo en el servidor: %s %s (%s)", action, path, username)
+}
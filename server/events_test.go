@@ -0,0 +1,63 @@
+package main
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/FelipeMarchantVargas/sync-service/server/hub"
+)
+
+// Escrituras simultáneas al mismo archivo: el journal y los suscriptores reciben los cambios en el orden de sus versiones
+func TestConcurrentWritesPublishInVersionOrder(t *testing.T) {
+	s := newTestServer(t)
+	if err := ensureUserKey("alice"); err != nil {
+		t.Fatal(err)
+	}
+	sub := s.hub.Subscribe("alice", "", "", hub.Filter{})
+
+	const writers, writes = 8, 25
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < writes; i++ {
+				content := bytesContent([]byte{byte(w), byte(i)})
+				if _, err := s.commitFile("alice", "doc.txt", "alice", content, "", nil, uploadAttrs(0644, 0, "")); err != nil {
+					t.Error(err)
+					return
+				}
+				if i%5 == 0 {
+					if _, err := s.moveFile("alice", "doc.txt", "otro.txt", "alice", "", nil); err == nil {
+						s.moveFile("alice", "otro.txt", "doc.txt", "alice", "", nil)
+					}
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	changes, _, err := s.journal.Since("alice", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lastVersion := make(map[string]int64)
+	for i, change := range changes {
+		if change.Sequence != int64(i+1) {
+			t.Fatalf("secuencia %d en la posición %d", change.Sequence, i)
+		}
+		if change.Version <= lastVersion[change.Path] {
+			t.Fatalf("journal: versión %d de %s después de la %d", change.Version, change.Path, lastVersion[change.Path])
+		}
+		lastVersion[change.Path] = change.Version
+	}
+
+	var lastSequence int64
+	for range changes {
+		update := <-sub.Updates()
+		if update.Sequence <= lastSequence {
+			t.Fatalf("suscriptor: secuencia %d después de la %d", update.Sequence, lastSequence)
+		}
+		lastSequence = update.Sequence
+	}
+}
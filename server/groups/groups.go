@@ -0,0 +1,265 @@
+package groups
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Archivo por defecto donde se guardan los grupos
+const DefaultFile = "./groups.json"
+
+// Roles de los miembros de un grupo
+const (
+	RoleOwner  = "owner"  // Administra los miembros y modifica los archivos
+	RoleMember = "member" // Modifica los archivos del grupo
+	RoleViewer = "viewer" // Solo descarga los archivos del grupo
+)
+
+var (
+	ErrExists     = errors.New("el grupo ya existe")
+	ErrNotFound   = errors.New("el grupo no existe")
+	ErrNotMember  = errors.New("el usuario no es miembro del grupo")
+	ErrLastOwner  = errors.New("el grupo debe tener al menos un dueño")
+	ErrNotAllowed = errors.New("solo un dueño del grupo puede hacer esto")
+)
+
+// Largo máximo del nombre de un grupo
+const maxNameLength = 64
+
+// Validar el nombre de un grupo: letras, dígitos, '.', '_' y '-' (se usa como nombre de carpeta y en las rutas "team:<grupo>/...")
+func ValidName(name string) error {
+	if name == "" || len(name) > maxNameLength {
+		return fmt.Errorf("el nombre del grupo debe tener entre 1 y %d caracteres", maxNameLength)
+	}
+	if name == "." || name == ".." {
+		return fmt.Errorf("nombre de grupo inválido: %s", name)
+	}
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+		default:
+			return fmt.Errorf("nombre de grupo inválido: %s (usa letras, dígitos, '.', '_' o '-')", name)
+		}
+	}
+	return nil
+}
+
+// Indicar si un rol es válido
+func ValidRole(role string) bool {
+	return role == RoleOwner || role == RoleMember || role == RoleViewer
+}
+
+// Indicar si un rol permite modificar los archivos del grupo
+func CanWrite(role string) bool {
+	return role == RoleOwner || role == RoleMember
+}
+
+// Grupo de usuarios con un espacio de archivos propio
+type Group struct {
+	Name    string            `json:"name"`
+	Members map[string]string `json:"members"`         // Usuario -> rol
+	Quota   int64             `json:"quota,omitempty"` // Bytes que pueden ocupar sus archivos (0 = sin límite)
+	Created int64             `json:"created"`         // Momento de creación (Unix, segundos)
+}
+
+func (g *Group) clone() *Group {
+	copied := *g
+	copied.Members = make(map[string]string, len(g.Members))
+	for user, role := range g.Members {
+		copied.Members[user] = role
+	}
+	return &copied
+}
+
+// Miembros del grupo ordenados por nombre
+func (g *Group) Usernames() []string {
+	names := make([]string, 0, len(g.Members))
+	for user := range g.Members {
+		names = append(names, user)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Grupos guardados en un archivo JSON
+type Store struct {
+	file   string
+	mu     sync.Mutex
+	groups map[string]*Group
+}
+
+// Abrir (o crear vacío) el archivo de grupos
+func Open(file string) (*Store, error) {
+	s := &Store{file: file, groups: make(map[string]*Group)}
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var list []*Group
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+	for _, group := range list {
+		s.groups[group.Name] = group
+	}
+	return s, nil
+}
+
+// Guardar los grupos de forma atómica (debe llamarse con s.mu tomado)
+func (s *Store) save() error {
+	list := make([]*Group, 0, len(s.groups))
+	for _, group := range s.groups {
+		list = append(list, group)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(s.file); dir != "." {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+	}
+	tmp := s.file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.file)
+}
+
+// Crear un grupo con su creador como dueño
+func (s *Store) Create(name, owner string, quota int64) (*Group, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.groups[name]; ok {
+		return nil, ErrExists
+	}
+	group := &Group{Name: name, Members: map[string]string{owner: RoleOwner}, Quota: quota, Created: time.Now().Unix()}
+	s.groups[name] = group
+	if err := s.save(); err != nil {
+		delete(s.groups, name)
+		return nil, err
+	}
+	return group.clone(), nil
+}
+
+// Obtener un grupo
+func (s *Store) Get(name string) (*Group, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	group, ok := s.groups[name]
+	if !ok {
+		return nil, false
+	}
+	return group.clone(), true
+}
+
+// Rol de un usuario en un grupo (vacío si no es miembro o el grupo no existe)
+func (s *Store) Role(name, username string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if group, ok := s.groups[name]; ok {
+		return group.Members[username]
+	}
+	return ""
+}
+
+// Grupos de los que un usuario es miembro, ordenados por nombre
+func (s *Store) ForMember(username string) []*Group {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []*Group
+	for _, group := range s.groups {
+		if group.Members[username] != "" {
+			list = append(list, group.clone())
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Modificar un grupo de forma atómica; salvo que se indique lo contrario, solo un dueño del grupo (actor) puede hacerlo.
+// fn recibe una copia del grupo y la modifica; el grupo debe seguir teniendo al menos un dueño.
+func (s *Store) update(name, actor string, ownerOnly bool, fn func(group *Group) error) (*Group, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, ok := s.groups[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if ownerOnly && current.Members[actor] != RoleOwner {
+		return nil, ErrNotAllowed
+	}
+
+	next := current.clone()
+	if err := fn(next); err != nil {
+		return nil, err
+	}
+	owners := 0
+	for _, role := range next.Members {
+		if role == RoleOwner {
+			owners++
+		}
+	}
+	if owners == 0 {
+		return nil, ErrLastOwner
+	}
+
+	s.groups[name] = next
+	if err := s.save(); err != nil {
+		s.groups[name] = current
+		return nil, err
+	}
+	return next.clone(), nil
+}
+
+// Agregar un miembro al grupo o cambiar su rol
+func (s *Store) SetMember(name, actor, username, role string) (*Group, error) {
+	if !ValidRole(role) {
+		return nil, fmt.Errorf("rol no soportado: %s (usa owner, member o viewer)", role)
+	}
+	return s.update(name, actor, true, func(group *Group) error {
+		group.Members[username] = role
+		return nil
+	})
+}
+
+// Quitar un miembro del grupo (cualquier miembro puede salir por su cuenta)
+func (s *Store) RemoveMember(name, actor, username string) (*Group, error) {
+	return s.update(name, actor, actor != username, func(group *Group) error {
+		if group.Members[username] == "" {
+			return ErrNotMember
+		}
+		delete(group.Members, username)
+		return nil
+	})
+}
+
+// Agregar un miembro sin pedir un dueño (lo usa el servidor al aplicar los grupos de un proveedor OIDC).
+// Devuelve false si ya era miembro, en cuyo caso su rol no cambia.
+func (s *Store) Join(name, username, role string) (bool, error) {
+	if !ValidRole(role) {
+		return false, fmt.Errorf("rol no soportado: %s (usa owner, member o viewer)", role)
+	}
+	joined := false
+	_, err := s.update(name, "", false, func(group *Group) error {
+		if group.Members[username] == "" {
+			group.Members[username] = role
+			joined = true
+		}
+		return nil
+	})
+	return joined, err
+}
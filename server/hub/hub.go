@@ -0,0 +1,200 @@
+package hub
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	pb "github.com/FelipeMarchantVargas/sync-service/proto"
+)
+
+// Capacidad por defecto del buffer de cada suscriptor
+const DefaultBufferSize = 256
+
+// Suscripción de un stream SyncUpdates a los eventos de un usuario
+type Subscriber struct {
+	ID          uint64
+	User        string
+	Peer        string
+	Device      string // Dispositivo del cliente (sus propios cambios no se le reenvían)
+	Filter      Filter // Carpetas que sincroniza el cliente
+	ConnectedAt time.Time
+
+	updates    chan *pb.FileUpdate
+	dropped    chan struct{}
+	once       sync.Once
+	closed     chan struct{}
+	closedOnce sync.Once
+}
+
+// Carpetas cuyos cambios recibe un suscriptor (sincronización selectiva)
+type Filter struct {
+	Include []string // Solo los cambios dentro de estas carpetas (vacío = todas)
+	Exclude []string // Sin los cambios dentro de estas carpetas (tiene prioridad sobre Include)
+}
+
+// Indicar si una ruta está dentro de una carpeta (o es esa misma ruta)
+func within(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, dir+"/")
+}
+
+// Indicar si una ruta queda dentro de las carpetas del filtro
+func (f Filter) Contains(path string) bool {
+	for _, dir := range f.Exclude {
+		if within(path, dir) {
+			return false
+		}
+	}
+	if len(f.Include) == 0 {
+		return true
+	}
+	for _, dir := range f.Include {
+		if within(path, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// Indicar si un evento afecta a las carpetas del filtro (un movimiento, si entra o sale de ellas)
+func (f Filter) Matches(update *pb.FileUpdate) bool {
+	return f.Contains(update.Path) || (update.PreviousPath != "" && f.Contains(update.PreviousPath))
+}
+
+// Canal con los eventos pendientes de enviar
+func (s *Subscriber) Updates() <-chan *pb.FileUpdate {
+	return s.updates
+}
+
+// Canal que se cierra si el suscriptor fue desconectado por no consumir sus eventos a tiempo
+func (s *Subscriber) Dropped() <-chan struct{} {
+	return s.dropped
+}
+
+func (s *Subscriber) drop() {
+	s.once.Do(func() { close(s.dropped) })
+}
+
+// Canal que se cierra si un administrador cerró las sesiones del usuario
+func (s *Subscriber) Closed() <-chan struct{} {
+	return s.closed
+}
+
+// Hub de publicación/suscripción con suscripciones por usuario
+type Hub struct {
+	mu          sync.RWMutex
+	subscribers map[string]map[uint64]*Subscriber
+	nextID      uint64
+	bufferSize  int
+}
+
+// Crear un hub donde cada suscriptor tiene un buffer de bufferSize eventos
+func New(bufferSize int) *Hub {
+	if bufferSize <= 0 {
+		bufferSize = DefaultBufferSize
+	}
+	return &Hub{
+		subscribers: make(map[string]map[uint64]*Subscriber),
+		bufferSize:  bufferSize,
+	}
+}
+
+// Registrar un suscriptor para los eventos de un usuario que pasan el filtro
+func (h *Hub) Subscribe(user, peer, device string, filter Filter) *Subscriber {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.nextID++
+	sub := &Subscriber{
+		ID:          h.nextID,
+		User:        user,
+		Peer:        peer,
+		Device:      device,
+		Filter:      filter,
+		ConnectedAt: time.Now(),
+		updates:     make(chan *pb.FileUpdate, h.bufferSize),
+		dropped:     make(chan struct{}),
+		closed:      make(chan struct{}),
+	}
+	if h.subscribers[user] == nil {
+		h.subscribers[user] = make(map[uint64]*Subscriber)
+	}
+	h.subscribers[user][sub.ID] = sub
+	return sub
+}
+
+// Eliminar un suscriptor (se llama al cerrarse su stream)
+func (h *Hub) Unsubscribe(sub *Subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.remove(sub)
+}
+
+func (h *Hub) remove(sub *Subscriber) {
+	userSubs := h.subscribers[sub.User]
+	if userSubs == nil {
+		return
+	}
+	delete(userSubs, sub.ID)
+	if len(userSubs) == 0 {
+		delete(h.subscribers, sub.User)
+	}
+}
+
+// Indicar si un evento lo originó el propio dispositivo del suscriptor
+func (s *Subscriber) IsOwn(update *pb.FileUpdate) bool {
+	return s.Device != "" && update.Device == s.Device
+}
+
+// Indicar si un evento debe enviarse al suscriptor: no es propio y está en sus carpetas
+func (s *Subscriber) Wants(update *pb.FileUpdate) bool {
+	return !s.IsOwn(update) && s.Filter.Matches(update)
+}
+
+// Publicar un evento a los suscriptores de un usuario que lo quieren (no al dispositivo que lo originó
+// ni a los que no sincronizan esa carpeta).
+// Nunca bloquea: si el buffer de un suscriptor está lleno, se lo desconecta para que se reconecte.
+func (h *Hub) Publish(user string, update *pb.FileUpdate) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, sub := range h.subscribers[user] {
+		if !sub.Wants(update) {
+			continue
+		}
+		select {
+		case sub.updates <- update:
+		default:
+			h.remove(sub)
+			sub.drop()
+		}
+	}
+}
+
+// Listar los suscriptores conectados
+func (h *Hub) Subscribers() []*Subscriber {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	var subs []*Subscriber
+	for _, userSubs := range h.subscribers {
+		for _, sub := range userSubs {
+			subs = append(subs, sub)
+		}
+	}
+	return subs
+}
+
+// Desconectar todos los suscriptores de un usuario y devolver cuántos había
+func (h *Hub) Disconnect(user string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	count := 0
+	for _, sub := range h.subscribers[user] {
+		h.remove(sub)
+		sub.closedOnce.Do(func() { close(sub.closed) })
+		count++
+	}
+	return count
+}
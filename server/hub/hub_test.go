@@ -0,0 +1,139 @@
+package hub
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/FelipeMarchantVargas/sync-service/proto"
+)
+
+func update(path string) *pb.FileUpdate {
+	return &pb.FileUpdate{Path: path, Action: "modified"}
+}
+
+// Publicar, suscribirse y desuscribirse al mismo tiempo (pensado para go test -race)
+func TestConcurrentPublishSubscribe(t *testing.T) {
+	h := New(8)
+	var wg sync.WaitGroup
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				h.Publish(fmt.Sprintf("user%d", j%3), update(fmt.Sprintf("archivo%d-%d", i, j)))
+			}
+		}(i)
+	}
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				sub := h.Subscribe(fmt.Sprintf("user%d", j%3), "peer", fmt.Sprintf("device%d", i), Filter{})
+				// Consumir lo que haya llegado sin esperar
+			drain:
+				for {
+					select {
+					case <-sub.Updates():
+					case <-sub.Dropped():
+						break drain
+					default:
+						break drain
+					}
+				}
+				h.Subscribers()
+				h.Unsubscribe(sub)
+			}
+		}(i)
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for j := 0; j < 50; j++ {
+			h.Disconnect("user1")
+		}
+	}()
+
+	wg.Wait()
+	if subs := h.Subscribers(); len(subs) != 0 {
+		t.Fatalf("quedaron %d suscriptores después de desuscribirse todos", len(subs))
+	}
+}
+
+// Los eventos de un usuario solo llegan a sus suscriptores
+func TestPerUserIsolation(t *testing.T) {
+	h := New(8)
+	alice := h.Subscribe("alice", "peer", "a1", Filter{})
+	bob := h.Subscribe("bob", "peer", "b1", Filter{})
+
+	h.Publish("alice", update("notas.txt"))
+
+	select {
+	case got := <-alice.Updates():
+		if got.Path != "notas.txt" {
+			t.Fatalf("alice recibió %s", got.Path)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("alice no recibió su evento")
+	}
+	select {
+	case got := <-bob.Updates():
+		t.Fatalf("bob recibió un evento de alice: %s", got.Path)
+	default:
+	}
+
+	// Tampoco se reenvía al dispositivo que originó el cambio
+	h.Publish("alice", &pb.FileUpdate{Path: "propio.txt", Device: "a1"})
+	select {
+	case got := <-alice.Updates():
+		t.Fatalf("alice recibió su propio cambio: %s", got.Path)
+	default:
+	}
+}
+
+// Un suscriptor que no consume sus eventos se desconecta sin bloquear a quien publica
+func TestSlowConsumerDropped(t *testing.T) {
+	h := New(2)
+	slow := h.Subscribe("alice", "peer", "lento", Filter{})
+	fast := h.Subscribe("alice", "peer", "rapido", Filter{})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 3; i++ {
+			h.Publish("alice", update(fmt.Sprintf("archivo%d", i)))
+			<-fast.Updates()
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Publish se bloqueó con un suscriptor lento")
+	}
+
+	select {
+	case <-slow.Dropped():
+	default:
+		t.Fatal("el suscriptor lento no se reportó en Dropped()")
+	}
+	select {
+	case <-fast.Dropped():
+		t.Fatal("se desconectó al suscriptor que consume sus eventos")
+	default:
+	}
+
+	subs := h.Subscribers()
+	if len(subs) != 1 || subs[0].ID != fast.ID {
+		t.Fatalf("se esperaba solo el suscriptor rápido, hay %d", len(subs))
+	}
+
+	// Los eventos que alcanzó a recibir siguen en su buffer
+	if len(slow.Updates()) != 2 {
+		t.Fatalf("el suscriptor lento tiene %d eventos pendientes, se esperaban 2", len(slow.Updates()))
+	}
+}
@@ -0,0 +1,318 @@
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	pb "github.com/FelipeMarchantVargas/sync-service/proto"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Directorio por defecto donde se guardan los journals de cada usuario
+const DefaultDir = "./journal"
+
+// Cambios que se conservan por usuario por defecto
+const DefaultRetention = 10000
+
+// Tamaño máximo de una línea del journal
+const maxEntrySize = 1024 * 1024
+
+// Cada cuántas entradas se guarda su posición en el índice en memoria
+const indexInterval = 256
+
+// Error al pedir cambios que ya se descartaron del journal: el cliente debe sincronizar todo de nuevo
+var ErrTruncated = errors.New("el journal ya no incluye esos cambios")
+
+// Journal de cambios por usuario: un archivo append-only con un evento JSON por línea.
+// Cada usuario tiene su propio lock, así leer el journal de uno no detiene las escrituras de los demás.
+type Journal struct {
+	dir       string
+	retention int
+
+	mu   sync.Mutex
+	logs map[string]*userLog
+}
+
+// Journal de un usuario. Se carga al primer uso y se mantiene un índice con la posición en el archivo
+// de una de cada indexInterval entradas, para leer desde una secuencia sin recorrer todo el archivo.
+type userLog struct {
+	mu     sync.Mutex
+	loaded bool
+	latest int64        // Última secuencia registrada (0 si no tiene cambios)
+	first  int64        // Primera secuencia que queda en el archivo (0 si está vacío)
+	count  int          // Entradas en el archivo
+	index  []indexEntry // Posiciones de algunas entradas, en orden
+}
+
+type indexEntry struct {
+	sequence int64
+	offset   int64
+}
+
+// Abrir (o crear) el directorio del journal. Se conservan los últimos retention cambios de cada usuario
+// (0 = todos); los anteriores se descartan al compactar el archivo.
+func Open(dir string, retention int) (*Journal, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &Journal{dir: dir, retention: retention, logs: make(map[string]*userLog)}, nil
+}
+
+func (j *Journal) path(user string) string {
+	return filepath.Join(j.dir, filepath.Base(user)+".log")
+}
+
+// Obtener el journal de un usuario con su lock tomado
+func (j *Journal) lock(user string) (*userLog, error) {
+	j.mu.Lock()
+	ul, ok := j.logs[user]
+	if !ok {
+		ul = &userLog{}
+		j.logs[user] = ul
+	}
+	j.mu.Unlock()
+
+	ul.mu.Lock()
+	if !ul.loaded {
+		if err := j.load(user, ul); err != nil {
+			ul.mu.Unlock()
+			return nil, err
+		}
+	}
+	return ul, nil
+}
+
+// Leer el archivo de un usuario para calcular su última secuencia y su índice (debe llamarse con ul.mu tomado)
+func (j *Journal) load(user string, ul *userLog) error {
+	ul.loaded, ul.latest, ul.first, ul.count, ul.index = false, 0, 0, 0, nil
+	err := j.scan(user, 0, func(entry *pb.FileUpdate, offset int64) bool {
+		ul.note(entry.Sequence, offset)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	ul.loaded = true
+	return nil
+}
+
+// Registrar en memoria una entrada escrita en offset
+func (ul *userLog) note(sequence, offset int64) {
+	if ul.count%indexInterval == 0 {
+		ul.index = append(ul.index, indexEntry{sequence: sequence, offset: offset})
+	}
+	if ul.count == 0 {
+		ul.first = sequence
+	}
+	ul.count++
+	ul.latest = sequence
+}
+
+// Posición desde donde leer para encontrar las entradas con secuencia mayor a since
+func (ul *userLog) offsetAfter(since int64) int64 {
+	i := sort.Search(len(ul.index), func(i int) bool { return ul.index[i].sequence > since })
+	if i == 0 {
+		return 0
+	}
+	return ul.index[i-1].offset
+}
+
+// Registrar un cambio de un usuario, asignándole la siguiente secuencia.
+// Devuelve una copia del evento con la secuencia y la fecha asignadas.
+func (j *Journal) Append(user string, update *pb.FileUpdate) (*pb.FileUpdate, error) {
+	ul, err := j.lock(user)
+	if err != nil {
+		return nil, err
+	}
+	defer ul.mu.Unlock()
+
+	entry := proto.Clone(update).(*pb.FileUpdate)
+	entry.Sequence = ul.latest + 1
+	if entry.Timestamp == 0 {
+		entry.Timestamp = time.Now().Unix()
+	}
+
+	line, err := protojson.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(j.path(user), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// Si la última escritura quedó a medias, empezar en una línea nueva
+	line = append(line, '\n')
+	var offset int64
+	if info, err := file.Stat(); err == nil && info.Size() > 0 {
+		offset = info.Size()
+		last := make([]byte, 1)
+		if _, err := file.ReadAt(last, info.Size()-1); err == nil && last[0] != '\n' {
+			line = append([]byte{'\n'}, line...)
+			offset++
+		}
+	}
+
+	if _, err := file.Write(line); err != nil {
+		return nil, err
+	}
+	// El cambio solo se considera registrado una vez que está en disco
+	if err := file.Sync(); err != nil {
+		return nil, err
+	}
+	ul.note(entry.Sequence, offset)
+
+	// Compactar cuando el archivo supera en la mitad lo que se conserva (así el costo se reparte entre muchas
+	// escrituras). El cambio ya quedó registrado: si la compactación falla, se reintenta en el próximo.
+	if j.retention > 0 && ul.count > j.retention+j.retention/2 {
+		j.compact(user, ul)
+	}
+	return entry, nil
+}
+
+// Reescribir el archivo de un usuario dejando solo sus últimos j.retention cambios (debe llamarse con ul.mu tomado)
+func (j *Journal) compact(user string, ul *userLog) error {
+	keepFrom := ul.latest - int64(j.retention) + 1
+	src, err := os.Open(j.path(user))
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	if _, err := src.Seek(ul.offsetAfter(keepFrom-1), io.SeekStart); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(j.dir, "."+filepath.Base(user)+".log.tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	writer := bufio.NewWriter(tmp)
+	err = readLines(src, 0, func(line []byte, offset int64) bool {
+		entry := &pb.FileUpdate{}
+		if protojson.Unmarshal(line, entry) != nil || entry.Sequence < keepFrom {
+			return true
+		}
+		writer.Write(line)
+		writer.WriteByte('\n')
+		return true
+	})
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), j.path(user)); err != nil {
+		return err
+	}
+	return j.load(user, ul)
+}
+
+// Obtener la última secuencia registrada de un usuario (0 si no tiene cambios)
+func (j *Journal) Latest(user string) (int64, error) {
+	ul, err := j.lock(user)
+	if err != nil {
+		return 0, err
+	}
+	defer ul.mu.Unlock()
+	return ul.latest, nil
+}
+
+// Obtener hasta `limit` cambios con secuencia mayor a `since` (limit <= 0 = sin límite).
+// hasMore indica si quedaron cambios sin devolver. Devuelve ErrTruncated si algunos de los cambios
+// posteriores a since ya se descartaron (since = 0 devuelve los que se conservan).
+func (j *Journal) Since(user string, since int64, limit int) (changes []*pb.FileUpdate, hasMore bool, err error) {
+	ul, err := j.lock(user)
+	if err != nil {
+		return nil, false, err
+	}
+	defer ul.mu.Unlock()
+
+	if since > 0 && ul.first > since+1 {
+		return nil, false, ErrTruncated
+	}
+	if since >= ul.latest {
+		return nil, false, nil
+	}
+
+	err = j.scan(user, ul.offsetAfter(since), func(entry *pb.FileUpdate, offset int64) bool {
+		if entry.Sequence <= since {
+			return true
+		}
+		if limit > 0 && len(changes) >= limit {
+			hasMore = true
+			return false
+		}
+		changes = append(changes, entry)
+		return true
+	})
+	return changes, hasMore, err
+}
+
+// Recorrer en orden las entradas del journal de un usuario desde la posición from hasta que fn devuelva false
+func (j *Journal) scan(user string, from int64, fn func(entry *pb.FileUpdate, offset int64) bool) error {
+	file, err := os.Open(j.path(user))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := file.Seek(from, io.SeekStart); err != nil {
+		return err
+	}
+
+	return readLines(file, from, func(line []byte, offset int64) bool {
+		entry := &pb.FileUpdate{}
+		if err := protojson.Unmarshal(line, entry); err != nil {
+			// Una línea incompleta (p. ej. tras un corte) no invalida el resto
+			return true
+		}
+		return fn(entry, offset)
+	})
+}
+
+// Leer las líneas no vacías de r indicando la posición de cada una (r empieza en la posición start)
+func readLines(r io.Reader, start int64, fn func(line []byte, offset int64) bool) error {
+	reader := bufio.NewReaderSize(r, 64*1024)
+	offset := start
+	for {
+		line, err := reader.ReadBytes('\n')
+		lineOffset := offset
+		offset += int64(len(line))
+		if len(line) > maxEntrySize {
+			return fmt.Errorf("entrada del journal demasiado grande (%d bytes)", len(line))
+		}
+		if trimmed := bytes.TrimRight(line, "\n"); len(trimmed) > 0 {
+			if !fn(trimmed, lineOffset) {
+				return nil
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package journal
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	pb "github.com/FelipeMarchantVargas/sync-service/proto"
+)
+
+func appendN(t *testing.T, j *Journal, user string, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if _, err := j.Append(user, &pb.FileUpdate{Path: fmt.Sprintf("archivo%d", i), Action: "modified"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func checkSequences(t *testing.T, changes []*pb.FileUpdate, from, to int64) {
+	t.Helper()
+	if int64(len(changes)) != to-from+1 {
+		t.Fatalf("se obtuvieron %d cambios, se esperaban %d (de %d a %d)", len(changes), to-from+1, from, to)
+	}
+	for i, change := range changes {
+		if change.Sequence != from+int64(i) {
+			t.Fatalf("cambio %d con secuencia %d, se esperaba %d", i, change.Sequence, from+int64(i))
+		}
+	}
+}
+
+func TestSinceUsesIndex(t *testing.T) {
+	j, err := Open(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendN(t, j, "alice", 3*indexInterval+10)
+
+	for _, since := range []int64{0, 1, indexInterval - 1, indexInterval, indexInterval + 1, 3 * indexInterval, 3*indexInterval + 9} {
+		changes, hasMore, err := j.Since("alice", since, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hasMore {
+			t.Fatal("hasMore sin límite")
+		}
+		checkSequences(t, changes, since+1, 3*indexInterval+10)
+	}
+
+	changes, hasMore, err := j.Since("alice", 100, 5)
+	if err != nil || !hasMore {
+		t.Fatalf("se esperaba hasMore con límite: %v", err)
+	}
+	checkSequences(t, changes, 101, 105)
+
+	// Al reabrir se reconstruye el índice desde el archivo
+	reopened, _ := Open(j.dir, 0)
+	changes, _, err = reopened.Since("alice", 2*indexInterval+3, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSequences(t, changes, 2*indexInterval+4, 3*indexInterval+10)
+	if _, err := reopened.Append("alice", &pb.FileUpdate{Path: "otro"}); err != nil {
+		t.Fatal(err)
+	}
+	if latest, _ := reopened.Latest("alice"); latest != 3*indexInterval+11 {
+		t.Fatalf("última secuencia %d tras reabrir", latest)
+	}
+}
+
+func TestRetention(t *testing.T) {
+	const retention = 100
+	j, err := Open(t.TempDir(), retention)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendN(t, j, "alice", 400)
+
+	latest, _ := j.Latest("alice")
+	if latest != 400 {
+		t.Fatalf("última secuencia %d, se esperaba 400", latest)
+	}
+
+	// Nunca se conservan menos de retention cambios ni más de retention y medio
+	all, _, err := j.Since("alice", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) < retention || len(all) > retention+retention/2 {
+		t.Fatalf("se conservan %d cambios con retención %d", len(all), retention)
+	}
+	checkSequences(t, all, 401-int64(len(all)), 400)
+
+	if _, _, err := j.Since("alice", 10, 0); !errors.Is(err, ErrTruncated) {
+		t.Fatalf("se esperaba ErrTruncated para un cursor descartado, se obtuvo %v", err)
+	}
+	first := all[0].Sequence
+	changes, _, err := j.Since("alice", first-1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSequences(t, changes, first, 400)
+
+	// Las secuencias siguen después de compactar, también al reabrir
+	reopened, _ := Open(j.dir, retention)
+	update, err := reopened.Append("alice", &pb.FileUpdate{Path: "nuevo"})
+	if err != nil || update.Sequence != 401 {
+		t.Fatalf("secuencia %d tras compactar y reabrir: %v", update.GetSequence(), err)
+	}
+}
+
+// Escrituras y lecturas de varios usuarios al mismo tiempo (pensado para go test -race)
+func TestConcurrentUsers(t *testing.T) {
+	j, err := Open(t.TempDir(), 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for u := 0; u < 4; u++ {
+		user := fmt.Sprintf("user%d", u)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				if _, err := j.Append(user, &pb.FileUpdate{Path: "a"}); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				changes, _, err := j.Since(user, 0, 0)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				for k := 1; k < len(changes); k++ {
+					if changes[k].Sequence != changes[k-1].Sequence+1 {
+						t.Errorf("secuencias fuera de orden en %s", user)
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for u := 0; u < 4; u++ {
+		if latest, _ := j.Latest(fmt.Sprintf("user%d", u)); latest != 200 {
+			t.Fatalf("user%d tiene %d cambios, se esperaban 200", u, latest)
+		}
+	}
+}
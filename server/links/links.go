@@ -0,0 +1,234 @@
+package links
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Archivo por defecto donde se guardan los enlaces para compartir
+const DefaultFile = "./links.json"
+
+var (
+	ErrNotFound        = errors.New("el enlace no existe")
+	ErrExpired         = errors.New("el enlace expiró")
+	ErrBadSignature    = errors.New("la firma del enlace no es válida")
+	ErrBadPassword     = errors.New("contraseña incorrecta")
+	ErrLimitReached    = errors.New("el enlace alcanzó su máximo de descargas")
+	ErrPasswordMissing = errors.New("el enlace pide contraseña")
+)
+
+// Enlace público a un archivo: lo descarga cualquiera que lo tenga, sin cuenta, hasta que expira
+type Link struct {
+	ID           string `json:"id"`
+	Creator      string `json:"creator"`                 // Usuario que lo creó; el archivo se lee con sus permisos
+	Filename     string `json:"filename"`                // Ruta del archivo tal como la ve el creador
+	Expires      int64  `json:"expires"`                 // Momento en que deja de valer (Unix, segundos)
+	PasswordHash string `json:"password_hash,omitempty"` // Hash bcrypt de la contraseña (vacío = sin contraseña)
+	MaxDownloads int32  `json:"max_downloads,omitempty"` // Máximo de descargas (0 = sin límite)
+	Downloads    int32  `json:"downloads"`
+	Created      int64  `json:"created"`
+}
+
+// Enlaces guardados en un archivo JSON junto con la clave con que se firman
+type Store struct {
+	file   string
+	mu     sync.Mutex
+	secret []byte
+	links  map[string]*Link
+}
+
+// Contenido del archivo de enlaces
+type storeFile struct {
+	Secret string  `json:"secret"` // Clave HMAC en hex (se genera la primera vez)
+	Links  []*Link `json:"links"`
+}
+
+// Abrir (o crear) el archivo de enlaces, descartando los que ya expiraron
+func Open(file string) (*Store, error) {
+	s := &Store{file: file, links: make(map[string]*Link)}
+	data, err := os.ReadFile(file)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	var stored storeFile
+	if err == nil {
+		if err := json.Unmarshal(data, &stored); err != nil {
+			return nil, err
+		}
+	}
+	if stored.Secret != "" {
+		if s.secret, err = hex.DecodeString(stored.Secret); err != nil {
+			return nil, fmt.Errorf("clave de los enlaces inválida: %w", err)
+		}
+	} else {
+		s.secret = make([]byte, 32)
+		if _, err := rand.Read(s.secret); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now().Unix()
+	for _, link := range stored.Links {
+		if link.Expires > now {
+			s.links[link.ID] = link
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.save(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Guardar los enlaces de forma atómica (debe llamarse con s.mu tomado)
+func (s *Store) save() error {
+	stored := storeFile{Secret: hex.EncodeToString(s.secret), Links: make([]*Link, 0, len(s.links))}
+	for _, link := range s.links {
+		stored.Links = append(stored.Links, link)
+	}
+	sort.Slice(stored.Links, func(i, j int) bool { return stored.Links[i].Created < stored.Links[j].Created })
+
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(s.file); dir != "." {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+	}
+	tmp := s.file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.file)
+}
+
+// Firma HMAC-SHA256 de un enlace y su expiración (hex)
+func (s *Store) Sign(id string, expires int64) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(id + "." + strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Crear un enlace a un archivo. ttl indica cuánto dura; password y maxDownloads son opcionales.
+func (s *Store) Create(creator, filename string, ttl time.Duration, password string, maxDownloads int32) (*Link, error) {
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	link := &Link{
+		ID:           hex.EncodeToString(idBytes),
+		Creator:      creator,
+		Filename:     filename,
+		Expires:      now.Add(ttl).Unix(),
+		MaxDownloads: maxDownloads,
+		Created:      now.Unix(),
+	}
+	if password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, err
+		}
+		link.PasswordHash = string(hash)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.links[link.ID] = link
+	if err := s.save(); err != nil {
+		delete(s.links, link.ID)
+		return nil, err
+	}
+	copied := *link
+	return &copied, nil
+}
+
+// Validar un enlace pedido por HTTP y reservar una descarga. Se revisan la firma y la expiración antes
+// de buscarlo, así un enlace alterado o vencido se rechaza sin tocar el archivo de enlaces. La descarga
+// queda contada desde ya (dos pedidos simultáneos no superan el máximo); si el archivo no se llega a
+// enviar hay que devolverla con Refund.
+func (s *Store) Redeem(id string, expires int64, signature, password string) (*Link, error) {
+	if !hmac.Equal([]byte(signature), []byte(s.Sign(id, expires))) {
+		return nil, ErrBadSignature
+	}
+	if time.Now().Unix() >= expires {
+		return nil, ErrExpired
+	}
+
+	// La contraseña se compara sin tomar s.mu: bcrypt es lento a propósito y no debe frenar a los demás enlaces
+	hash, err := s.passwordHash(id, expires)
+	if err != nil {
+		return nil, err
+	}
+	if hash != "" {
+		if password == "" {
+			return nil, ErrPasswordMissing
+		}
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+			return nil, ErrBadPassword
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	link, ok := s.links[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if link.MaxDownloads > 0 && link.Downloads >= link.MaxDownloads {
+		return nil, ErrLimitReached
+	}
+
+	link.Downloads++
+	if err := s.save(); err != nil {
+		link.Downloads--
+		return nil, err
+	}
+	copied := *link
+	return &copied, nil
+}
+
+// Hash de la contraseña de un enlace (vacío si no tiene), o ErrNotFound si no existe con esa expiración
+func (s *Store) passwordHash(id string, expires int64) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	link, ok := s.links[id]
+	if !ok || link.Expires != expires {
+		return "", ErrNotFound
+	}
+	return link.PasswordHash, nil
+}
+
+// Devolver una descarga reservada con Redeem que no se llegó a completar
+func (s *Store) Refund(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	link, ok := s.links[id]
+	if !ok || link.Downloads == 0 {
+		return nil
+	}
+	link.Downloads--
+	if err := s.save(); err != nil {
+		link.Downloads++
+		return err
+	}
+	return nil
+}
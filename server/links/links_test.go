@@ -0,0 +1,154 @@
+package links
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	s, err := Open(filepath.Join(t.TempDir(), "links.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestRedeemRejectsTamperedLinks(t *testing.T) {
+	s := newTestStore(t)
+	link, err := s.Create("alice", "doc.txt", time.Hour, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := s.Create("alice", "otro.txt", time.Hour, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := s.Sign(link.ID, link.Expires)
+	tampered := sig[:len(sig)-1] + "0"
+	if tampered == sig {
+		tampered = sig[:len(sig)-1] + "1"
+	}
+
+	tests := []struct {
+		name    string
+		id      string
+		expires int64
+		sig     string
+		want    error
+	}{
+		{"firma alterada", link.ID, link.Expires, tampered, ErrBadSignature},
+		{"sin firma", link.ID, link.Expires, "", ErrBadSignature},
+		{"expiración alargada", link.ID, link.Expires + 3600, sig, ErrBadSignature},
+		{"firma de otro enlace", other.ID, other.Expires, sig, ErrBadSignature},
+		{"firma de otra tienda", link.ID, link.Expires, newTestStore(t).Sign(link.ID, link.Expires), ErrBadSignature},
+		// Firmado con una expiración que no es la del enlace (p. ej. con la clave filtrada): no se encuentra
+		{"expiración distinta bien firmada", link.ID, link.Expires + 3600, s.Sign(link.ID, link.Expires+3600), ErrNotFound},
+		{"enlace inexistente bien firmado", "no-existe", link.Expires, s.Sign("no-existe", link.Expires), ErrNotFound},
+	}
+	for _, tt := range tests {
+		if _, err := s.Redeem(tt.id, tt.expires, tt.sig, ""); !errors.Is(err, tt.want) {
+			t.Errorf("%s: se esperaba %v, se obtuvo %v", tt.name, tt.want, err)
+		}
+	}
+
+	redeemed, err := s.Redeem(link.ID, link.Expires, sig, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if redeemed.Filename != "doc.txt" || redeemed.Downloads != 1 {
+		t.Fatalf("enlace canjeado: %+v", redeemed)
+	}
+}
+
+func TestRedeemExpired(t *testing.T) {
+	s := newTestStore(t)
+	link, err := s.Create("alice", "doc.txt", -time.Second, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Redeem(link.ID, link.Expires, s.Sign(link.ID, link.Expires), ""); !errors.Is(err, ErrExpired) {
+		t.Fatalf("enlace vencido: se esperaba ErrExpired, se obtuvo %v", err)
+	}
+
+	// Al volver a abrir el archivo los enlaces vencidos se descartan
+	reopened, err := Open(s.file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := reopened.links[link.ID]; ok {
+		t.Fatal("el enlace vencido sigue guardado")
+	}
+	if string(reopened.secret) != string(s.secret) {
+		t.Fatal("la clave de los enlaces cambió al volver a abrir el archivo")
+	}
+}
+
+func TestRedeemPassword(t *testing.T) {
+	s := newTestStore(t)
+	link, err := s.Create("alice", "doc.txt", time.Hour, "secreta", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link.PasswordHash == "" || link.PasswordHash == "secreta" {
+		t.Fatalf("la contraseña no se guardó como hash: %q", link.PasswordHash)
+	}
+	sig := s.Sign(link.ID, link.Expires)
+
+	if _, err := s.Redeem(link.ID, link.Expires, sig, ""); !errors.Is(err, ErrPasswordMissing) {
+		t.Fatalf("sin contraseña: se esperaba ErrPasswordMissing, se obtuvo %v", err)
+	}
+	if _, err := s.Redeem(link.ID, link.Expires, sig, "otra"); !errors.Is(err, ErrBadPassword) {
+		t.Fatalf("contraseña incorrecta: se esperaba ErrBadPassword, se obtuvo %v", err)
+	}
+	redeemed, err := s.Redeem(link.ID, link.Expires, sig, "secreta")
+	if err != nil {
+		t.Fatalf("contraseña correcta rechazada: %v", err)
+	}
+	// Los intentos rechazados no cuentan como descargas
+	if redeemed.Downloads != 1 {
+		t.Fatalf("descargas = %d, se esperaba 1", redeemed.Downloads)
+	}
+}
+
+func TestRedeemMaxDownloads(t *testing.T) {
+	s := newTestStore(t)
+	link, err := s.Create("alice", "doc.txt", time.Hour, "", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := s.Sign(link.ID, link.Expires)
+
+	for i := 1; i <= 2; i++ {
+		redeemed, err := s.Redeem(link.ID, link.Expires, sig, "")
+		if err != nil {
+			t.Fatalf("descarga %d: %v", i, err)
+		}
+		if redeemed.Downloads != int32(i) {
+			t.Fatalf("descarga %d: descargas = %d", i, redeemed.Downloads)
+		}
+	}
+	if _, err := s.Redeem(link.ID, link.Expires, sig, ""); !errors.Is(err, ErrLimitReached) {
+		t.Fatalf("tercera descarga: se esperaba ErrLimitReached, se obtuvo %v", err)
+	}
+
+	// Una descarga devuelta se puede volver a usar, y el conteo se guarda en el archivo
+	if err := s.Refund(link.ID); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := Open(s.file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := reopened.links[link.ID].Downloads; got != 1 {
+		t.Fatalf("descargas guardadas = %d, se esperaba 1", got)
+	}
+	if _, err := reopened.Redeem(link.ID, link.Expires, sig, ""); err != nil {
+		t.Fatalf("descarga devuelta: %v", err)
+	}
+	if _, err := reopened.Redeem(link.ID, link.Expires, sig, ""); !errors.Is(err, ErrLimitReached) {
+		t.Fatalf("después de la devuelta: se esperaba ErrLimitReached, se obtuvo %v", err)
+	}
+}
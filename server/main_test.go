@@ -0,0 +1,68 @@
+package main
+
+import (
+	"io"
+	"os"
+	"testing"
+
+	"github.com/FelipeMarchantVargas/sync-service/server/audit"
+	"github.com/FelipeMarchantVargas/sync-service/server/groups"
+	"github.com/FelipeMarchantVargas/sync-service/server/hub"
+	"github.com/FelipeMarchantVargas/sync-service/server/journal"
+	"github.com/FelipeMarchantVargas/sync-service/server/links"
+	"github.com/FelipeMarchantVargas/sync-service/server/meta"
+	"github.com/FelipeMarchantVargas/sync-service/server/throttle"
+	"github.com/FelipeMarchantVargas/sync-service/server/users"
+)
+
+func TestMain(m *testing.M) {
+	// init abre server.log en el directorio del paquete; las pruebas no escriben en él
+	if file, ok := log.Out.(*os.File); ok {
+		file.Close()
+		if info, err := os.Stat("server.log"); err == nil && info.Size() == 0 {
+			os.Remove("server.log")
+		}
+	}
+	log.Out = io.Discard
+	os.Exit(m.Run())
+}
+
+// Servidor con todos sus datos en un directorio temporal (las rutas del servidor son relativas al directorio actual)
+func newTestServer(t *testing.T) *SyncServer {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	changeJournal, err := journal.Open(journal.DefaultDir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metaStore, err := meta.Open(meta.DefaultDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userStore, err := users.Open(users.DefaultFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	groupStore, err := groups.Open(groups.DefaultFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	linkStore, err := links.Open(links.DefaultFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auditLog, err := audit.Open(audit.DefaultFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	guard := newLoginGuard(throttle.SystemClock, 5, 10, 20, auditLog)
+	return &SyncServer{hub: hub.New(4096), journal: changeJournal, meta: metaStore, users: userStore, groups: groupStore, links: linkStore, guard: guard}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/FelipeMarchantVargas/sync-service/server/auth"
+	"github.com/FelipeMarchantVargas/sync-service/server/meta"
+)
+
+// ------------------------ MANTENIMIENTO ------------------------
+
+// Rotar la clave de un usuario (o de un grupo, "team:<grupo>"): la clave de datos de cada archivo al que
+// tiene acceso se vuelve a envolver con una clave nueva, que al terminar reemplaza a la anterior. Sus archivos
+// con el formato anterior (cifrados directamente con su clave), incluido el historial, se vuelven a cifrar
+// antes con una clave de datos propia. Devuelve cuántos archivos se actualizaron.
+func (s *SyncServer) rotateKey(holder string) (int64, error) {
+	oldKey, err := auth.GetAESKey(holder)
+	if err != nil {
+		return 0, err
+	}
+	newKey, err := auth.BeginKeyRotation(holder)
+	if err != nil {
+		return 0, err
+	}
+
+	owners, err := s.meta.Users()
+	if err != nil {
+		return 0, err
+	}
+	var count int64
+	for _, owner := range owners {
+		entries, err := s.meta.List(owner, true)
+		if err != nil {
+			return count, err
+		}
+		for _, entry := range entries {
+			if owner != holder && entry.Keys[holder] == "" {
+				continue
+			}
+			updated, err := s.meta.Update(owner, entry.Path, func(current *meta.FileMeta) (*meta.FileMeta, error) {
+				if current == nil {
+					return nil, nil
+				}
+				return rewrapEntry(owner, holder, current, oldKey, newKey)
+			})
+			if err != nil {
+				return count, fmt.Errorf("%s/%s: %w", owner, entry.Path, err)
+			}
+			if updated != nil {
+				count++
+			}
+		}
+	}
+
+	if err := auth.CompleteKeyRotation(holder); err != nil {
+		return count, err
+	}
+	return count, nil
+}
+
+// Metadatos de un archivo con su clave de datos envuelta con la clave nueva de holder (nil si no hay nada que cambiar)
+func rewrapEntry(owner, holder string, current *meta.FileMeta, oldKey, newKey []byte) (*meta.FileMeta, error) {
+	var dataKey []byte
+	if wrapped := current.Keys[holder]; wrapped != "" {
+		key, err := auth.UnwrapKey(wrapped, oldKey)
+		if err != nil {
+			// Ya envuelta con la clave nueva (una rotación anterior se interrumpió)
+			if key, err = auth.UnwrapKey(wrapped, newKey); err != nil {
+				return nil, err
+			}
+		}
+		dataKey = key
+	}
+
+	if owner == holder {
+		if err := resealLegacy(owner, current, oldKey, &dataKey); err != nil {
+			return nil, err
+		}
+	}
+	if dataKey == nil {
+		return nil, nil
+	}
+
+	wrapped, err := auth.WrapKey(dataKey, newKey)
+	if err != nil {
+		return nil, err
+	}
+	next := current.Clone()
+	if next.Keys == nil {
+		next.Keys = make(map[string]string)
+	}
+	next.Keys[holder] = wrapped
+	return next, nil
+}
+
+// Volver a cifrar con una clave de datos (que se crea si hace falta) la versión vigente y el historial de
+// un archivo guardados con el formato anterior
+func resealLegacy(owner string, entry *meta.FileMeta, ownerKey []byte, dataKey *[]byte) error {
+	paths := []string{userFilePath(owner, entry.Path)}
+	for version := int64(1); version <= entry.Version; version++ {
+		paths = append(paths, historyFilePath(owner, entry.Path, version))
+	}
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if auth.IsSealed(data) {
+			continue
+		}
+
+		if *dataKey == nil {
+			if *dataKey, err = auth.GenerateDataKey(); err != nil {
+				return err
+			}
+		}
+		plain, err := auth.DecryptData(data, ownerKey)
+		if err != nil {
+			return err
+		}
+		sealed, err := auth.SealData(plain, *dataKey)
+		if err != nil {
+			return err
+		}
+		if err := writeFileAtomic(path, sealed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Problema encontrado al revisar los archivos guardados
+type integrityProblem struct {
+	Owner   string
+	Path    string
+	Problem string
+}
+
+// Revisar los archivos guardados de un espacio (o de todos si owner está vacío): que cada archivo vigente
+// exista, se pueda descifrar y coincida con su tamaño y su hash, que cada usuario con acceso tenga su clave
+// y que no haya archivos cifrados sin metadatos. Devuelve cuántos archivos revisó y los problemas encontrados.
+func (s *SyncServer) checkIntegrity(owner string) (int64, []integrityProblem, error) {
+	owners := []string{owner}
+	if owner == "" {
+		var err error
+		if owners, err = s.meta.Users(); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	var checked int64
+	var problems []integrityProblem
+	for _, owner := range owners {
+		entries, err := s.meta.List(owner, false)
+		if err != nil {
+			return checked, problems, err
+		}
+		tracked := make(map[string]bool, len(entries))
+		for _, entry := range entries {
+			tracked[entry.Path] = true
+			var problem string
+			err := s.meta.View(owner, entry.Path, func(current *meta.FileMeta) error {
+				if current != nil && !current.Deleted {
+					problem = checkStoredFile(owner, current)
+					checked++
+				}
+				return nil
+			})
+			if err != nil {
+				return checked, problems, err
+			}
+			if problem != "" {
+				problems = append(problems, integrityProblem{Owner: owner, Path: entry.Path, Problem: problem})
+			}
+		}
+
+		// Archivos cifrados que no figuran en los metadatos
+		root := filepath.Join(storageDir, owner)
+		filepath.WalkDir(root, func(filePath string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || !strings.HasSuffix(d.Name(), ".enc") || strings.HasPrefix(d.Name(), ".") {
+				return nil
+			}
+			rel, err := filepath.Rel(root, filePath)
+			if err != nil {
+				return nil
+			}
+			path := strings.TrimSuffix(filepath.ToSlash(rel), ".enc")
+			if !tracked[path] {
+				problems = append(problems, integrityProblem{Owner: owner, Path: path, Problem: "archivo cifrado sin metadatos"})
+			}
+			return nil
+		})
+	}
+	return checked, problems, nil
+}
+
+// Revisar un archivo vigente contra sus metadatos (vacío si está bien)
+func checkStoredFile(owner string, entry *meta.FileMeta) string {
+	data, err := os.ReadFile(userFilePath(owner, entry.Path))
+	if os.IsNotExist(err) {
+		return "falta el archivo cifrado"
+	}
+	if err != nil {
+		return fmt.Sprintf("no se pudo leer: %v", err)
+	}
+	plain, err := decryptFor(owner, owner, entry, data)
+	if err != nil {
+		return fmt.Sprintf("no se pudo descifrar: %v", err)
+	}
+	if int64(len(plain)) != entry.Size {
+		return fmt.Sprintf("el tamaño no coincide (%d bytes, se esperaban %d)", len(plain), entry.Size)
+	}
+	if hashData(plain) != entry.Hash {
+		return "el hash no coincide"
+	}
+	for grantee := range entry.Shares {
+		if entry.Keys[grantee] == "" {
+			return "falta la clave de " + grantee
+		}
+	}
+	return ""
+}
@@ -0,0 +1,461 @@
+package meta
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Directorio por defecto donde se guardan los índices de metadatos de cada usuario
+const DefaultDir = "./meta"
+
+// Atributos del archivo original que se restauran al descargarlo
+type Attrs struct {
+	Mode       uint32 `json:"mode,omitempty"`        // Permisos POSIX (0 = sin información)
+	MTime      int64  `json:"mtime,omitempty"`       // mtime en el cliente que lo subió (Unix, nanosegundos)
+	LinkTarget string `json:"link_target,omitempty"` // Enlace simbólico: destino del enlace
+}
+
+// Metadatos de un archivo guardado en el servidor
+type FileMeta struct {
+	Path    string `json:"path"`
+	Version int64  `json:"version"`
+	Size    int64  `json:"size"`
+	Hash    string `json:"hash"`     // SHA-256 del contenido original (hex)
+	ModTime int64  `json:"mod_time"` // Momento del último cambio (Unix, segundos)
+	Device  string `json:"device,omitempty"`
+	Deleted bool   `json:"deleted,omitempty"` // Marca de borrado: conserva la versión para detectar conflictos
+	Attrs
+
+	// Clave de datos del archivo envuelta con la clave de cada usuario que puede leerlo (usuario -> clave en hex)
+	Keys map[string]string `json:"keys,omitempty"`
+	// Usuarios con los que se compartió el archivo y su permiso ("read" o "write")
+	Shares map[string]string `json:"shares,omitempty"`
+}
+
+// Copia independiente de los metadatos (los mapas no se comparten con el índice)
+func (m *FileMeta) Clone() *FileMeta {
+	copied := *m
+	copied.Keys = cloneMap(m.Keys)
+	copied.Shares = cloneMap(m.Shares)
+	return &copied
+}
+
+func cloneMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	copied := make(map[string]string, len(m))
+	for k, v := range m {
+		copied[k] = v
+	}
+	return copied
+}
+
+// Índice de metadatos por usuario, guardado como un archivo JSON por usuario
+type Store struct {
+	dir   string
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+	cache map[string]map[string]*FileMeta
+
+	// Archivos compartidos con cada usuario (usuario -> dueño -> rutas). Se arma al abrir el directorio y se
+	// mantiene con cada cambio, así SharedWith no tiene que leer los índices de todos los usuarios.
+	shared map[string]map[string]map[string]bool
+}
+
+// Abrir (o crear) el directorio de metadatos
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	s := &Store{
+		dir:    dir,
+		locks:  make(map[string]*sync.Mutex),
+		cache:  make(map[string]map[string]*FileMeta),
+		shared: make(map[string]map[string]map[string]bool),
+	}
+	if err := s.indexShared(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Armar el índice de archivos compartidos leyendo una vez los índices de todos los usuarios
+// (sin dejarlos en la caché: la mayoría no tiene archivos compartidos)
+func (s *Store) indexShared() error {
+	users, err := s.Users()
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		data, err := os.ReadFile(s.path(user))
+		if err != nil {
+			return err
+		}
+		var entries []*FileMeta
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			s.reindexShared(user, entry.Path, nil, entry)
+		}
+	}
+	return nil
+}
+
+// Actualizar el índice de archivos compartidos con el cambio de una ruta de owner (previous o next pueden ser nil)
+func (s *Store) reindexShared(owner, path string, previous, next *FileMeta) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if previous != nil {
+		for grantee := range previous.Shares {
+			if next != nil && next.Shares[grantee] != "" {
+				continue
+			}
+			paths := s.shared[grantee][owner]
+			delete(paths, path)
+			if len(paths) == 0 {
+				delete(s.shared[grantee], owner)
+			}
+			if len(s.shared[grantee]) == 0 {
+				delete(s.shared, grantee)
+			}
+		}
+	}
+	if next != nil {
+		for grantee := range next.Shares {
+			if s.shared[grantee] == nil {
+				s.shared[grantee] = make(map[string]map[string]bool)
+			}
+			if s.shared[grantee][owner] == nil {
+				s.shared[grantee][owner] = make(map[string]bool)
+			}
+			s.shared[grantee][owner][path] = true
+		}
+	}
+}
+
+func (s *Store) path(user string) string {
+	return filepath.Join(s.dir, filepath.Base(user)+".json")
+}
+
+// Candado por usuario: los cambios de un usuario se serializan sin bloquear a los demás
+func (s *Store) userLock(user string) *sync.Mutex {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lock, ok := s.locks[user]
+	if !ok {
+		lock = &sync.Mutex{}
+		s.locks[user] = lock
+	}
+	return lock
+}
+
+// Cargar el índice de un usuario (debe llamarse con el candado del usuario tomado)
+func (s *Store) load(user string) (map[string]*FileMeta, error) {
+	s.mu.Lock()
+	index, ok := s.cache[user]
+	s.mu.Unlock()
+	if ok {
+		return index, nil
+	}
+
+	index = make(map[string]*FileMeta)
+	data, err := os.ReadFile(s.path(user))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		var entries []*FileMeta
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			index[entry.Path] = entry
+		}
+	}
+
+	s.mu.Lock()
+	s.cache[user] = index
+	s.mu.Unlock()
+	return index, nil
+}
+
+// Guardar el índice de un usuario de forma atómica
+func (s *Store) save(user string, index map[string]*FileMeta) error {
+	entries := make([]*FileMeta, 0, len(index))
+	for _, entry := range index {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path(user) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path(user))
+}
+
+// Obtener los metadatos de un archivo (incluye marcas de borrado)
+func (s *Store) Get(user, path string) (*FileMeta, bool, error) {
+	lock := s.userLock(user)
+	lock.Lock()
+	defer lock.Unlock()
+
+	index, err := s.load(user)
+	if err != nil {
+		return nil, false, err
+	}
+	entry, ok := index[path]
+	if !ok {
+		return nil, false, nil
+	}
+	return entry.Clone(), true, nil
+}
+
+// Ejecutar fn con los metadatos actuales de un archivo (nil si nunca existió) sin que puedan cambiar mientras tanto.
+// Sirve para leer el archivo del disco y su versión de forma consistente.
+func (s *Store) View(user, path string, fn func(current *FileMeta) error) error {
+	lock := s.userLock(user)
+	lock.Lock()
+	defer lock.Unlock()
+
+	index, err := s.load(user)
+	if err != nil {
+		return err
+	}
+
+	var current *FileMeta
+	if entry, ok := index[path]; ok {
+		current = entry.Clone()
+	}
+	return fn(current)
+}
+
+// Listar los archivos de un usuario ordenados por ruta (sin los borrados, salvo que se pidan)
+func (s *Store) List(user string, includeDeleted bool) ([]*FileMeta, error) {
+	lock := s.userLock(user)
+	lock.Lock()
+	defer lock.Unlock()
+
+	index, err := s.load(user)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*FileMeta
+	for _, entry := range index {
+		if entry.Deleted && !includeDeleted {
+			continue
+		}
+		entries = append(entries, entry.Clone())
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries, nil
+}
+
+// Bytes que ocupan los archivos vigentes de un usuario, sin contar el de la ruta indicada.
+// Debe llamarse desde fn en Update o UpdateThen (con el candado del usuario tomado), para que otro cambio no
+// pueda alterar el resultado antes de guardar el nuevo.
+func (s *Store) UsageLocked(user, except string) (int64, error) {
+	index, err := s.load(user)
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for path, entry := range index {
+		if path != except && !entry.Deleted {
+			total += entry.Size
+		}
+	}
+	return total, nil
+}
+
+// Archivo de otro usuario compartido con un usuario
+type SharedFile struct {
+	Owner string
+	Entry *FileMeta
+}
+
+// Archivos vigentes que otros usuarios compartieron con grantee, ordenados por dueño y ruta
+func (s *Store) SharedWith(grantee string) ([]SharedFile, error) {
+	s.mu.Lock()
+	byOwner := make(map[string][]string, len(s.shared[grantee]))
+	for owner, paths := range s.shared[grantee] {
+		for path := range paths {
+			byOwner[owner] = append(byOwner[owner], path)
+		}
+	}
+	s.mu.Unlock()
+
+	owners := make([]string, 0, len(byOwner))
+	for owner := range byOwner {
+		owners = append(owners, owner)
+	}
+	sort.Strings(owners)
+
+	var files []SharedFile
+	for _, owner := range owners {
+		paths := byOwner[owner]
+		sort.Strings(paths)
+		err := s.viewAll(owner, func(index map[string]*FileMeta) {
+			// El archivo pudo dejar de compartirse o borrarse después de leer el índice
+			for _, path := range paths {
+				if entry := index[path]; entry != nil && !entry.Deleted && entry.Shares[grantee] != "" {
+					files = append(files, SharedFile{Owner: owner, Entry: entry.Clone()})
+				}
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// Ejecutar fn con el índice completo de un usuario, sin que pueda cambiar mientras tanto (fn no debe modificarlo)
+func (s *Store) viewAll(user string, fn func(index map[string]*FileMeta)) error {
+	lock := s.userLock(user)
+	lock.Lock()
+	defer lock.Unlock()
+
+	index, err := s.load(user)
+	if err != nil {
+		return err
+	}
+	fn(index)
+	return nil
+}
+
+// Usuarios (o espacios) con metadatos guardados
+func (s *Store) Users() ([]string, error) {
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var users []string
+	for _, file := range files {
+		name := file.Name()
+		if !file.IsDir() && strings.HasSuffix(name, ".json") {
+			users = append(users, strings.TrimSuffix(name, ".json"))
+		}
+	}
+	return users, nil
+}
+
+// Modificar los metadatos de un archivo de forma atómica.
+// fn recibe los metadatos actuales (nil si el archivo nunca existió) y devuelve los nuevos;
+// si devuelve nil no se guarda nada. El cambio de un usuario no puede intercalarse con otro
+// del mismo usuario, así que fn puede escribir el archivo en disco con seguridad.
+func (s *Store) Update(user, path string, fn func(current *FileMeta) (*FileMeta, error)) (*FileMeta, error) {
+	return s.UpdateThen(user, path, fn, nil)
+}
+
+// Como Update, pero si se guardó un cambio ejecuta then con los metadatos nuevos antes de soltar el candado
+// del usuario. Sirve para registrar y publicar los cambios en el mismo orden en que se guardan sus versiones.
+func (s *Store) UpdateThen(user, path string, fn func(current *FileMeta) (*FileMeta, error), then func(next *FileMeta)) (*FileMeta, error) {
+	lock := s.userLock(user)
+	lock.Lock()
+	defer lock.Unlock()
+
+	index, err := s.load(user)
+	if err != nil {
+		return nil, err
+	}
+
+	var current *FileMeta
+	if entry, ok := index[path]; ok {
+		current = entry.Clone()
+	}
+
+	next, err := fn(current)
+	if err != nil || next == nil {
+		return nil, err
+	}
+	next.Path = path
+
+	previous, existed := index[path]
+	index[path] = next
+	if err := s.save(user, index); err != nil {
+		// Restaurar el índice en memoria para que refleje lo que hay en disco
+		if existed {
+			index[path] = previous
+		} else {
+			delete(index, path)
+		}
+		return nil, err
+	}
+	s.reindexShared(user, path, previous, next)
+
+	if then != nil {
+		then(next.Clone())
+	}
+	return next.Clone(), nil
+}
+
+// Mover los metadatos de un archivo a otra ruta de forma atómica.
+// fn recibe los metadatos actuales de ambas rutas (nil si nunca existieron) y devuelve los nuevos de cada una;
+// los dos cambios se guardan juntos o ninguno.
+func (s *Store) Move(user, from, to string, fn func(src, dst *FileMeta) (*FileMeta, *FileMeta, error)) (*FileMeta, *FileMeta, error) {
+	return s.MoveThen(user, from, to, fn, nil)
+}
+
+// Como Move, pero ejecuta then con los metadatos nuevos de ambas rutas antes de soltar el candado del usuario
+func (s *Store) MoveThen(user, from, to string, fn func(src, dst *FileMeta) (*FileMeta, *FileMeta, error), then func(src, dst *FileMeta)) (*FileMeta, *FileMeta, error) {
+	lock := s.userLock(user)
+	lock.Lock()
+	defer lock.Unlock()
+
+	index, err := s.load(user)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var src, dst *FileMeta
+	if entry, ok := index[from]; ok {
+		src = entry.Clone()
+	}
+	if entry, ok := index[to]; ok {
+		dst = entry.Clone()
+	}
+
+	nextSrc, nextDst, err := fn(src, dst)
+	if err != nil {
+		return nil, nil, err
+	}
+	nextSrc.Path, nextDst.Path = from, to
+
+	previousSrc, srcExisted := index[from]
+	previousDst, dstExisted := index[to]
+	index[from], index[to] = nextSrc, nextDst
+	if err := s.save(user, index); err != nil {
+		// Restaurar el índice en memoria para que refleje lo que hay en disco
+		restore := func(path string, previous *FileMeta, existed bool) {
+			if existed {
+				index[path] = previous
+			} else {
+				delete(index, path)
+			}
+		}
+		restore(from, previousSrc, srcExisted)
+		restore(to, previousDst, dstExisted)
+		return nil, nil, err
+	}
+	s.reindexShared(user, from, previousSrc, nextSrc)
+	s.reindexShared(user, to, previousDst, nextDst)
+
+	if then != nil {
+		then(nextSrc.Clone(), nextDst.Clone())
+	}
+	return nextSrc.Clone(), nextDst.Clone(), nil
+}
@@ -0,0 +1,77 @@
+package meta
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Rutas (dueño/ruta) de los archivos compartidos con un usuario
+func sharedPaths(t *testing.T, s *Store, grantee string) []string {
+	t.Helper()
+	files, err := s.SharedWith(grantee)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, file := range files {
+		paths = append(paths, file.Owner+"/"+file.Entry.Path)
+	}
+	return paths
+}
+
+// El índice de archivos compartidos sigue los cambios de los metadatos y se vuelve a armar al abrir el directorio
+func TestSharedWith(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := func(user, path string, shares map[string]string, deleted bool) {
+		t.Helper()
+		_, err := s.Update(user, path, func(current *FileMeta) (*FileMeta, error) {
+			return &FileMeta{Version: 1, Shares: shares, Deleted: deleted}, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	set("alice", "b.txt", map[string]string{"maria": "read"}, false)
+	set("alice", "a.txt", map[string]string{"maria": "write", "jose": "read"}, false)
+	set("alice", "privado.txt", nil, false)
+	set("bruno", "c.txt", map[string]string{"maria": "read"}, false)
+	if got, want := sharedPaths(t, s, "maria"), []string{"alice/a.txt", "alice/b.txt", "bruno/c.txt"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("compartidos con maria: %v, se esperaba %v", got, want)
+	}
+	if got, want := sharedPaths(t, s, "jose"), []string{"alice/a.txt"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("compartidos con jose: %v, se esperaba %v", got, want)
+	}
+
+	// Dejar de compartir con uno, borrar (la marca de borrado conserva los permisos) y mover
+	set("alice", "a.txt", map[string]string{"jose": "read"}, false)
+	set("bruno", "c.txt", map[string]string{"maria": "read"}, true)
+	_, _, err = s.Move("alice", "b.txt", "d.txt", func(src, dst *FileMeta) (*FileMeta, *FileMeta, error) {
+		return &FileMeta{Version: 2, Deleted: true}, &FileMeta{Version: 1, Shares: src.Shares}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := sharedPaths(t, s, "maria"), []string{"alice/d.txt"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("compartidos con maria después de los cambios: %v, se esperaba %v", got, want)
+	}
+	files, _ := s.SharedWith("maria")
+	if files[0].Entry.Shares["maria"] != "read" {
+		t.Fatalf("permiso del archivo movido: %q", files[0].Entry.Shares["maria"])
+	}
+
+	reopened, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := sharedPaths(t, reopened, "maria"), []string{"alice/d.txt"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("compartidos con maria al volver a abrir: %v, se esperaba %v", got, want)
+	}
+	if got := sharedPaths(t, reopened, "nadie"); got != nil {
+		t.Fatalf("compartidos con un usuario sin archivos: %v", got)
+	}
+}
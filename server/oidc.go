@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	pb "github.com/FelipeMarchantVargas/sync-service/proto"
+	"github.com/FelipeMarchantVargas/sync-service/server/groups"
+	"github.com/FelipeMarchantVargas/sync-service/server/users"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ------------------------ LOGIN CON OIDC ------------------------
+
+// Inicio de sesión con un proveedor OIDC: el cliente hace el flujo con el proveedor y el servidor
+// verifica el ID token que obtuvo (firma, emisor, audiencia y expiración) antes de emitir tokens propios
+type oidcLogin struct {
+	issuer        string
+	clientID      string
+	scopes        []string // Scopes que pide el cliente al proveedor
+	usernameClaim string   // Claim con el nombre de usuario
+	groupsClaim   string   // Claim con los grupos (vacío = no se aplican grupos)
+	role          string   // Rol de las cuentas que se crean en su primer login
+	sync          *SyncServer
+
+	mu       sync.Mutex
+	verifier *oidc.IDTokenVerifier
+}
+
+// Verificador de ID tokens; se crea al primer uso, así el servidor arranca aunque el proveedor no responda
+func (o *oidcLogin) getVerifier() (*oidc.IDTokenVerifier, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.verifier != nil {
+		return o.verifier, nil
+	}
+	// El contexto queda asociado a las descargas de las claves del proveedor: no debe cancelarse
+	ctx := oidc.ClientContext(context.Background(), &http.Client{Timeout: 10 * time.Second})
+	provider, err := oidc.NewProvider(ctx, o.issuer)
+	if err != nil {
+		return nil, err
+	}
+	o.verifier = provider.Verifier(&oidc.Config{ClientID: o.clientID})
+	return o.verifier, nil
+}
+
+// Grupos de un claim (una lista de strings; los valores que no son nombres de grupo válidos se ignoran)
+func claimGroups(value interface{}) []string {
+	list, _ := value.([]interface{})
+	seen := make(map[string]bool)
+	var names []string
+	for _, item := range list {
+		name, ok := item.(string)
+		if !ok || seen[name] || groups.ValidName(name) != nil {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Aplicar los grupos del proveedor: la cuenta entra como miembro a los grupos existentes que trae el claim
+// y sale de los que el proveedor le había dado y ya no trae. Los grupos que no existen se ignoran, y las
+// membresías agregadas a mano no se tocan.
+func (o *oidcLogin) applyGroups(user *users.User, names []string) {
+	previous := make(map[string]bool)
+	for _, name := range user.ExternalGroups {
+		previous[name] = true
+	}
+	current := make(map[string]bool)
+	var granted []string
+	for _, name := range names {
+		current[name] = true
+		joined, err := o.sync.groups.Join(name, user.Username, groups.RoleMember)
+		if errors.Is(err, groups.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			log.Printf("[ERROR] No se pudo agregar a %s al grupo %s: %v", user.Username, name, err)
+			continue
+		}
+		if joined || previous[name] {
+			granted = append(granted, name)
+		}
+		if joined {
+			o.sync.publishTeamAccess(name, user.Username, "shared")
+			log.Printf("[INFO] (%s) %s entró al grupo %s por el proveedor OIDC", time.Now().Format("15:04:05"), user.Username, name)
+		}
+	}
+
+	for _, name := range user.ExternalGroups {
+		if current[name] {
+			continue
+		}
+		if _, err := o.sync.groups.RemoveMember(name, user.Username, user.Username); err != nil {
+			if !errors.Is(err, groups.ErrNotFound) && !errors.Is(err, groups.ErrNotMember) {
+				log.Printf("[ERROR] No se pudo quitar a %s del grupo %s: %v", user.Username, name, err)
+				granted = append(granted, name) // Se vuelve a intentar en el próximo login
+			}
+			continue
+		}
+		o.sync.publishTeamAccess(name, user.Username, "unshared")
+		log.Printf("[INFO] (%s) %s salió del grupo %s por el proveedor OIDC", time.Now().Format("15:04:05"), user.Username, name)
+	}
+
+	if err := o.sync.users.SetExternalGroups(user.Username, granted); err != nil {
+		log.Printf("[ERROR] No se pudo guardar los grupos de %s: %v", user.Username, err)
+	}
+}
+
+// Informar al cliente el proveedor OIDC configurado
+func (s *AuthServer) OidcConfig(ctx context.Context, req *pb.Empty) (*pb.OidcConfigResponse, error) {
+	if s.oidc == nil {
+		return &pb.OidcConfigResponse{Enabled: false}, nil
+	}
+	return &pb.OidcConfigResponse{Enabled: true, Issuer: s.oidc.issuer, ClientId: s.oidc.clientID, Scopes: s.oidc.scopes}, nil
+}
+
+// Cambiar un ID token del proveedor por tokens propios, creando la cuenta en su primer login
+func (s *AuthServer) LoginOidc(ctx context.Context, req *pb.OidcLoginRequest) (*pb.LoginResponse, error) {
+	if s.oidc == nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "El servidor no tiene configurado un proveedor OIDC")
+	}
+
+	// 1️⃣ Verificar el ID token con las claves del proveedor
+	verifier, err := s.oidc.getVerifier()
+	if err != nil {
+		log.Printf("[ERROR] No se pudo contactar al proveedor OIDC %s: %v", s.oidc.issuer, err)
+		return nil, status.Errorf(codes.Unavailable, "No se pudo contactar al proveedor de identidad")
+	}
+	idToken, err := verifier.Verify(ctx, req.IdToken)
+	if err != nil {
+		log.Printf("[ERROR] (%s) ID token rechazado desde %s: %v", time.Now().Format("15:04:05"), peerHost(ctx), err)
+		return nil, status.Errorf(codes.Unauthenticated, "ID token inválido")
+	}
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, status.Errorf(codes.Unauthenticated, "ID token inválido")
+	}
+
+	// 2️⃣ Obtener la cuenta del claim configurado; solo se usan cuentas creadas por este proveedor
+	username, _ := claims[s.oidc.usernameClaim].(string)
+	if username == "" {
+		return nil, status.Errorf(codes.PermissionDenied, "El ID token no trae el claim %s", s.oidc.usernameClaim)
+	}
+	if err := users.ValidUsername(username); err != nil {
+		return nil, status.Errorf(codes.PermissionDenied, "El claim %s no es un nombre de usuario válido: %v", s.oidc.usernameClaim, err)
+	}
+	user, ok := s.users.Get(username)
+	if !ok {
+		if err := s.users.AddExternal(username, s.oidc.role, s.oidc.issuer); err != nil && !errors.Is(err, users.ErrExists) {
+			log.Printf("[ERROR] No se pudo crear la cuenta %s: %v", username, err)
+			return nil, status.Errorf(codes.Internal, "Error creando la cuenta")
+		}
+		log.Printf("[SUCCESS] (%s) Cuenta %s creada por el proveedor OIDC (%s)", time.Now().Format("15:04:05"), username, s.oidc.role)
+		user, _ = s.users.Get(username)
+	}
+	if user == nil || user.Provider != s.oidc.issuer {
+		return nil, status.Errorf(codes.PermissionDenied, "La cuenta %s no está vinculada al proveedor de identidad", username)
+	}
+	if user.Disabled {
+		return nil, status.Errorf(codes.PermissionDenied, "La cuenta está deshabilitada")
+	}
+
+	// 3️⃣ Aplicar los grupos del proveedor y emitir los tokens
+	if s.oidc.groupsClaim != "" {
+		s.oidc.applyGroups(user, claimGroups(claims[s.oidc.groupsClaim]))
+	}
+	resp, err := issueTokens(user)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("[SUCCESS] (%s) %s inició sesión con el proveedor OIDC", time.Now().Format("15:04:05"), username)
+	return resp, nil
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	pb "github.com/FelipeMarchantVargas/sync-service/proto"
+	"github.com/FelipeMarchantVargas/sync-service/server/auth"
+	"github.com/FelipeMarchantVargas/sync-service/server/groups"
+	"github.com/FelipeMarchantVargas/sync-service/server/users"
+	"github.com/golang-jwt/jwt/v4"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const testClientID = "sync-service"
+
+// Proveedor OIDC de prueba: publica su configuración y sus claves y firma ID tokens con RS256
+type testProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &testProvider{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                p.server.URL,
+			"authorization_endpoint":                p.server.URL + "/authorize",
+			"token_endpoint":                        p.server.URL + "/token",
+			"jwks_uri":                              p.server.URL + "/keys",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		encode := base64.RawURLEncoding.EncodeToString
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "prueba",
+				"alg": "RS256",
+				"use": "sig",
+				"n":   encode(key.PublicKey.N.Bytes()),
+				"e":   encode(big.NewInt(int64(key.PublicKey.E)).Bytes()),
+			}},
+		})
+	})
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+// Claims de un ID token válido para el servidor; cada prueba cambia los que necesita
+func (p *testProvider) claims(username string) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":                p.server.URL,
+		"aud":                testClientID,
+		"sub":                "id-" + username,
+		"preferred_username": username,
+		"iat":                now.Unix(),
+		"exp":                now.Add(time.Hour).Unix(),
+	}
+}
+
+// Firmar un ID token con key (la del proveedor, salvo que la prueba use otra)
+func signIDToken(t *testing.T, key *rsa.PrivateKey, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "prueba"
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+// Servidor de autenticación con el proveedor de prueba configurado
+func newOidcServer(t *testing.T, p *testProvider) (*AuthServer, *SyncServer) {
+	t.Helper()
+	s := newTestServer(t)
+	login := &oidcLogin{
+		issuer:        p.server.URL,
+		clientID:      testClientID,
+		usernameClaim: "preferred_username",
+		groupsClaim:   "groups",
+		role:          users.RoleUser,
+		sync:          s,
+	}
+	return &AuthServer{users: s.users, oidc: login}, s
+}
+
+func TestLoginOidcCreatesAccount(t *testing.T) {
+	p := newTestProvider(t)
+	a, s := newOidcServer(t, p)
+
+	claims := p.claims("maria")
+	claims["sub"] = "otro-nombre" // El nombre sale del claim configurado, no de sub
+	resp, err := a.LoginOidc(context.Background(), &pb.OidcLoginRequest{IdToken: signIDToken(t, p.key, claims)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, tokenClaims, err := auth.ValidateToken(resp.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokenClaims["username"] != "maria" {
+		t.Fatalf("token emitido para %v, se esperaba maria", tokenClaims["username"])
+	}
+	user, ok := s.users.Get("maria")
+	if !ok || user.Provider != p.server.URL || user.Role != users.RoleUser {
+		t.Fatalf("cuenta creada incorrectamente: %+v", user)
+	}
+	if _, ok := s.users.Get("otro-nombre"); ok {
+		t.Fatal("se creó una cuenta con el claim sub")
+	}
+}
+
+func TestLoginOidcRejectsInvalidTokens(t *testing.T) {
+	p := newTestProvider(t)
+	a, s := newOidcServer(t, p)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name   string
+		key    *rsa.PrivateKey
+		change func(claims jwt.MapClaims)
+	}{
+		{"otro emisor", p.key, func(c jwt.MapClaims) { c["iss"] = "https://otro.example.com" }},
+		{"otra audiencia", p.key, func(c jwt.MapClaims) { c["aud"] = "otra-aplicacion" }},
+		{"expirado", p.key, func(c jwt.MapClaims) {
+			c["iat"] = time.Now().Add(-2 * time.Hour).Unix()
+			c["exp"] = time.Now().Add(-time.Hour).Unix()
+		}},
+		{"otra firma", otherKey, func(c jwt.MapClaims) {}},
+	}
+	for _, tc := range cases {
+		claims := p.claims("maria")
+		tc.change(claims)
+		_, err := a.LoginOidc(context.Background(), &pb.OidcLoginRequest{IdToken: signIDToken(t, tc.key, claims)})
+		if status.Code(err) != codes.Unauthenticated {
+			t.Fatalf("%s: se esperaba Unauthenticated, se obtuvo %v", tc.name, err)
+		}
+	}
+	if _, ok := s.users.Get("maria"); ok {
+		t.Fatal("un ID token rechazado creó la cuenta")
+	}
+
+	claims := p.claims("maria")
+	delete(claims, "preferred_username")
+	if _, err := a.LoginOidc(context.Background(), &pb.OidcLoginRequest{IdToken: signIDToken(t, p.key, claims)}); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("sin el claim de usuario: se esperaba PermissionDenied, se obtuvo %v", err)
+	}
+}
+
+func TestLoginOidcRejectsOtherProviders(t *testing.T) {
+	p := newTestProvider(t)
+	a, s := newOidcServer(t, p)
+
+	if err := s.users.Add("local", "clave-segura", users.RoleUser); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.users.AddExternal("externa", users.RoleUser, "https://otro.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	for _, username := range []string{"local", "externa"} {
+		token := signIDToken(t, p.key, p.claims(username))
+		if _, err := a.LoginOidc(context.Background(), &pb.OidcLoginRequest{IdToken: token}); status.Code(err) != codes.PermissionDenied {
+			t.Fatalf("%s: se esperaba PermissionDenied, se obtuvo %v", username, err)
+		}
+	}
+}
+
+func TestLoginOidcAppliesGroups(t *testing.T) {
+	p := newTestProvider(t)
+	a, s := newOidcServer(t, p)
+	for _, name := range []string{"equipo", "manual"} {
+		if _, err := s.groups.Create(name, "admin", 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	login := func(groupNames ...string) {
+		t.Helper()
+		claims := p.claims("maria")
+		claims["groups"] = groupNames
+		if _, err := a.LoginOidc(context.Background(), &pb.OidcLoginRequest{IdToken: signIDToken(t, p.key, claims)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Entra a los grupos existentes del claim; los que no existen se ignoran
+	login("equipo", "no-existe")
+	if role := s.groups.Role("equipo", "maria"); role == "" {
+		t.Fatal("no se aplicó el grupo del proveedor")
+	}
+	if user, _ := s.users.Get("maria"); len(user.ExternalGroups) != 1 || user.ExternalGroups[0] != "equipo" {
+		t.Fatalf("grupos del proveedor guardados: %v", user.ExternalGroups)
+	}
+
+	// Una membresía agregada a mano se conserva cuando el proveedor deja de traer sus grupos
+	if _, err := s.groups.SetMember("manual", "admin", "maria", groups.RoleMember); err != nil {
+		t.Fatal(err)
+	}
+	login()
+	if role := s.groups.Role("equipo", "maria"); role != "" {
+		t.Fatal("la cuenta sigue en un grupo que el proveedor ya no trae")
+	}
+	if role := s.groups.Role("manual", "maria"); role == "" {
+		t.Fatal("se quitó una membresía agregada a mano")
+	}
+}
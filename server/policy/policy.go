@@ -0,0 +1,57 @@
+package policy
+
+import "github.com/FelipeMarchantVargas/sync-service/server/users"
+
+// Acción que pide un handler; cada rol tiene un conjunto fijo de acciones permitidas
+type Action string
+
+const (
+	Read   Action = "read"   // Listar, descargar y recibir cambios
+	Write  Action = "write"  // Subir, borrar y mover archivos
+	Share  Action = "share"  // Compartir archivos y crear enlaces públicos
+	Groups Action = "groups" // Crear grupos y administrar sus miembros
+	Admin  Action = "admin"  // Operaciones de administración del servidor
+)
+
+// Todas las acciones, en el orden en que se muestran
+var Actions = []Action{Read, Write, Share, Groups, Admin}
+
+// Convertir un nombre en una acción (false si no existe)
+func ParseAction(name string) (Action, bool) {
+	for _, action := range Actions {
+		if string(action) == name {
+			return action, true
+		}
+	}
+	return "", false
+}
+
+// Acciones permitidas a cada rol
+var allowed = map[string]map[Action]bool{
+	users.RoleAdmin:    {Read: true, Write: true, Share: true, Groups: true, Admin: true},
+	users.RoleUser:     {Read: true, Write: true, Share: true, Groups: true},
+	users.RoleService:  {Read: true, Write: true},
+	users.RoleReadOnly: {Read: true},
+}
+
+// Indicar si un rol puede hacer una acción (un rol desconocido no puede hacer nada)
+func Allows(role string, action Action) bool {
+	return allowed[role][action]
+}
+
+// Descripción de una acción para los mensajes de error
+func (a Action) Describe() string {
+	switch a {
+	case Read:
+		return "leer archivos"
+	case Write:
+		return "modificar archivos"
+	case Share:
+		return "compartir archivos"
+	case Groups:
+		return "administrar grupos"
+	case Admin:
+		return "administrar el servidor"
+	}
+	return string(a)
+}
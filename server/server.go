@@ -2,34 +2,62 @@ package main
 
 import (
 	"bytes"
-	"compress/gzip"
 	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"io"
 	"net"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/FelipeMarchantVargas/sync-service/compression"
 	pb "github.com/FelipeMarchantVargas/sync-service/proto"
+	"github.com/FelipeMarchantVargas/sync-service/server/apikeys"
+	"github.com/FelipeMarchantVargas/sync-service/server/audit"
 	"github.com/FelipeMarchantVargas/sync-service/server/auth"
-	"github.com/fsnotify/fsnotify"
-	"github.com/golang-jwt/jwt"
+	"github.com/FelipeMarchantVargas/sync-service/server/groups"
+	"github.com/FelipeMarchantVargas/sync-service/server/hub"
+	"github.com/FelipeMarchantVargas/sync-service/server/journal"
+	"github.com/FelipeMarchantVargas/sync-service/server/links"
+	"github.com/FelipeMarchantVargas/sync-service/server/meta"
+	"github.com/FelipeMarchantVargas/sync-service/server/policy"
+	"github.com/FelipeMarchantVargas/sync-service/server/throttle"
+	"github.com/FelipeMarchantVargas/sync-service/server/users"
 	"github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 )
 
 const storageDir = "./storage"
 
+// Máximo de cambios devueltos por GetChanges en una sola llamada
+const maxChangesPerRequest = 1000
+
 type SyncServer struct {
 	pb.UnimplementedSyncServiceServer
-	updateClients []pb.SyncService_SyncUpdatesServer
+	hub     *hub.Hub
+	journal *journal.Journal
+	meta    *meta.Store
+	users   *users.Store
+	groups  *groups.Store
+	links   *links.Store
+	guard   *loginGuard // Bloquea los enlaces que reciben contraseñas incorrectas (compartido con AuthServer)
+
+	publicURL string // Dirección con que se arman los enlaces para compartir
 }
 
 type AuthServer struct {
 	pb.UnimplementedAuthServiceServer
+	users *users.Store
+	keys  *apikeys.Store
+	guard *loginGuard
+	oidc  *oidcLogin // nil si no hay un proveedor OIDC configurado
 }
 
 // Configurar logrus con archivo de logs
@@ -47,6 +75,10 @@ func init() {
 // ------------------- AUTENTICACIÓN --------------------
 
 func authenticate(ctx context.Context) error {
+	// Las API keys ya las validó el interceptor de sesiones
+	if apiKeyFromContext(ctx) != nil {
+		return nil
+	}
 	md, ok := metadata.FromIncomingContext(ctx)
 	if !ok {
 		log.Error("Falta token de autenticación")
@@ -71,61 +103,124 @@ func authenticate(ctx context.Context) error {
 
 // Obtener el nombre de usuario desde el contexto gRPC
 func getUsernameFromContext(ctx context.Context) (string, error) {
+	username, _, err := getIdentityFromContext(ctx)
+	return username, err
+}
+
+// Verificar que el rol del usuario del token permita una acción y devolver su nombre de usuario
+func authorize(ctx context.Context, action policy.Action) (string, error) {
+	username, role, err := getIdentityFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	if !policy.Allows(role, action) {
+		log.Printf("[ERROR] (%s) %s (%s) no puede %s", time.Now().Format("15:04:05"), username, role, action.Describe())
+		return "", status.Errorf(codes.PermissionDenied, "Tu rol (%s) no permite %s", role, action.Describe())
+	}
+	// Una API key además se limita a los permisos con que se creó
+	if session := apiKeyFromContext(ctx); session != nil && !session.key.Allows(string(action)) {
+		log.Printf("[ERROR] (%s) La API key %s de %s no permite %s", time.Now().Format("15:04:05"), session.key.Name, username, action.Describe())
+		return "", status.Errorf(codes.PermissionDenied, "La API key %s no permite %s", session.key.Name, action.Describe())
+	}
+	return username, nil
+}
+
+// Obtener el nombre de usuario y su rol desde el token (o la API key) del contexto gRPC
+func getIdentityFromContext(ctx context.Context) (string, string, error) {
+	if session := apiKeyFromContext(ctx); session != nil {
+		return session.key.Owner, session.role, nil
+	}
+
 	md, ok := metadata.FromIncomingContext(ctx)
 	if !ok {
 		log.Error("No se encontró metadata en el contexto")
-		return "", status.Errorf(codes.Unauthenticated, "Falta token de autenticación")
+		return "", "", status.Errorf(codes.Unauthenticated, "Falta token de autenticación")
 	}
 	tokens := md["authorization"]
 	if len(tokens) == 0 {
 		log.Error("Token de autenticación ausente")
-		return "", status.Errorf(codes.Unauthenticated, "Token no encontrado")
+		return "", "", status.Errorf(codes.Unauthenticated, "Token no encontrado")
 	}
 
 	token := tokens[0]
 	_, claims, err := auth.ValidateToken(token)
 	if err != nil {
 		log.WithError(err).Error("Error al validar token")
-		return "", status.Errorf(codes.Unauthenticated, "Token inválido")
+		return "", "", status.Errorf(codes.Unauthenticated, "Token inválido")
 	}
 
 	username, ok := claims["username"].(string)
 	if !ok {
 		log.Error("El token no contiene un username válido")
-		return "", status.Errorf(codes.Unauthenticated, "El token no contiene un username válido")
+		return "", "", status.Errorf(codes.Unauthenticated, "El token no contiene un username válido")
+	}
+
+	// El rol guardado de la cuenta manda sobre el del token, que puede haber cambiado desde que se emitió;
+	// los tokens emitidos antes de los roles corresponden a cuentas normales
+	role := roleFromContext(ctx)
+	if role == "" {
+		role, _ = claims["role"].(string)
+	}
+	if role == "" {
+		role = users.RoleUser
 	}
 
 	log.WithField("user", username).Info("Username obtenido del token")
-	return username, nil
+	return username, role, nil
 }
 
 func (s *AuthServer) Login(ctx context.Context, req *pb.LoginRequest) (*pb.LoginResponse, error) {
-	// ⚠️ En producción, valida con una base de datos
-	if req.Username != "admin" || req.Password != "password" {
+	// Rechazar sin revisar la contraseña si el usuario o la dirección están bloqueados
+	host := peerHost(ctx)
+	if err := s.guard.check(req.Username, host); err != nil {
+		return nil, err
+	}
+
+	// Validar usuario y contraseña contra las cuentas registradas
+	user, err := s.users.Authenticate(req.Username, req.Password)
+	if err != nil {
+		s.guard.failure(req.Username, host)
 		return nil, status.Errorf(codes.Unauthenticated, "Credenciales incorrectas")
 	}
+	if user.Disabled {
+		return nil, status.Errorf(codes.PermissionDenied, "La cuenta está deshabilitada")
+	}
 
-	// 📌 Verificar si el usuario ya tiene clave AES, si no, crearla
-	if _, err := auth.GetAESKey(req.Username); err != nil {
-		log.Printf("[INFO] Clave de cifrado no encontrada para %s, generando nueva...", req.Username)
-		_, err := auth.GenerateAESKey(req.Username)
-		if err != nil {
-			log.Printf("[ERROR] No se pudo generar clave AES para %s: %v", req.Username, err)
-			return nil, status.Errorf(codes.Internal, "Error generando clave de cifrado")
+	// Con el segundo factor activado se pide además un código TOTP o de recuperación
+	if user.TOTPSecret != "" {
+		if req.Otp == "" {
+			return &pb.LoginResponse{OtpRequired: true}, nil
+		}
+		if err := s.users.CheckSecondFactor(req.Username, req.Otp, s.guard.clock.Now()); err != nil {
+			s.guard.failure(req.Username, host)
+			log.Printf("[ERROR] (%s) Código de verificación incorrecto para %s", time.Now().Format("15:04:05"), req.Username)
+			return nil, status.Errorf(codes.Unauthenticated, "Código de verificación incorrecto")
 		}
-		log.Printf("[SUCCESS] Clave AES generada para %s", req.Username)
-	} else {
-		log.Printf("[INFO] Clave AES ya existe para %s", req.Username)
 	}
 
-	// Generar token de acceso
-	accessToken, err := auth.GenerateToken(req.Username)
+	resp, err := issueTokens(user)
+	if err != nil {
+		return nil, err
+	}
+	s.guard.success(req.Username)
+	return resp, nil
+}
+
+// Emitir el token de acceso y el refresh token de una cuenta que ya se autenticó
+func issueTokens(user *users.User) (*pb.LoginResponse, error) {
+	// 📌 Verificar si el usuario ya tiene clave AES, si no, crearla
+	if err := ensureUserKey(user.Username); err != nil {
+		return nil, status.Errorf(codes.Internal, "Error generando clave de cifrado")
+	}
+
+	// Generar token de acceso con el rol de la cuenta
+	accessToken, err := auth.GenerateToken(user.Username, user.Role, user.TokenVersion)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "Error generando el token")
 	}
 
 	// Generar refresh token
-	refreshToken, err := auth.GenerateRefreshToken(req.Username)
+	refreshToken, err := auth.GenerateRefreshToken(user.Username, user.TokenVersion)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "Error generando el refresh token")
 	}
@@ -134,29 +229,36 @@ func (s *AuthServer) Login(ctx context.Context, req *pb.LoginRequest) (*pb.Login
 }
 
 func (s *AuthServer) RefreshToken(ctx context.Context, req *pb.RefreshRequest) (*pb.LoginResponse, error) {
-	token, _, err := auth.ValidateToken(req.RefreshToken)
-	if err != nil {
+	_, claims, err := auth.ValidateToken(req.RefreshToken)
+	if err != nil || auth.TokenType(claims) != auth.RefreshTokenType {
 		return nil, status.Errorf(codes.Unauthenticated, "Refresh token inválido o expirado")
 	}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
+	username, ok := claims["username"].(string)
 	if !ok {
-		return nil, status.Errorf(codes.Unauthenticated, "Error en claims")
+		return nil, status.Errorf(codes.Unauthenticated, "Error obteniendo username")
 	}
 
-	username, ok := claims["username"].(string)
+	// La cuenta debe seguir habilitada y sus sesiones abiertas
+	user, ok := s.users.Get(username)
 	if !ok {
-		return nil, status.Errorf(codes.Unauthenticated, "Error obteniendo username")
+		return nil, status.Errorf(codes.Unauthenticated, "La cuenta ya no existe")
+	}
+	if user.Disabled {
+		return nil, status.Errorf(codes.PermissionDenied, "La cuenta está deshabilitada")
+	}
+	if auth.TokenVersion(claims) != user.TokenVersion {
+		return nil, status.Errorf(codes.Unauthenticated, "La sesión fue cerrada, inicia sesión de nuevo")
 	}
 
-	// Generar nuevo Access Token
-	accessToken, err := auth.GenerateToken(username)
+	// Generar nuevo Access Token con el rol vigente de la cuenta
+	accessToken, err := auth.GenerateToken(username, user.Role, user.TokenVersion)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "Error generando el token")
 	}
 
 	// Generar un nuevo Refresh Token
-	newRefreshToken, err := auth.GenerateRefreshToken(username)
+	newRefreshToken, err := auth.GenerateRefreshToken(username, user.TokenVersion)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "Error generando el refresh token")
 	}
@@ -166,89 +268,206 @@ func (s *AuthServer) RefreshToken(ctx context.Context, req *pb.RefreshRequest) (
 
 // ------------------------ GESTIÓN DE ARCHIVOS ------------------------
 
-func (s *SyncServer) SyncUpdates(req *pb.Empty, stream pb.SyncService_SyncUpdatesServer) error {
-	s.updateClients = append(s.updateClients, stream)
-
-	// Mantiene el stream abierto
-	<-stream.Context().Done()
-	return nil
-}
-
-// Función para notificar cambios a los clientes conectados
-func (s *SyncServer) notifyClients(filename string, action string) {
-	for _, client := range s.updateClients {
-		client.Send(&pb.FileUpdate{Filename: filename, Action: action})
+func (s *SyncServer) SyncUpdates(req *pb.SyncRequest, stream pb.SyncService_SyncUpdatesServer) error {
+	username, err := authorize(stream.Context(), policy.Read)
+	if err != nil {
+		return err
 	}
-}
 
-// Iniciar watcher en el directorio del servidor
-func (s *SyncServer) watchServerDirectory() {
-	watcher, err := fsnotify.NewWatcher()
-	if err != nil {
-		log.Fatalf("[ERROR] No se pudo iniciar el watcher en el servidor: %v", err)
+	peerAddr := ""
+	if p, ok := peer.FromContext(stream.Context()); ok {
+		peerAddr = p.Addr.String()
 	}
-	defer watcher.Close()
 
-	err = watcher.Add(storageDir)
+	// Sincronización selectiva: solo se envían los cambios de las carpetas que pide el cliente
+	filter, err := subscriptionFilter(req)
 	if err != nil {
-		log.Fatalf("[ERROR] No se pudo observar el directorio: %v", err)
+		return status.Errorf(codes.InvalidArgument, "Carpeta inválida: %v", err)
+	}
+
+	// Suscribirse solo a los eventos del usuario; la suscripción se elimina al cerrarse el stream.
+	// Los cambios hechos por el mismo dispositivo no se le reenvían (ya los tiene).
+	sub := s.hub.Subscribe(username, peerAddr, getDeviceFromContext(stream.Context()), filter)
+	defer s.hub.Unsubscribe(sub)
+	log.Printf("[INFO] %s (%s) suscrito a actualizaciones", username, peerAddr)
+
+	// Reenviar los cambios que el cliente se perdió mientras estaba desconectado.
+	// La suscripción se crea antes para que ningún cambio quede entre el journal y el tiempo real.
+	lastSent := req.Since
+	if req.Resume {
+		missed, _, err := s.journal.Since(username, req.Since, 0)
+		if errors.Is(err, journal.ErrTruncated) {
+			return truncatedStatus(req.Since)
+		}
+		if err != nil {
+			log.Printf("[ERROR] No se pudo leer el journal de %s: %v", username, err)
+			return status.Errorf(codes.Internal, "Error leyendo el historial de cambios")
+		}
+		for _, update := range missed {
+			lastSent = update.Sequence
+			if !sub.Wants(update) {
+				continue
+			}
+			if err := stream.Send(update); err != nil {
+				return err
+			}
+		}
+		log.Printf("[INFO] %d cambios reenviados a %s (%s) desde la secuencia %d", len(missed), username, peerAddr, req.Since)
 	}
 
-	log.Println("[INFO] Monitoreando cambios en el servidor...")
-
 	for {
 		select {
-		case event, ok := <-watcher.Events:
-			if !ok {
-				return
+		case update := <-sub.Updates():
+			// Los cambios ya reenviados desde el journal no se repiten
+			if req.Resume && update.Sequence <= lastSent {
+				continue
+			}
+			if err := stream.Send(update); err != nil {
+				log.Printf("[ERROR] No se pudo enviar actualización a %s (%s): %v", username, peerAddr, err)
+				return err
 			}
+		case <-sub.Dropped():
+			log.Printf("[ERROR] %s (%s) desconectado por no consumir actualizaciones a tiempo", username, peerAddr)
+			return status.Errorf(codes.ResourceExhausted, "Cliente demasiado lento, vuelve a conectarte")
+		case <-sub.Closed():
+			log.Printf("[INFO] %s (%s) desconectado por un administrador", username, peerAddr)
+			return status.Errorf(codes.Unauthenticated, "La sesión fue cerrada, inicia sesión de nuevo")
+		case <-stream.Context().Done():
+			log.Printf("[INFO] %s (%s) cerró el stream de actualizaciones", username, peerAddr)
+			return nil
+		}
+	}
+}
 
-			filename := filepath.Base(event.Name)
+// Error de un cursor anterior a los cambios que conserva el journal: el cliente debe sincronizar todo de nuevo
+func truncatedStatus(since int64) error {
+	return status.Errorf(codes.OutOfRange, "El historial de cambios ya no incluye los posteriores a la secuencia %d; sincroniza la carpeta completa", since)
+}
 
-			if event.Op&fsnotify.Create == fsnotify.Create || event.Op&fsnotify.Write == fsnotify.Write {
-				log.Printf("[INFO] Archivo creado/modificado en el servidor: %s", filename)
-				s.notifyClients(filename, "created")
-			}
+// Obtener los cambios posteriores a una secuencia (para clientes que consultan periódicamente)
+func (s *SyncServer) GetChanges(ctx context.Context, req *pb.ChangesRequest) (*pb.ChangeList, error) {
+	username, err := authorize(ctx, policy.Read)
+	if err != nil {
+		return nil, err
+	}
 
-			if event.Op&fsnotify.Remove == fsnotify.Remove {
-				log.Printf("[INFO] Archivo eliminado en el servidor: %s", filename)
-				s.notifyClients(filename, "deleted")
-			}
+	limit := int(req.Limit)
+	if limit <= 0 || limit > maxChangesPerRequest {
+		limit = maxChangesPerRequest
+	}
 
-		case err, ok := <-watcher.Errors:
-			if !ok {
-				return
-			}
-			log.Printf("[ERROR] Error en watcher del servidor: %v", err)
-		}
+	changes, hasMore, err := s.journal.Since(username, req.Since, limit)
+	if errors.Is(err, journal.ErrTruncated) {
+		return nil, truncatedStatus(req.Since)
+	}
+	if err != nil {
+		log.Printf("[ERROR] No se pudo leer el journal de %s: %v", username, err)
+		return nil, status.Errorf(codes.Internal, "Error leyendo el historial de cambios")
+	}
+	latest, err := s.journal.Latest(username)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Error leyendo el historial de cambios")
 	}
+
+	return &pb.ChangeList{Changes: changes, Latest: latest, HasMore: hasMore}, nil
 }
 
 func (s *SyncServer) ListFiles(ctx context.Context, req *pb.Empty) (*pb.FileList, error) {
-	username, err := getUsernameFromContext(ctx)
+	username, err := authorize(ctx, policy.Read)
 	if err != nil {
 		return nil, err
 	}
-	userStorageDir := filepath.Join(storageDir, username)
-	files, err := os.ReadDir(userStorageDir)
+
+	// La secuencia se lee antes de listar: los cambios posteriores llegarán por SyncUpdates/GetChanges
+	latest, err := s.journal.Latest(username)
+	if err != nil {
+		log.Printf("[ERROR] No se pudo leer el journal de %s: %v", username, err)
+		return nil, status.Errorf(codes.Internal, "Error leyendo el historial de cambios")
+	}
+
+	entries, err := s.meta.List(username, false)
 	if err != nil {
-		log.Printf("[ERROR] No se pudo leer el directorio de %s: %v", username, err)
+		log.Printf("[ERROR] No se pudo leer los archivos de %s: %v", username, err)
+		return nil, status.Errorf(codes.Internal, "Error listando archivos")
+	}
+
+	// Los archivos que otros usuarios compartieron con él se listan como "user:<dueño>/<ruta>"
+	shared, err := s.sharedWith(username)
+	if err != nil {
+		log.Printf("[ERROR] No se pudo leer los archivos compartidos con %s: %v", username, err)
+		return nil, status.Errorf(codes.Internal, "Error listando archivos")
+	}
+
+	// Y los de sus grupos como "team:<grupo>/<ruta>"
+	teamFiles, err := s.teamFiles(username)
+	if err != nil {
+		log.Printf("[ERROR] No se pudo leer los archivos de los grupos de %s: %v", username, err)
+		return nil, status.Errorf(codes.Internal, "Error listando archivos")
+	}
+
+	resp := &pb.FileList{Latest: latest}
+	for _, entry := range entries {
+		resp.Filenames = append(resp.Filenames, entry.Path+".enc")
+		resp.Files = append(resp.Files, fileInfo(entry))
+	}
+	for _, file := range shared {
+		info := fileInfo(file.Entry)
+		info.Filename = sharedPath(file.Owner, file.Entry.Path)
+		resp.Filenames = append(resp.Filenames, info.Filename+".enc")
+		resp.Files = append(resp.Files, info)
+	}
+	for _, info := range teamFiles {
+		resp.Filenames = append(resp.Filenames, info.Filename+".enc")
+		resp.Files = append(resp.Files, info)
+	}
+	return resp, nil
+}
+
+// Obtener los metadatos de un archivo (tamaño original, versión y hash)
+func (s *SyncServer) StatFile(ctx context.Context, req *pb.FileRequest) (*pb.FileInfo, error) {
+	username, err := authorize(ctx, policy.Read)
+	if err != nil {
+		return nil, err
+	}
+	if err := authenticate(ctx); err != nil {
 		return nil, err
 	}
 
-	var filenames []string
-	for _, file := range files {
-		if !file.IsDir() {
-			filenames = append(filenames, file.Name())
-		}
+	loc, err := resolvePath(username, req.Filename)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Ruta inválida: %v", err)
 	}
 
-	return &pb.FileList{Filenames: filenames}, nil
+	entry, ok, err := s.meta.Get(loc.Owner, loc.Path)
+	if err != nil {
+		log.Printf("[ERROR] No se pudo obtener info de %s: %v", loc.Name, err)
+		return nil, status.Errorf(codes.Internal, "Error obteniendo info del archivo")
+	}
+	if !ok || entry.Deleted || s.checkAccess(loc, username, entry, permRead) != nil {
+		return nil, status.Errorf(codes.NotFound, "El archivo no existe o no tienes permiso")
+	}
+	info := fileInfo(entry)
+	info.Filename = loc.Name
+	return info, nil
+}
+
+// Convertir los metadatos de un archivo al mensaje del protocolo
+func fileInfo(entry *meta.FileMeta) *pb.FileInfo {
+	return &pb.FileInfo{
+		Filename:   entry.Path,
+		Size:       entry.Size,
+		Version:    entry.Version,
+		Hash:       entry.Hash,
+		ModTime:    entry.ModTime,
+		Mode:       entry.Mode,
+		Mtime:      entry.MTime,
+		LinkTarget: entry.LinkTarget,
+	}
 }
 
 func (s *SyncServer) UploadFile(stream pb.SyncService_UploadFileServer) error {
 	// 1️⃣ Autenticar usuario y obtener su username
-	username, err := getUsernameFromContext(stream.Context())
+	username, err := authorize(stream.Context(), policy.Write)
 	if err != nil {
 		log.WithError(err).Error("Error obteniendo username desde contexto")
 		return err
@@ -261,7 +480,7 @@ func (s *SyncServer) UploadFile(stream pb.SyncService_UploadFileServer) error {
 		return err
 	}
 
-	// 2️⃣ Obtener clave de cifrado del usuario
+	// 2️⃣ Obtener clave de cifrado del usuario (cifra las partes de las subidas en partes)
 	key, err := auth.GetAESKey(username)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Error obteniendo clave de cifrado")
@@ -277,6 +496,12 @@ func (s *SyncServer) UploadFile(stream pb.SyncService_UploadFileServer) error {
 	log.Printf("[INFO] (%s) %s está subiendo un archivo", time.Now().Format("15:04:05"), username)
 
 	var filename string
+	var loc location
+	var codec string
+	var uploadID string
+	var part int32
+	var baseVersion *int64
+	var attrs meta.Attrs
 	var fileBuffer bytes.Buffer
 
 	// 4️⃣ Recibir los fragmentos del archivo
@@ -290,58 +515,90 @@ func (s *SyncServer) UploadFile(stream pb.SyncService_UploadFileServer) error {
 			return err
 		}
 
-		// Guardar el nombre del archivo (solo una vez)
+		// Guardar la ruta del archivo y el códec (solo una vez)
 		if filename == "" {
-			filename = filepath.Base(chunk.Filename)
+			loc, err = resolvePath(username, chunk.Filename)
+			if err != nil {
+				return status.Errorf(codes.InvalidArgument, "Ruta inválida: %v", err)
+			}
+			filename = loc.Name
+			codec = compression.Normalize(chunk.Compression)
+			uploadID = chunk.UploadId
+			part = chunk.Part
+			baseVersion = chunk.BaseVersion
+			attrs = uploadAttrs(chunk.Mode, chunk.Mtime, chunk.LinkTarget)
+			if !compression.Supported(codec) {
+				log.Printf("[ERROR] Códec de compresión no soportado para %s: %s", filename, codec)
+				return status.Errorf(codes.InvalidArgument, "Códec de compresión no soportado: %s", codec)
+			}
 		}
 
 		// Agregar el fragmento al buffer
 		fileBuffer.Write(chunk.Data)
 	}
 
-	// 5️⃣ Descomprimir el archivo antes de cifrarlo
-	reader, err := gzip.NewReader(&fileBuffer)
+	// 5️⃣ Descomprimir el archivo antes de cifrarlo con el códec negociado
+	decompressedBuffer, err := compression.Decompress(codec, fileBuffer.Bytes())
+	if errors.Is(err, compression.ErrTooLarge) {
+		log.Printf("[ERROR] El archivo %s supera el tamaño máximo al descomprimirlo (%s)", filename, codec)
+		return status.Errorf(codes.ResourceExhausted, "El archivo descomprimido supera el tamaño máximo de %d bytes (usa una subida en partes)", compression.MaxDecompressedSize)
+	}
 	if err != nil {
-		log.Printf("[ERROR] Error al descomprimir archivo %s: %v", filename, err)
-		return err
+		log.Printf("[ERROR] Error al descomprimir archivo %s (%s): %v", filename, codec, err)
+		return status.Errorf(codes.InvalidArgument, "Error al descomprimir el archivo con %s", codec)
 	}
 
-	decompressedBuffer, err := io.ReadAll(reader)
-	reader.Close()
-	if err != nil {
-		log.Printf("[ERROR] Error al leer archivo descomprimido %s: %v", filename, err)
-		return err
+	// Un enlace simbólico se guarda con su destino como contenido
+	if attrs.LinkTarget != "" && string(decompressedBuffer) != attrs.LinkTarget {
+		return status.Errorf(codes.InvalidArgument, "El contenido de un enlace simbólico debe ser su destino")
 	}
 
-	// 6️⃣ Cifrar el archivo antes de guardarlo
-	encryptedData, err := auth.EncryptData(decompressedBuffer, key)
-	if err != nil {
-		log.Printf("[ERROR] Error cifrando archivo %s: %v", filename, err)
-		return err
+	// Subida en partes: guardar la parte y esperar a CommitUpload
+	if uploadID != "" {
+		if err := stageUploadPart(username, uploadID, part, decompressedBuffer, key); err != nil {
+			return err
+		}
+		log.Printf("[INFO] (%s) Parte %d de %s recibida (%d KB, %s)", time.Now().Format("15:04:05"), part, filename, len(decompressedBuffer)/1024, codec)
+		return stream.SendAndClose(&pb.UploadResponse{
+			Message: fmt.Sprintf("Parte %d recibida", part),
+		})
 	}
 
-	// 7️⃣ Guardar el archivo cifrado (eliminando .gz si el cliente lo envió con esa extensión)
-	filePath := filepath.Join(userStorageDir, filename+".enc")
-	err = os.WriteFile(filePath, encryptedData, 0644)
+	// 6️⃣ Cifrar y guardar el archivo (en el espacio de su dueño si es compartido), registrando su nueva versión
+	entry, err := s.commitFile(loc.Owner, loc.Path, username, bytesContent(decompressedBuffer), getDeviceFromContext(stream.Context()), baseVersion, attrs)
+	if conflict := conflictStatus(filename, err); conflict != nil {
+		return conflict
+	}
+	if forbidden := forbiddenStatus(filename, err); forbidden != nil {
+		return forbidden
+	}
+	if quota := quotaStatus(filename, err); quota != nil {
+		return quota
+	}
+	if os.IsNotExist(err) {
+		return status.Errorf(codes.NotFound, "El archivo no existe o no tienes permiso")
+	}
 	if err != nil {
 		log.Printf("[ERROR] Error al guardar archivo %s: %v", filename, err)
-		return err
+		return status.Errorf(codes.Internal, "Error guardando el archivo")
 	}
 
-	// 8️⃣ Registrar éxito y responder al cliente
+	// 7️⃣ Registrar éxito y responder al cliente
 	elapsed := time.Since(startTime)
 	fileSize := len(decompressedBuffer)
-	log.Printf("[SUCCESS] (%s) %s recibido (%d KB), descomprimido, cifrado y guardado en %.2f s", time.Now().Format("15:04:05"), filename, fileSize/1024, elapsed.Seconds())
+	log.Printf("[SUCCESS] (%s) %s recibido (%d KB, %s), descomprimido, cifrado y guardado como versión %d en %.2f s", time.Now().Format("15:04:05"), filename, fileSize/1024, codec, entry.Version, elapsed.Seconds())
 
 	return stream.SendAndClose(&pb.UploadResponse{
 		Message: "Archivo subido, descomprimido y cifrado con éxito",
+		Version: entry.Version,
+		Hash:    entry.Hash,
 	})
 }
 
 
 func (s *SyncServer) DownloadFile(req *pb.FileRequest, stream pb.SyncService_DownloadFileServer) error {
 	// 1️⃣ Autenticar usuario y obtener su username
-	username, err := getUsernameFromContext(stream.Context())
+	username, err := authorize(stream.Context(), policy.Read)
 	if err != nil {
 		return err
 	}
@@ -350,57 +607,105 @@ func (s *SyncServer) DownloadFile(req *pb.FileRequest, stream pb.SyncService_Dow
 		return err
 	}
 
-	// 2️⃣ Obtener la clave de cifrado del usuario
-	key, err := auth.GetAESKey(username)
+	// 2️⃣ y 3️⃣ Construir la ruta del archivo cifrado (en el espacio de su dueño si es compartido)
+	loc, err := resolvePath(username, req.Filename)
 	if err != nil {
-		return status.Errorf(codes.Internal, "Error obteniendo clave de cifrado")
-	}
+		return status.Errorf(codes.InvalidArgument, "Ruta inválida: %v", err)
+	}
+	filePath := userFilePath(loc.Owner, loc.Path) // 📌 Se asegura de agregar ".enc"
+
+	// 4️⃣ y 5️⃣ Abrir el archivo cifrado junto con su versión y su clave (sin que cambien entre medio; como los
+	// archivos se reemplazan con un rename, el archivo abierto sigue siendo esa versión)
+	var file *os.File
+	var version int64
+	var attrs meta.Attrs
+	var entry *meta.FileMeta
+	err = s.meta.View(loc.Owner, loc.Path, func(current *meta.FileMeta) error {
+		if err := s.checkAccess(loc, username, current, permRead); err != nil {
+			return err
+		}
+		entry = current
 
-	// 3️⃣ Construir la ruta del archivo cifrado
-	userStorageDir := filepath.Join(storageDir, username)
-	filePath := filepath.Join(userStorageDir, req.Filename+".enc") // 📌 Se asegura de agregar ".enc"
+		// Versión anterior: se lee del historial
+		if req.Version > 0 && (current == nil || current.Deleted || current.Version != req.Version) {
+			f, err := os.Open(historyFilePath(loc.Owner, loc.Path, req.Version))
+			if err != nil {
+				return err
+			}
+			file = f
+			version = req.Version
+			return nil
+		}
 
-	// 4️⃣ Verificar que el archivo cifrado existe
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		f, err := os.Open(filePath)
+		if err != nil {
+			return err
+		}
+		file = f
+		if current != nil {
+			version = current.Version
+			attrs = current.Attrs
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
 		return status.Errorf(codes.NotFound, "El archivo no existe o no tienes permiso")
 	}
-
-	// 5️⃣ Leer el archivo cifrado
-	encryptedData, err := os.ReadFile(filePath)
 	if err != nil {
 		log.Printf("[ERROR] No se pudo leer el archivo cifrado %s: %v", req.Filename, err)
 		return err
 	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		log.Printf("[ERROR] No se pudo leer el archivo cifrado %s: %v", req.Filename, err)
+		return err
+	}
+
+	// Descarga por rangos: se descifra solo la porción pedida
+	size := storedSize(file, info.Size())
+	if req.Offset < 0 || req.Length < 0 || req.Offset > size {
+		return status.Errorf(codes.OutOfRange, "Rango fuera del archivo")
+	}
+	end := size
+	if req.Length > 0 && req.Offset+req.Length < end {
+		end = req.Offset + req.Length
+	}
 
-	// 6️⃣ Descifrar el archivo antes de enviarlo
-	decryptedData, err := auth.DecryptData(encryptedData, key)
+	// 6️⃣ Descifrar el archivo antes de enviarlo, con la clave de quien lo pide
+	decryptedData, err := decryptRangeFor(loc.Owner, username, entry, file, info.Size(), req.Offset, end-req.Offset)
+	if errors.Is(err, errForbidden) {
+		return status.Errorf(codes.NotFound, "El archivo no existe o no tienes permiso")
+	}
 	if err != nil {
 		log.Printf("[ERROR] No se pudo descifrar el archivo %s: %v", req.Filename, err)
 		return err
 	}
 
-	// 7️⃣ Comprimir el archivo antes de enviarlo
-	var compressedBuffer bytes.Buffer
-	gzipWriter := gzip.NewWriter(&compressedBuffer)
-	_, err = gzipWriter.Write(decryptedData)
-	gzipWriter.Close()
+	// 7️⃣ Negociar el códec con el cliente y comprimir el archivo antes de enviarlo
+	codec := compression.Negotiate(req.AcceptCompression, decryptedData)
+	buffer, err := compression.Compress(codec, decryptedData)
 	if err != nil {
 		log.Printf("[ERROR] No se pudo comprimir el archivo %s: %v", req.Filename, err)
 		return err
 	}
 
-	// 8️⃣ Enviar el archivo en fragmentos al cliente con su nombre original
-	buffer := compressedBuffer.Bytes()
-	chunkSize := 1024
-	for i := 0; i < len(buffer); i += chunkSize {
+	// 8️⃣ Enviar el archivo en fragmentos al cliente con su nombre original (al menos un fragmento, aunque esté vacío)
+	chunkSize := transferChunkSize(req.ChunkSize)
+	for i := 0; i == 0 || i < len(buffer); i += chunkSize {
 		end := i + chunkSize
 		if end > len(buffer) {
 			end = len(buffer)
 		}
 
 		err := stream.Send(&pb.FileChunk{
-			Filename: req.Filename, // 📌 Enviar el nombre sin `.gz`
-			Data:     buffer[i:end],
+			Filename:    req.Filename, // 📌 Enviar el nombre sin `.gz`
+			Data:        buffer[i:end],
+			Compression: codec,
+			Version:     version,
+			Mode:        attrs.Mode,
+			Mtime:       attrs.MTime,
+			LinkTarget:  attrs.LinkTarget,
 		})
 		if err != nil {
 			log.Printf("[ERROR] Error al enviar fragmento del archivo %s: %v", req.Filename, err)
@@ -408,12 +713,12 @@ func (s *SyncServer) DownloadFile(req *pb.FileRequest, stream pb.SyncService_Dow
 		}
 	}
 
-	log.Printf("[SUCCESS] Archivo %s descifrado, comprimido y enviado a %s", req.Filename, username)
+	log.Printf("[SUCCESS] Archivo %s descifrado, comprimido (%s) y enviado a %s", req.Filename, codec, username)
 	return nil
 }
 
 func (s *SyncServer) DeleteFile(ctx context.Context, req *pb.FileRequest) (*pb.UploadResponse, error) {
-	username, err := getUsernameFromContext(ctx)
+	username, err := authorize(ctx, policy.Write)
 	if err != nil {
 		return nil, err
 	}
@@ -421,17 +726,23 @@ func (s *SyncServer) DeleteFile(ctx context.Context, req *pb.FileRequest) (*pb.U
 		return nil, err
 	}
 
-	userStorageDir := filepath.Join(storageDir, username)
-	filePath := filepath.Join(userStorageDir, req.Filename+".enc") // 📌 Se asegura de agregar ".enc"
+	loc, err := resolvePath(username, req.Filename)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Ruta inválida: %v", err)
+	}
 
-	// Verificar si el archivo existe
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+	// Eliminar el archivo dejando una marca de borrado en los metadatos
+	entry, err := s.removeFile(loc.Owner, loc.Path, username, getDeviceFromContext(ctx), req.BaseVersion)
+	if conflict := conflictStatus(loc.Name, err); conflict != nil {
+		return nil, conflict
+	}
+	if forbidden := forbiddenStatus(loc.Name, err); forbidden != nil {
+		return nil, forbidden
+	}
+	if os.IsNotExist(err) {
 		log.Printf("[ERROR] Archivo %s no encontrado en el servidor.", req.Filename)
 		return nil, status.Errorf(codes.NotFound, "El archivo %s no existe en el servidor", req.Filename)
 	}
-
-	// Eliminar el archivo
-	err = os.Remove(filePath)
 	if err != nil {
 		log.Printf("[ERROR] No se pudo eliminar %s: %v", req.Filename, err)
 		return nil, status.Errorf(codes.Internal, "Error al eliminar %s", req.Filename)
@@ -439,31 +750,199 @@ func (s *SyncServer) DeleteFile(ctx context.Context, req *pb.FileRequest) (*pb.U
 
 	log.Printf("[SUCCESS] Archivo %s eliminado por %s", req.Filename, username)
 
-	return &pb.UploadResponse{Message: "Archivo eliminado correctamente"}, nil
+	return &pb.UploadResponse{Message: "Archivo eliminado correctamente", Version: entry.Version}, nil
+}
+
+// Mover o renombrar un archivo. Solo cambian la ruta en el disco y los metadatos: el contenido no se vuelve a transferir.
+func (s *SyncServer) MoveFile(ctx context.Context, req *pb.MoveRequest) (*pb.UploadResponse, error) {
+	username, err := authorize(ctx, policy.Write)
+	if err != nil {
+		return nil, err
+	}
+	if err := authenticate(ctx); err != nil {
+		return nil, err
+	}
+
+	// 1️⃣ Validar ambas rutas (dentro de un mismo espacio: el propio o el de un grupo)
+	src, err := resolvePath(username, req.From)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Ruta de origen inválida: %v", err)
+	}
+	dst, err := resolvePath(username, req.To)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Ruta de destino inválida: %v", err)
+	}
+	if src.Name == dst.Name {
+		return nil, status.Errorf(codes.InvalidArgument, "El origen y el destino son la misma ruta")
+	}
+	if err := movableSpace(src, dst, username); err != nil {
+		return nil, err
+	}
+	from, to := src.Name, dst.Name
+
+	// 2️⃣ Mover el archivo cifrado y sus metadatos
+	entry, err := s.moveFile(src.Owner, src.Path, dst.Path, username, getDeviceFromContext(ctx), req.BaseVersion)
+	if conflict := conflictStatus(from, err); conflict != nil {
+		return nil, conflict
+	}
+	if forbidden := forbiddenStatus(from, err); forbidden != nil {
+		return nil, forbidden
+	}
+	if os.IsNotExist(err) {
+		return nil, status.Errorf(codes.NotFound, "El archivo %s no existe en el servidor", from)
+	}
+	if errors.Is(err, errDestinationExists) {
+		return nil, status.Errorf(codes.AlreadyExists, "Ya existe un archivo en %s", to)
+	}
+	if err != nil {
+		log.Printf("[ERROR] No se pudo mover %s a %s: %v", from, to, err)
+		return nil, status.Errorf(codes.Internal, "Error al mover %s", from)
+	}
+
+	log.Printf("[SUCCESS] (%s) %s movido a %s por %s", time.Now().Format("15:04:05"), from, to, username)
+	return &pb.UploadResponse{Message: "Archivo movido correctamente", Version: entry.Version, Hash: entry.Hash}, nil
 }
 
 // ------------------------ INICIO DEL SERVIDOR ------------------------
 
 func main() {
+	watchStorage := flag.Bool("watch-storage", false, "Observar ./storage para notificar cambios hechos fuera del servidor")
+	addUser := flag.String("add-user", "", "Crear una cuenta (usuario:contraseña) y salir")
+	role := flag.String("role", users.RoleUser, "Rol de la cuenta creada con -add-user: admin, user, read-only o service")
+	setRole := flag.String("set-role", "", "Cambiar el rol de una cuenta (usuario:rol) y salir")
+	loginAttempts := flag.Int("login-attempts", 5, "Intentos fallidos seguidos de Login que bloquean a un usuario (una dirección se bloquea con el cuádruple)")
+	authRate := flag.Float64("auth-rate", 10, "Pedidos por segundo que admite AuthService en total")
+	authBurst := flag.Int("auth-burst", 20, "Ráfaga máxima de pedidos a AuthService")
+	oidcIssuer := flag.String("oidc-issuer", "", "URL del proveedor OIDC con que se puede iniciar sesión (vacío = desactivado)")
+	oidcClientID := flag.String("oidc-client-id", "", "Client ID registrado en el proveedor OIDC para el cliente de línea de comandos")
+	oidcScopes := flag.String("oidc-scopes", "openid,profile,email", "Scopes que pide el cliente al proveedor OIDC, separados por comas (p. ej. agregar groups)")
+	oidcUsernameClaim := flag.String("oidc-username-claim", "preferred_username", "Claim del ID token con el nombre de usuario")
+	oidcGroupsClaim := flag.String("oidc-groups-claim", "groups", "Claim del ID token con los grupos (vacío = no aplicar grupos)")
+	oidcRole := flag.String("oidc-role", users.RoleUser, "Rol de las cuentas que se crean en su primer login con OIDC")
+	reset2FA := flag.String("reset-2fa", "", "Desactivar el segundo factor de una cuenta (si perdió su aplicación y sus códigos de recuperación) y salir")
+	teamQuota := flag.Int64("team-quota", 10<<30, "Cuota en bytes de los grupos nuevos (0 = sin límite)")
+	journalRetention := flag.Int("journal-retention", journal.DefaultRetention, "Cambios que se conservan en el journal de cada usuario (0 = todos)")
+	httpAddr := flag.String("http-addr", ":8080", "Dirección del endpoint HTTP de los enlaces para compartir (vacío = desactivado)")
+	publicURL := flag.String("public-url", "", "URL pública del endpoint HTTP con que se arman los enlaces (por defecto http://localhost<http-addr>)")
+	flag.Parse()
+
+	userStore, err := users.Open(users.DefaultFile)
+	if err != nil {
+		log.Fatalf("Error al abrir las cuentas de usuario: %v", err)
+	}
+	// Sin cuentas registradas se crea la cuenta por defecto para no dejar el servidor inaccesible
+	if userStore.Count() == 0 {
+		if err := userStore.Add("admin", "password", users.RoleAdmin); err != nil {
+			log.Fatalf("No se pudo crear la cuenta por defecto: %v", err)
+		}
+		log.Println("[INFO] No había cuentas registradas: se creó admin/password (crea otras con -add-user)")
+	}
+	if *addUser != "" {
+		username, password, _ := strings.Cut(*addUser, ":")
+		if err := userStore.Add(username, password, *role); err != nil {
+			log.Fatalf("No se pudo crear el usuario %s: %v", username, err)
+		}
+		fmt.Printf("Usuario %s creado (%s)\n", username, *role)
+		return
+	}
+	if *setRole != "" {
+		username, newRole, _ := strings.Cut(*setRole, ":")
+		if err := userStore.SetRole(username, newRole); err != nil {
+			log.Fatalf("No se pudo cambiar el rol de %s: %v", username, err)
+		}
+		fmt.Printf("Rol de %s cambiado a %s\n", username, newRole)
+		return
+	}
+	if *reset2FA != "" {
+		if err := userStore.ResetTOTP(*reset2FA); err != nil {
+			log.Fatalf("No se pudo desactivar el segundo factor de %s: %v", *reset2FA, err)
+		}
+		fmt.Printf("Segundo factor de %s desactivado\n", *reset2FA)
+		return
+	}
+	// Las cuentas creadas antes de los roles son cuentas normales: sin administradores, nadie puede usar AdminService
+	if userStore.CountRole(users.RoleAdmin) == 0 {
+		log.Println("[INFO] No hay cuentas con rol admin: asigna uno con -set-role usuario:admin")
+	}
 
 	if _, err := os.Stat(storageDir); os.IsNotExist(err) {
 		os.Mkdir(storageDir, os.ModePerm)
 	}
-	
+
+	// Eliminar subidas en partes abandonadas
+	cleanStaleUploads()
+
 	// Escuchar en el puerto 50051
 	listener, err := net.Listen("tcp", ":50051")
 	if err != nil {
 		log.Fatalf("Error al iniciar el servidor: %v", err)
 	}
 
-	// Crear el servidor gRPC
-	grpcServer := grpc.NewServer()
-	syncServer := &SyncServer{}
+	// Crear el servidor gRPC (cada llamada revisa antes que la sesión siga abierta)
+	keyStore, err := apikeys.Open(apikeys.DefaultFile)
+	if err != nil {
+		log.Fatalf("Error al abrir las API keys: %v", err)
+	}
+	unarySession, streamSession := sessionInterceptors(userStore, keyStore)
+	auditLog, err := audit.Open(audit.DefaultFile)
+	if err != nil {
+		log.Fatalf("Error al abrir el registro de auditoría: %v", err)
+	}
+	if *loginAttempts < 1 || *authRate <= 0 || *authBurst < 1 {
+		log.Fatalf("-login-attempts, -auth-rate y -auth-burst deben ser positivos")
+	}
+	guard := newLoginGuard(throttle.SystemClock, *loginAttempts, *authRate, *authBurst, auditLog)
+	grpcServer := grpc.NewServer(grpc.ChainUnaryInterceptor(guard.unaryInterceptor, unarySession), grpc.StreamInterceptor(streamSession))
+	if *journalRetention < 0 {
+		log.Fatalf("-journal-retention no puede ser negativo")
+	}
+	changeJournal, err := journal.Open(journal.DefaultDir, *journalRetention)
+	if err != nil {
+		log.Fatalf("Error al abrir el journal de cambios: %v", err)
+	}
+	metaStore, err := meta.Open(meta.DefaultDir)
+	if err != nil {
+		log.Fatalf("Error al abrir los metadatos de archivos: %v", err)
+	}
+	groupStore, err := groups.Open(groups.DefaultFile)
+	if err != nil {
+		log.Fatalf("Error al abrir los grupos: %v", err)
+	}
+	linkStore, err := links.Open(links.DefaultFile)
+	if err != nil {
+		log.Fatalf("Error al abrir los enlaces para compartir: %v", err)
+	}
+	if *publicURL == "" {
+		host := *httpAddr
+		if strings.HasPrefix(host, ":") {
+			host = "localhost" + host
+		}
+		*publicURL = "http://" + host
+	}
+	syncServer := &SyncServer{hub: hub.New(hub.DefaultBufferSize), journal: changeJournal, meta: metaStore, users: userStore, groups: groupStore, links: linkStore, guard: guard, publicURL: strings.TrimSuffix(*publicURL, "/")}
+
+	// Registrar los archivos que todavía no tienen metadatos
+	syncServer.indexUntrackedFiles()
 	pb.RegisterSyncServiceServer(grpcServer, syncServer)
-	pb.RegisterAuthServiceServer(grpcServer, &AuthServer{})
+	authServer := &AuthServer{users: userStore, keys: keyStore, guard: guard}
+	if *oidcIssuer != "" {
+		if *oidcClientID == "" || !users.ValidRole(*oidcRole) {
+			log.Fatalf("-oidc-issuer necesita -oidc-client-id y un -oidc-role válido")
+		}
+		authServer.oidc = &oidcLogin{issuer: *oidcIssuer, clientID: *oidcClientID, scopes: strings.Split(*oidcScopes, ","), usernameClaim: *oidcUsernameClaim, groupsClaim: *oidcGroupsClaim, role: *oidcRole, sync: syncServer}
+		log.Printf("[INFO] Login con OIDC habilitado (%s)", *oidcIssuer)
+	}
+	pb.RegisterAuthServiceServer(grpcServer, authServer)
+	pb.RegisterGroupServiceServer(grpcServer, &GroupServer{sync: syncServer, quota: *teamQuota})
+	pb.RegisterAdminServiceServer(grpcServer, &AdminServer{sync: syncServer})
 
-	// Iniciar watcher en el servidor
-	go syncServer.watchServerDirectory()
+	// Los handlers notifican sus propios cambios; el watcher solo hace falta para cambios externos
+	if *watchStorage {
+		go syncServer.watchServerDirectory()
+	}
+	if *httpAddr != "" {
+		go syncServer.serveHTTP(*httpAddr)
+	}
 
 	log.Println("Servidor gRPC corriendo en el puerto 50051")
 	if err := grpcServer.Serve(listener); err != nil {
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+
+	"github.com/FelipeMarchantVargas/sync-service/server/apikeys"
+	"github.com/FelipeMarchantVargas/sync-service/server/auth"
+	"github.com/FelipeMarchantVargas/sync-service/server/users"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// ------------------------ SESIONES ------------------------
+
+// Clave del contexto donde el interceptor deja la API key con que se autenticó una llamada
+type apiKeyContextKey struct{}
+
+// API key con que se autenticó una llamada, junto con el rol actual de su dueño
+type apiKeySession struct {
+	key  *apikeys.Key
+	role string
+}
+
+// API key con que se autenticó una llamada (nil si se usó un JWT o ninguna)
+func apiKeyFromContext(ctx context.Context) *apiKeySession {
+	session, _ := ctx.Value(apiKeyContextKey{}).(*apiKeySession)
+	return session
+}
+
+// Clave del contexto donde el interceptor deja el rol guardado del usuario de un JWT
+type roleContextKey struct{}
+
+// Rol actual del usuario de un JWT según la base de usuarios ("" si el interceptor no lo revisó)
+func roleFromContext(ctx context.Context) string {
+	role, _ := ctx.Value(roleContextKey{}).(string)
+	return role
+}
+
+// Verificar que la cuenta de un token siga existiendo y habilitada y que sus sesiones no se hayan cerrado.
+// Una API key se valida aquí y se deja en el contexto para que los handlers la usen como identidad; con un JWT
+// se deja el rol guardado de la cuenta, así un cambio de rol vale de inmediato y no al expirar el token.
+// Las llamadas sin token (Login, RefreshToken) o con un JWT inválido pasan: las rechaza el handler. Un refresh
+// token se rechaza aquí: es válido, pero solo sirve para RefreshToken, que lo recibe en el pedido.
+func checkSession(store *users.Store, keys *apikeys.Store, ctx context.Context) (context.Context, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok || len(md["authorization"]) == 0 {
+		return ctx, nil
+	}
+	token := md["authorization"][0]
+
+	var username string
+	var version int64
+	var key *apikeys.Key
+	if apikeys.IsKey(token) {
+		var err error
+		if key, err = keys.Validate(token); err != nil {
+			return nil, status.Errorf(codes.Unauthenticated, "API key inválida o expirada")
+		}
+		username = key.Owner
+	} else {
+		_, claims, err := auth.ValidateToken(token)
+		if err != nil {
+			return ctx, nil
+		}
+		if auth.TokenType(claims) != auth.AccessTokenType {
+			return nil, status.Errorf(codes.Unauthenticated, "Un refresh token no sirve para autorizar llamadas")
+		}
+		username, _ = claims["username"].(string)
+		version = auth.TokenVersion(claims)
+	}
+
+	user, ok := store.Get(username)
+	if !ok {
+		return nil, status.Errorf(codes.Unauthenticated, "La cuenta ya no existe")
+	}
+	if user.Disabled {
+		return nil, status.Errorf(codes.PermissionDenied, "La cuenta está deshabilitada")
+	}
+	if key != nil {
+		return context.WithValue(ctx, apiKeyContextKey{}, &apiKeySession{key: key, role: user.Role}), nil
+	}
+	if version != user.TokenVersion {
+		return nil, status.Errorf(codes.Unauthenticated, "La sesión fue cerrada, inicia sesión de nuevo")
+	}
+	return context.WithValue(ctx, roleContextKey{}, user.Role), nil
+}
+
+// Stream con el contexto que dejó el interceptor
+type sessionStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *sessionStream) Context() context.Context {
+	return s.ctx
+}
+
+// Interceptores que revisan la sesión antes de cada llamada
+func sessionInterceptors(store *users.Store, keys *apikeys.Store) (grpc.UnaryServerInterceptor, grpc.StreamServerInterceptor) {
+	unary := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := checkSession(store, keys, ctx)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+	stream := func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := checkSession(store, keys, ss.Context())
+		if err != nil {
+			return err
+		}
+		return handler(srv, &sessionStream{ServerStream: ss, ctx: ctx})
+	}
+	return unary, stream
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/FelipeMarchantVargas/sync-service/proto"
+	"github.com/FelipeMarchantVargas/sync-service/server/auth"
+	"github.com/FelipeMarchantVargas/sync-service/server/policy"
+	"github.com/FelipeMarchantVargas/sync-service/server/users"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Un cambio de rol rige en el siguiente pedido aunque el token diga otro rol
+func TestRoleChangeAppliesToIssuedTokens(t *testing.T) {
+	s := newTestServer(t)
+	if err := s.users.Add("maria", "clave-segura", users.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	user, _ := s.users.Get("maria")
+	token, err := auth.GenerateToken("maria", users.RoleAdmin, user.TokenVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	incoming := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", token))
+
+	call := func(action policy.Action) error {
+		ctx, err := checkSession(s.users, nil, incoming)
+		if err != nil {
+			return err
+		}
+		_, err = authorize(ctx, action)
+		return err
+	}
+
+	if err := call(policy.Admin); err != nil {
+		t.Fatalf("un admin no pudo administrar: %v", err)
+	}
+	if err := s.users.SetRole("maria", users.RoleReadOnly); err != nil {
+		t.Fatal(err)
+	}
+	for _, action := range []policy.Action{policy.Admin, policy.Write} {
+		if err := call(action); status.Code(err) != codes.PermissionDenied {
+			t.Fatalf("%s con el rol anterior del token: se esperaba PermissionDenied, se obtuvo %v", action, err)
+		}
+	}
+	if err := call(policy.Read); err != nil {
+		t.Fatalf("read-only no pudo leer: %v", err)
+	}
+}
+
+// Un refresh token no autoriza llamadas y un token de acceso no sirve para renovar la sesión
+func TestTokenTypesAreNotInterchangeable(t *testing.T) {
+	s := newTestServer(t)
+	if err := s.users.Add("maria", "clave-segura", users.RoleUser); err != nil {
+		t.Fatal(err)
+	}
+	user, _ := s.users.Get("maria")
+	accessToken, err := auth.GenerateToken("maria", user.Role, user.TokenVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refreshToken, err := auth.GenerateRefreshToken("maria", user.TokenVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	incoming := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", refreshToken))
+	if _, err := checkSession(s.users, nil, incoming); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("refresh token como token de acceso: se esperaba Unauthenticated, se obtuvo %v", err)
+	}
+	incoming = metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", accessToken))
+	if _, err := checkSession(s.users, nil, incoming); err != nil {
+		t.Fatalf("token de acceso rechazado: %v", err)
+	}
+
+	authServer := &AuthServer{users: s.users}
+	if _, err := authServer.RefreshToken(context.Background(), &pb.RefreshRequest{RefreshToken: accessToken}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("token de acceso como refresh token: se esperaba Unauthenticated, se obtuvo %v", err)
+	}
+	if _, err := authServer.RefreshToken(context.Background(), &pb.RefreshRequest{RefreshToken: refreshToken}); err != nil {
+		t.Fatalf("refresh token rechazado: %v", err)
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	pb "github.com/FelipeMarchantVargas/sync-service/proto"
+	"github.com/FelipeMarchantVargas/sync-service/server/links"
+	"github.com/FelipeMarchantVargas/sync-service/server/meta"
+	"github.com/FelipeMarchantVargas/sync-service/server/policy"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ------------------------ ENLACES PARA COMPARTIR ------------------------
+
+// Duración de un enlace si no se indica otra, y la máxima permitida
+const (
+	defaultLinkTTL = 24 * time.Hour
+	maxLinkTTL     = 30 * 24 * time.Hour
+)
+
+// Límites de tiempo de las conexiones HTTP de los enlaces: para recibir el pedido y para mantener abierta una
+// conexión sin pedidos. No hay límite para enviar la respuesta, que puede ser un archivo grande.
+const (
+	httpReadHeaderTimeout = 10 * time.Second
+	httpReadTimeout       = 30 * time.Second
+	httpIdleTimeout       = 2 * time.Minute
+)
+
+// Ruta del endpoint HTTP que sirve los enlaces: /s/<id>?exp=<unix>&sig=<firma>
+const shareLinkPath = "/s/"
+
+// Crear un enlace público y temporal a un archivo al que el usuario tiene acceso
+func (s *SyncServer) CreateShareLink(ctx context.Context, req *pb.ShareLinkRequest) (*pb.ShareLink, error) {
+	username, err := authorize(ctx, policy.Share)
+	if err != nil {
+		return nil, err
+	}
+
+	// 1️⃣ Validar el archivo y las opciones del enlace
+	loc, err := resolvePath(username, req.Filename)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Ruta inválida: %v", err)
+	}
+	entry, ok, err := s.meta.Get(loc.Owner, loc.Path)
+	if err != nil {
+		log.Printf("[ERROR] No se pudo obtener info de %s: %v", loc.Name, err)
+		return nil, status.Errorf(codes.Internal, "Error obteniendo info del archivo")
+	}
+	if !ok || entry.Deleted || s.checkAccess(loc, username, entry, permRead) != nil {
+		return nil, status.Errorf(codes.NotFound, "El archivo no existe o no tienes permiso")
+	}
+
+	ttl := time.Duration(req.TtlSeconds) * time.Second
+	if ttl == 0 {
+		ttl = defaultLinkTTL
+	}
+	if ttl < 0 || ttl > maxLinkTTL {
+		return nil, status.Errorf(codes.InvalidArgument, "La duración del enlace debe estar entre 1 segundo y %d días", int(maxLinkTTL.Hours()/24))
+	}
+	if req.MaxDownloads < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "El máximo de descargas no puede ser negativo")
+	}
+
+	// 2️⃣ Registrar el enlace y firmarlo
+	link, err := s.links.Create(username, loc.Name, ttl, req.Password, req.MaxDownloads)
+	if err != nil {
+		log.Printf("[ERROR] No se pudo crear el enlace a %s: %v", loc.Name, err)
+		return nil, status.Errorf(codes.Internal, "Error creando el enlace")
+	}
+	url := fmt.Sprintf("%s%s%s?exp=%d&sig=%s", s.publicURL, shareLinkPath, link.ID, link.Expires, s.links.Sign(link.ID, link.Expires))
+
+	log.Printf("[SUCCESS] (%s) %s creó un enlace a %s (vence %s)", time.Now().Format("15:04:05"), username, loc.Name, time.Unix(link.Expires, 0).Format(time.RFC3339))
+	return &pb.ShareLink{Url: url, Expires: link.Expires}, nil
+}
+
+// Servir por HTTP el archivo de un enlace, descifrado. La contraseña, si la tiene, se envía con
+// autenticación básica (el navegador la pide; con curl: -u :contraseña).
+func (s *SyncServer) serveShareLink(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 1️⃣ Validar la firma, la expiración, la contraseña y el máximo de descargas. Un enlace o una dirección con
+	// demasiadas contraseñas incorrectas queda bloqueado un tiempo, como Login.
+	id := strings.TrimPrefix(r.URL.Path, shareLinkPath)
+	expires, err := strconv.ParseInt(r.URL.Query().Get("exp"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	host := r.RemoteAddr
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if wait := s.guard.checkLink(id, host); wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Round(time.Second).Seconds())))
+		http.Error(w, fmt.Sprintf("Demasiadas contraseñas incorrectas; intenta de nuevo en %s", wait.Round(time.Second)), http.StatusTooManyRequests)
+		return
+	}
+	_, password, _ := r.BasicAuth()
+	link, err := s.links.Redeem(id, expires, r.URL.Query().Get("sig"), password)
+	if errors.Is(err, links.ErrBadPassword) {
+		s.guard.linkFailure(id, host)
+	} else if password != "" && err == nil {
+		s.guard.linkSuccess(id)
+	}
+	switch {
+	case errors.Is(err, links.ErrPasswordMissing), errors.Is(err, links.ErrBadPassword):
+		w.Header().Set("WWW-Authenticate", `Basic realm="sync-service", charset="UTF-8"`)
+		http.Error(w, "Este enlace pide contraseña", http.StatusUnauthorized)
+		return
+	case errors.Is(err, links.ErrExpired), errors.Is(err, links.ErrLimitReached):
+		http.Error(w, "El enlace ya no es válido", http.StatusGone)
+		return
+	case errors.Is(err, links.ErrBadSignature), errors.Is(err, links.ErrNotFound):
+		http.NotFound(w, r)
+		return
+	case err != nil:
+		log.Printf("[ERROR] No se pudo validar el enlace %s: %v", id, err)
+		http.Error(w, "Error interno", http.StatusInternalServerError)
+		return
+	}
+
+	// 2️⃣ Abrir el archivo con los permisos de quien creó el enlace (si perdió el acceso, el enlace deja de servir).
+	// Si no se puede enviar, la descarga reservada se devuelve.
+	file, content, size, err := s.openForLink(link)
+	if err != nil {
+		s.refundLink(id)
+	}
+	if os.IsNotExist(err) || errors.Is(err, errForbidden) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] No se pudo leer %s para el enlace %s: %v", link.Filename, id, err)
+		http.Error(w, "Error interno", http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	// 3️⃣ Enviar el archivo como descarga, descifrándolo a medida que se envía
+	name := path.Base(link.Filename)
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	w.Header().Set("Cache-Control", "no-store")
+	if _, err := io.Copy(w, content); err != nil {
+		log.Printf("[ERROR] Error al enviar %s por el enlace %s: %v", link.Filename, id, err)
+		s.refundLink(id)
+		return
+	}
+	log.Printf("[SUCCESS] (%s) %s descargado por enlace desde %s (%d/%d)", time.Now().Format("15:04:05"), link.Filename, r.RemoteAddr, link.Downloads, link.MaxDownloads)
+}
+
+// Devolver la descarga reservada de un enlace cuyo archivo no se envió completo
+func (s *SyncServer) refundLink(id string) {
+	if err := s.links.Refund(id); err != nil {
+		log.Printf("[ERROR] No se pudo devolver la descarga del enlace %s: %v", id, err)
+	}
+}
+
+// Abrir la versión vigente del archivo de un enlace. Devuelve el archivo abierto (hay que cerrarlo), un lector
+// con su contenido descifrado y su tamaño original. Como los archivos se reemplazan con un rename, el archivo
+// abierto sigue siendo esa versión aunque se suba otra mientras se envía.
+func (s *SyncServer) openForLink(link *links.Link) (*os.File, io.Reader, int64, error) {
+	loc, err := resolvePath(link.Creator, link.Filename)
+	if err != nil {
+		return nil, nil, 0, os.ErrNotExist
+	}
+
+	var file *os.File
+	var entry *meta.FileMeta
+	err = s.meta.View(loc.Owner, loc.Path, func(current *meta.FileMeta) error {
+		if current == nil || current.Deleted {
+			return os.ErrNotExist
+		}
+		if err := s.checkAccess(loc, link.Creator, current, permRead); err != nil {
+			return err
+		}
+		entry = current
+		f, err := os.Open(userFilePath(loc.Owner, loc.Path))
+		file = f
+		return err
+	})
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, 0, err
+	}
+	content, err := decryptReaderFor(loc.Owner, link.Creator, entry, file, info.Size())
+	if err != nil {
+		file.Close()
+		return nil, nil, 0, err
+	}
+	return file, content, storedSize(file, info.Size()), nil
+}
+
+// Iniciar el endpoint HTTP de los enlaces
+func (s *SyncServer) serveHTTP(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc(shareLinkPath, s.serveShareLink)
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: httpReadHeaderTimeout,
+		ReadTimeout:       httpReadTimeout,
+		IdleTimeout:       httpIdleTimeout,
+	}
+	log.Printf("Enlaces para compartir servidos en %s (%s)", addr, s.publicURL)
+	if err := server.ListenAndServe(); err != nil {
+		log.Fatalf("Error al iniciar el servidor HTTP: %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Crear un enlace a un archivo de alice y devolver su URL en el servidor de prueba
+func shareLinkURL(t *testing.T, s *SyncServer, base, filename, password string, maxDownloads int32) string {
+	t.Helper()
+	link, err := s.links.Create("alice", filename, time.Hour, password, maxDownloads)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fmt.Sprintf("%s%s%s?exp=%d&sig=%s", base, shareLinkPath, link.ID, link.Expires, s.links.Sign(link.ID, link.Expires))
+}
+
+// El archivo de un enlace se envía descifrado y completo, con su tamaño original
+func TestShareLinkStreamsFile(t *testing.T) {
+	s := newTestServer(t)
+	if err := ensureUserKey("alice"); err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 300000)
+	rand.Read(data)
+	if _, err := s.commitFile("alice", "doc.bin", "alice", bytesContent(data), "", nil, uploadAttrs(0644, 0, "")); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(s.serveShareLink))
+	defer server.Close()
+
+	resp, err := http.Get(shareLinkURL(t, s, server.URL, "doc.bin", "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("estado %d: %s", resp.StatusCode, body)
+	}
+	if resp.Header.Get("Content-Length") != strconv.Itoa(len(data)) {
+		t.Fatalf("Content-Length = %s, se esperaba %d", resp.Header.Get("Content-Length"), len(data))
+	}
+	if !bytes.Equal(body, data) {
+		t.Fatal("el contenido descargado no coincide")
+	}
+
+	resp, err = http.Get(shareLinkURL(t, s, server.URL, "no-existe.bin", "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("archivo inexistente: estado %d, se esperaba 404", resp.StatusCode)
+	}
+}
+
+// Una descarga que no se pudo enviar no cuenta para el máximo del enlace
+func TestShareLinkRefundsFailedDownload(t *testing.T) {
+	s := newTestServer(t)
+	if err := ensureUserKey("alice"); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(s.serveShareLink))
+	defer server.Close()
+	url := shareLinkURL(t, s, server.URL, "doc.txt", "", 1)
+
+	// El archivo todavía no existe: no se envía nada y la descarga se devuelve
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("estado %d, se esperaba 404", resp.StatusCode)
+	}
+
+	if _, err := s.commitFile("alice", "doc.txt", "alice", bytesContent([]byte("hola")), "", nil, uploadAttrs(0644, 0, "")); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []int{http.StatusOK, http.StatusGone} {
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Fatalf("estado %d, se esperaba %d", resp.StatusCode, want)
+		}
+	}
+}
+
+// Tras varias contraseñas incorrectas el enlace se bloquea, aunque después llegue la correcta
+func TestShareLinkLocksAfterBadPasswords(t *testing.T) {
+	s := newTestServer(t)
+	if err := ensureUserKey("alice"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.commitFile("alice", "doc.txt", "alice", bytesContent([]byte("hola")), "", nil, uploadAttrs(0644, 0, "")); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(s.serveShareLink))
+	defer server.Close()
+	url := shareLinkURL(t, s, server.URL, "doc.txt", "secreta", 0)
+
+	get := func(password string) int {
+		req, _ := http.NewRequest(http.MethodGet, url, nil)
+		req.SetBasicAuth("", password)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := get("secreta"); code != http.StatusOK {
+		t.Fatalf("contraseña correcta: estado %d", code)
+	}
+	for i := 0; i < 5; i++ {
+		if code := get("otra"); code != http.StatusUnauthorized {
+			t.Fatalf("intento %d: estado %d, se esperaba 401", i+1, code)
+		}
+	}
+	if code := get("secreta"); code != http.StatusTooManyRequests {
+		t.Fatalf("enlace bloqueado: estado %d, se esperaba 429", code)
+	}
+}
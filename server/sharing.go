@@ -0,0 +1,474 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	pb "github.com/FelipeMarchantVargas/sync-service/proto"
+	"github.com/FelipeMarchantVargas/sync-service/server/auth"
+	"github.com/FelipeMarchantVargas/sync-service/server/groups"
+	"github.com/FelipeMarchantVargas/sync-service/server/meta"
+	"github.com/FelipeMarchantVargas/sync-service/server/policy"
+	"github.com/FelipeMarchantVargas/sync-service/server/users"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ------------------------ ARCHIVOS COMPARTIDOS ------------------------
+
+// Permisos que se pueden dar sobre un archivo compartido
+const (
+	permRead  = "read"  // Descargarlo
+	permWrite = "write" // Descargarlo, modificarlo y borrarlo
+)
+
+// Prefijo con el que un usuario ve los archivos que otro compartió con él: "user:<dueño>/<ruta>"
+const sharedPrefix = "user:"
+
+// Error de un acceso a un archivo ajeno sin el permiso necesario
+var errForbidden = errors.New("no tienes permiso sobre este archivo")
+
+// Error al quitar un acceso que no existe
+var errNotShared = errors.New("el archivo no está compartido con ese usuario")
+
+// Ubicación de un archivo pedido por un cliente
+type location struct {
+	Name  string // Ruta tal como la pide el cliente
+	Owner string // Dueño del espacio donde se guarda el archivo (un usuario o "team:<grupo>")
+	Path  string // Ruta dentro del espacio del dueño
+}
+
+// Ruta con la que un usuario ve un archivo que otro compartió con él
+func sharedPath(owner, path string) string {
+	return sharedPrefix + owner + "/" + path
+}
+
+// Ruta con la que ven un archivo los usuarios que no son su dueño: "user:<dueño>/<ruta>" o "team:<grupo>/<ruta>"
+func externalPath(owner, path string) string {
+	if isTeam(owner) {
+		return owner + "/" + path
+	}
+	return sharedPath(owner, path)
+}
+
+// Interpretar la ruta pedida por un usuario: un archivo propio, uno compartido ("user:<dueño>/<ruta>")
+// o uno de un grupo ("team:<grupo>/<ruta>")
+func resolvePath(username, requested string) (location, error) {
+	name, err := cleanPath(requested)
+	if err != nil {
+		return location{}, err
+	}
+
+	switch {
+	case strings.HasPrefix(name, sharedPrefix):
+		owner, path, ok := strings.Cut(strings.TrimPrefix(name, sharedPrefix), "/")
+		if !ok || users.ValidUsername(owner) != nil {
+			return location{}, fmt.Errorf("ruta compartida inválida (usa %s<usuario>/<ruta>): %s", sharedPrefix, name)
+		}
+		return location{Name: name, Owner: owner, Path: path}, nil
+	case strings.HasPrefix(name, teamPrefix):
+		team, path, ok := strings.Cut(strings.TrimPrefix(name, teamPrefix), "/")
+		if !ok || groups.ValidName(team) != nil {
+			return location{}, fmt.Errorf("ruta de grupo inválida (usa %s<grupo>/<ruta>): %s", teamPrefix, name)
+		}
+		return location{Name: name, Owner: teamPrefix + team, Path: path}, nil
+	}
+	return location{Name: name, Owner: username, Path: name}, nil
+}
+
+// Verificar que un usuario tenga el permiso pedido sobre un archivo. Sobre los archivos ajenos que no
+// se compartieron con él (o de grupos de los que no es miembro) devuelve os.ErrNotExist, para no revelar que existen.
+func (s *SyncServer) checkAccess(loc location, username string, current *meta.FileMeta, perm string) error {
+	if username == loc.Owner {
+		return nil
+	}
+	if team, ok := teamName(loc.Owner); ok {
+		role := s.groups.Role(team, username)
+		if role == "" {
+			return os.ErrNotExist
+		}
+		if perm == permWrite && !groups.CanWrite(role) {
+			return errForbidden
+		}
+		return nil
+	}
+	if current == nil || current.Deleted {
+		return os.ErrNotExist
+	}
+	granted := current.Shares[username]
+	if granted == "" {
+		return os.ErrNotExist
+	}
+	if perm == permWrite && granted != permWrite {
+		return errForbidden
+	}
+	return nil
+}
+
+// Convertir un acceso denegado en el error gRPC que recibe el cliente (nil si err no lo es)
+func forbiddenStatus(path string, err error) error {
+	if !errors.Is(err, errForbidden) {
+		return nil
+	}
+	return status.Errorf(codes.PermissionDenied, "No tienes permiso para modificar %s", path)
+}
+
+// Verificar que un usuario tenga su clave de cifrado y crearla si todavía no la tiene
+func ensureUserKey(username string) error {
+	if _, err := auth.GetAESKey(username); err == nil {
+		log.Printf("[INFO] Clave AES ya existe para %s", username)
+		return nil
+	}
+	log.Printf("[INFO] Clave de cifrado no encontrada para %s, generando nueva...", username)
+	if _, err := auth.GenerateAESKey(username); err != nil {
+		log.Printf("[ERROR] No se pudo generar clave AES para %s: %v", username, err)
+		return err
+	}
+	log.Printf("[SUCCESS] Clave AES generada para %s", username)
+	return nil
+}
+
+// ------------------------ CLAVES POR ARCHIVO ------------------------
+
+// Usuario (o grupo) cuya clave desenvuelve la clave de datos de un archivo para quien lo pide:
+// en un espacio de grupo, la clave del grupo; si no, la del propio usuario
+func keyHolder(owner, username string) string {
+	if isTeam(owner) {
+		return owner
+	}
+	return username
+}
+
+// Envolver la clave de datos de un archivo con la clave de un usuario (la nueva, si está rotando su clave)
+func wrapFor(username string, dataKey []byte) (string, error) {
+	if key, ok := auth.PendingAESKey(username); ok {
+		return auth.WrapKey(dataKey, key)
+	}
+	key, err := auth.GetAESKey(username)
+	if err != nil {
+		return "", err
+	}
+	return auth.WrapKey(dataKey, key)
+}
+
+// Obtener la clave de datos de un archivo con la clave de un usuario que tiene acceso a él
+// (durante una rotación, la clave envuelta puede estar con la clave anterior o con la nueva)
+func unwrapFor(username string, entry *meta.FileMeta) ([]byte, error) {
+	if entry == nil || entry.Keys[username] == "" {
+		return nil, errForbidden
+	}
+	key, err := auth.GetAESKey(username)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := auth.UnwrapKey(entry.Keys[username], key)
+	if err != nil {
+		if pending, ok := auth.PendingAESKey(username); ok {
+			return auth.UnwrapKey(entry.Keys[username], pending)
+		}
+	}
+	return dataKey, err
+}
+
+// Clave de datos con la que se cifra una nueva versión de un archivo: la que ya tiene (con la clave de
+// quien escribe o la de su grupo) o, si todavía no tiene una, una nueva envuelta para su dueño.
+// Devuelve también las claves envueltas que se guardan en los metadatos.
+func dataKeyFor(owner, username string, current *meta.FileMeta) ([]byte, map[string]string, error) {
+	holder := keyHolder(owner, username)
+	if current != nil && current.Keys[holder] != "" {
+		dataKey, err := unwrapFor(holder, current)
+		if err != nil {
+			return nil, nil, err
+		}
+		return dataKey, current.Keys, nil
+	}
+	if holder != owner {
+		return nil, nil, errForbidden
+	}
+
+	dataKey, err := auth.GenerateDataKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	wrapped, err := wrapFor(owner, dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return dataKey, map[string]string{owner: wrapped}, nil
+}
+
+// Clave con la que un usuario con acceso a un archivo descifra su contenido guardado: la clave de datos del
+// archivo o, en el formato anterior a las claves por archivo (sealed = false), la clave del dueño
+func fileKeyFor(owner, username string, entry *meta.FileMeta, sealed bool) ([]byte, error) {
+	holder := keyHolder(owner, username)
+	if !sealed {
+		// Formato anterior a las claves por archivo: cifrado con la clave del dueño, que nunca se usa para otros
+		if holder != owner {
+			return nil, errForbidden
+		}
+		return auth.GetAESKey(owner)
+	}
+	return unwrapFor(holder, entry)
+}
+
+// Descifrar el contenido guardado de un archivo (o de una versión anterior) para un usuario con acceso a él
+func decryptFor(owner, username string, entry *meta.FileMeta, encryptedData []byte) ([]byte, error) {
+	sealed := auth.IsSealed(encryptedData)
+	key, err := fileKeyFor(owner, username, entry, sealed)
+	if err != nil {
+		return nil, err
+	}
+	if !sealed {
+		return auth.DecryptData(encryptedData, key)
+	}
+	return auth.OpenData(encryptedData, key)
+}
+
+// Tamaño original de un archivo guardado que ocupa size bytes en el disco
+func storedSize(file io.ReaderAt, size int64) int64 {
+	if auth.IsSealedAt(file) {
+		return auth.OpenedSize(size)
+	}
+	return auth.DecryptedSize(size)
+}
+
+// Descifrar solo length bytes desde offset de un archivo guardado (o de una versión anterior), leyendo del
+// disco únicamente esa porción. El rango debe estar dentro del archivo (ver storedSize).
+func decryptRangeFor(owner, username string, entry *meta.FileMeta, file io.ReaderAt, size, offset, length int64) ([]byte, error) {
+	sealed := auth.IsSealedAt(file)
+	key, err := fileKeyFor(owner, username, entry, sealed)
+	if err != nil {
+		return nil, err
+	}
+	if !sealed {
+		return auth.DecryptRange(file, key, offset, length)
+	}
+	return auth.OpenRange(file, size, key, offset, length)
+}
+
+// Lector que descifra completo un archivo guardado de size bytes a medida que se lee, sin cargarlo en memoria
+func decryptReaderFor(owner, username string, entry *meta.FileMeta, file io.ReaderAt, size int64) (io.Reader, error) {
+	sealed := auth.IsSealedAt(file)
+	key, err := fileKeyFor(owner, username, entry, sealed)
+	if err != nil {
+		return nil, err
+	}
+	section := io.NewSectionReader(file, 0, size)
+	if !sealed {
+		return auth.NewDecryptReader(section, key)
+	}
+	return auth.NewOpenReader(section, key)
+}
+
+// Dar a otro usuario acceso a un archivo: su clave de datos se envuelve también con la clave de ese usuario.
+// Un archivo cifrado con el formato anterior se vuelve a cifrar antes con una clave de datos propia.
+// Se avisa al otro usuario antes de soltar el índice, así el aviso queda antes de los cambios siguientes del archivo.
+func (s *SyncServer) shareFile(owner, path, grantee, perm string) (*meta.FileMeta, error) {
+	return s.meta.UpdateThen(owner, path, func(current *meta.FileMeta) (*meta.FileMeta, error) {
+		if current == nil || current.Deleted {
+			return nil, os.ErrNotExist
+		}
+		next := current.Clone()
+
+		filePath := userFilePath(owner, path)
+		encryptedData, err := os.ReadFile(filePath)
+		if err != nil {
+			return nil, err
+		}
+		if !auth.IsSealed(encryptedData) || next.Keys[owner] == "" {
+			data, err := decryptFor(owner, owner, current, encryptedData)
+			if err != nil {
+				return nil, err
+			}
+			dataKey, keys, err := dataKeyFor(owner, owner, nil)
+			if err != nil {
+				return nil, err
+			}
+			// Los usuarios que ya tenían acceso reciben la clave nueva
+			for user := range next.Shares {
+				if keys[user], err = wrapFor(user, dataKey); err != nil {
+					return nil, err
+				}
+			}
+			sealed, err := auth.SealData(data, dataKey)
+			if err != nil {
+				return nil, err
+			}
+			if err := writeFileAtomic(filePath, sealed); err != nil {
+				return nil, err
+			}
+			next.Keys = keys
+		}
+
+		dataKey, err := unwrapFor(owner, next)
+		if err != nil {
+			return nil, err
+		}
+		if next.Keys[grantee], err = wrapFor(grantee, dataKey); err != nil {
+			return nil, err
+		}
+		if next.Shares == nil {
+			next.Shares = make(map[string]string)
+		}
+		next.Shares[grantee] = perm
+		return next, nil
+	}, func(next *meta.FileMeta) {
+		s.publishShare(owner, grantee, next, "shared")
+	})
+}
+
+// Quitar el acceso de un usuario a un archivo (se borra su copia de la clave de datos) y avisarle como en shareFile
+func (s *SyncServer) unshareFile(owner, path, grantee string) (*meta.FileMeta, error) {
+	return s.meta.UpdateThen(owner, path, func(current *meta.FileMeta) (*meta.FileMeta, error) {
+		if current == nil || current.Deleted {
+			return nil, os.ErrNotExist
+		}
+		if current.Shares[grantee] == "" {
+			return nil, errNotShared
+		}
+		next := current.Clone()
+		delete(next.Shares, grantee)
+		delete(next.Keys, grantee)
+		if len(next.Shares) == 0 {
+			next.Shares = nil
+		}
+		return next, nil
+	}, func(next *meta.FileMeta) {
+		s.publishShare(owner, grantee, next, "unshared")
+	})
+}
+
+// Archivo que otro usuario compartió
+type sharedFile struct {
+	Owner      string
+	Entry      *meta.FileMeta
+	Permission string
+}
+
+// Archivos vigentes que otros usuarios compartieron con un usuario, ordenados por dueño y ruta
+// (se buscan en el índice de archivos compartidos de los metadatos, sin leer los archivos de todos)
+func (s *SyncServer) sharedWith(username string) ([]sharedFile, error) {
+	shared, err := s.meta.SharedWith(username)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []sharedFile
+	for _, file := range shared {
+		if file.Owner == username || isTeam(file.Owner) {
+			continue
+		}
+		files = append(files, sharedFile{Owner: file.Owner, Entry: file.Entry, Permission: file.Entry.Shares[username]})
+	}
+	return files, nil
+}
+
+// Validar la petición para compartir (o dejar de compartir) un archivo propio
+func (s *SyncServer) shareTarget(username string, req *pb.ShareRequest) (location, error) {
+	loc, err := resolvePath(username, req.Filename)
+	if err != nil {
+		return loc, status.Errorf(codes.InvalidArgument, "Ruta inválida: %v", err)
+	}
+	if loc.Owner != username {
+		return loc, status.Errorf(codes.PermissionDenied, "Solo el dueño puede compartir %s", loc.Name)
+	}
+	if req.Username == username {
+		return loc, status.Errorf(codes.InvalidArgument, "No puedes compartir un archivo contigo mismo")
+	}
+	if !s.users.Exists(req.Username) {
+		return loc, status.Errorf(codes.NotFound, "El usuario %s no existe", req.Username)
+	}
+	return loc, nil
+}
+
+// Dar acceso de lectura o de lectura y escritura a otro usuario sobre un archivo propio
+func (s *SyncServer) ShareFile(ctx context.Context, req *pb.ShareRequest) (*pb.UploadResponse, error) {
+	username, err := authorize(ctx, policy.Share)
+	if err != nil {
+		return nil, err
+	}
+
+	// 1️⃣ Validar el archivo, el usuario y el permiso
+	loc, err := s.shareTarget(username, req)
+	if err != nil {
+		return nil, err
+	}
+	perm := req.Permission
+	if perm == "" {
+		perm = permRead
+	}
+	if perm != permRead && perm != permWrite {
+		return nil, status.Errorf(codes.InvalidArgument, "Permiso no soportado: %s (usa read o write)", perm)
+	}
+	if err := ensureUserKey(req.Username); err != nil {
+		return nil, status.Errorf(codes.Internal, "Error generando clave de cifrado")
+	}
+
+	// 2️⃣ Envolver la clave del archivo para el otro usuario, registrar el permiso y avisarle
+	entry, err := s.shareFile(username, loc.Path, req.Username, perm)
+	if os.IsNotExist(err) {
+		return nil, status.Errorf(codes.NotFound, "El archivo %s no existe en el servidor", loc.Name)
+	}
+	if err != nil {
+		log.Printf("[ERROR] No se pudo compartir %s con %s: %v", loc.Name, req.Username, err)
+		return nil, status.Errorf(codes.Internal, "Error al compartir %s", loc.Name)
+	}
+
+	log.Printf("[SUCCESS] (%s) %s compartió %s con %s (%s)", time.Now().Format("15:04:05"), username, loc.Name, req.Username, perm)
+	return &pb.UploadResponse{Message: "Archivo compartido correctamente", Version: entry.Version, Hash: entry.Hash}, nil
+}
+
+// Quitar el acceso de otro usuario a un archivo propio
+func (s *SyncServer) UnshareFile(ctx context.Context, req *pb.ShareRequest) (*pb.UploadResponse, error) {
+	username, err := authorize(ctx, policy.Share)
+	if err != nil {
+		return nil, err
+	}
+
+	loc, err := s.shareTarget(username, req)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := s.unshareFile(username, loc.Path, req.Username)
+	if os.IsNotExist(err) {
+		return nil, status.Errorf(codes.NotFound, "El archivo %s no existe en el servidor", loc.Name)
+	}
+	if errors.Is(err, errNotShared) {
+		return nil, status.Errorf(codes.NotFound, "%s no está compartido con %s", loc.Name, req.Username)
+	}
+	if err != nil {
+		log.Printf("[ERROR] No se pudo dejar de compartir %s con %s: %v", loc.Name, req.Username, err)
+		return nil, status.Errorf(codes.Internal, "Error al dejar de compartir %s", loc.Name)
+	}
+
+	log.Printf("[SUCCESS] (%s) %s dejó de compartir %s con %s", time.Now().Format("15:04:05"), username, loc.Name, req.Username)
+	return &pb.UploadResponse{Message: "Se quitó el acceso al archivo", Version: entry.Version, Hash: entry.Hash}, nil
+}
+
+// Listar los archivos que otros usuarios compartieron con el usuario
+func (s *SyncServer) ListSharedWithMe(ctx context.Context, req *pb.Empty) (*pb.SharedFileList, error) {
+	username, err := authorize(ctx, policy.Read)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := s.sharedWith(username)
+	if err != nil {
+		log.Printf("[ERROR] No se pudo listar los archivos compartidos con %s: %v", username, err)
+		return nil, status.Errorf(codes.Internal, "Error listando archivos compartidos")
+	}
+
+	resp := &pb.SharedFileList{}
+	for _, file := range files {
+		info := fileInfo(file.Entry)
+		info.Filename = sharedPath(file.Owner, file.Entry.Path)
+		resp.Files = append(resp.Files, &pb.SharedFile{Owner: file.Owner, Permission: file.Permission, Info: info})
+	}
+	return resp, nil
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/FelipeMarchantVargas/sync-service/server/auth"
+	"github.com/FelipeMarchantVargas/sync-service/server/meta"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ------------------------ ALMACENAMIENTO ------------------------
+
+// Directorio con las versiones anteriores de los archivos (cifradas igual que las vigentes)
+const historyDir = "./history"
+
+// Versiones anteriores que se conservan por archivo
+const maxHistoryVersions = 50
+
+// Ruta del archivo cifrado de un usuario en el disco
+func userFilePath(username, path string) string {
+	return filepath.Join(storageDir, username, filepath.FromSlash(path)+".enc")
+}
+
+// Ruta de una versión anterior de un archivo: history/<usuario>/<ruta>.v<versión>.enc
+func historyFilePath(username, path string, version int64) string {
+	return filepath.Join(historyDir, username, filepath.FromSlash(path)+fmt.Sprintf(".v%d.enc", version))
+}
+
+// Guardar en el historial la versión vigente de un archivo antes de reemplazarla o borrarla
+// (no hace nada si el archivo ya no está en el disco)
+func archiveVersion(username, path string, version int64) error {
+	src, err := os.Open(userFilePath(username, path))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst := historyFilePath(username, path, version)
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+		return err
+	}
+	err = writeFileAtomicWith(dst, func(w io.Writer) error {
+		_, err := io.Copy(w, src)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	// Descartar la versión que quedó fuera del historial
+	os.Remove(historyFilePath(username, path, version-maxHistoryVersions))
+	return nil
+}
+
+// Mover a otra ruta las versiones anteriores de un archivo cuya versión vigente es version
+// (reemplazan las del mismo número que hubiera dejado un archivo borrado en el destino)
+func moveHistory(username, from, to string, version int64) error {
+	for v := max(1, version-maxHistoryVersions); v < version; v++ {
+		src := historyFilePath(username, from, v)
+		if _, err := os.Stat(src); os.IsNotExist(err) {
+			continue
+		}
+		dst := historyFilePath(username, to, v)
+		if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+			return err
+		}
+		if err := os.Rename(src, dst); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SHA-256 del contenido original de un archivo (hex)
+func hashData(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Contenido de un archivo que se guarda: su tamaño y cómo escribirlo. Así un archivo ensamblado desde
+// partes se cifra a medida que se leen, sin tenerlo completo en memoria.
+type fileContent struct {
+	Size  int64
+	Write func(w io.Writer) error
+}
+
+// Contenido que ya está en memoria
+func bytesContent(data []byte) fileContent {
+	return fileContent{Size: int64(len(data)), Write: func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	}}
+}
+
+// Contador de bytes escritos
+type countingWriter struct{ n int64 }
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
+// Error de una escritura hecha sobre una versión que ya no es la vigente
+type versionConflictError struct {
+	Base    int64 // Versión de la que partió el cliente
+	Current int64 // Versión vigente en el servidor (0 si no existe)
+}
+
+func (e *versionConflictError) Error() string {
+	return fmt.Sprintf("conflicto de versiones: el cambio parte de la versión %d y la vigente es la %d", e.Base, e.Current)
+}
+
+// Verificar que la versión base enviada por el cliente sea la vigente (sin base no se verifica)
+func checkBaseVersion(current *meta.FileMeta, base *int64) error {
+	if base == nil {
+		return nil
+	}
+	var version int64
+	if current != nil && !current.Deleted {
+		version = current.Version
+	}
+	if *base != version {
+		return &versionConflictError{Base: *base, Current: version}
+	}
+	return nil
+}
+
+// Convertir un conflicto de versiones en el error gRPC que recibe el cliente (nil si err no es un conflicto)
+func conflictStatus(path string, err error) error {
+	var conflict *versionConflictError
+	if !errors.As(err, &conflict) {
+		return nil
+	}
+	log.Printf("[INFO] (%s) Conflicto en %s: %v", time.Now().Format("15:04:05"), path, conflict)
+	return status.Errorf(codes.Aborted, "Conflicto en %s: se esperaba la versión %d y la vigente es la %d", path, conflict.Base, conflict.Current)
+}
+
+// Atributos enviados por el cliente al subir un archivo (los permisos se limitan a rwx)
+func uploadAttrs(mode uint32, mtime int64, linkTarget string) meta.Attrs {
+	return meta.Attrs{Mode: mode & 0777, MTime: mtime, LinkTarget: linkTarget}
+}
+
+// Cifrar y guardar un archivo del espacio de owner escrito por username (el dueño o un usuario con permiso
+// de escritura), registrando su nueva versión y sus atributos en los metadatos. El archivo se cifra con su
+// clave de datos, que se conserva entre versiones.
+// Si se indica una versión base y no es la vigente, devuelve *versionConflictError sin escribir nada;
+// si username no puede escribir el archivo, errForbidden u os.ErrNotExist; si se supera la cuota de un grupo, errQuotaExceeded.
+// El cambio ("created" o "modified") se publica antes de soltar el índice del espacio, así los eventos quedan en
+// el mismo orden que las versiones. Devuelve los metadatos resultantes.
+func (s *SyncServer) commitFile(owner, path, username string, content fileContent, device string, baseVersion *int64, attrs meta.Attrs) (*meta.FileMeta, error) {
+	action := "created"
+	return s.meta.UpdateThen(owner, path, func(current *meta.FileMeta) (*meta.FileMeta, error) {
+		if err := s.checkAccess(location{Owner: owner, Path: path}, username, current, permWrite); err != nil {
+			return nil, err
+		}
+		if err := checkBaseVersion(current, baseVersion); err != nil {
+			return nil, err
+		}
+		if err := s.checkQuota(owner, path, content.Size); err != nil {
+			return nil, err
+		}
+
+		dataKey, keys, err := dataKeyFor(owner, username, current)
+		if err != nil {
+			return nil, err
+		}
+
+		if current != nil && !current.Deleted {
+			if err := archiveVersion(owner, path, current.Version); err != nil {
+				return nil, err
+			}
+		}
+
+		filePath := userFilePath(owner, path)
+		if err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
+			return nil, err
+		}
+
+		// Cifrar el contenido a medida que se escribe, calculando su hash y su tamaño
+		hash := sha256.New()
+		var written countingWriter
+		err = writeFileAtomicWith(filePath, func(w io.Writer) error {
+			sealer, err := auth.NewSealWriter(w, dataKey)
+			if err != nil {
+				return err
+			}
+			return content.Write(io.MultiWriter(sealer, hash, &written))
+		})
+		if err != nil {
+			return nil, err
+		}
+		if written.n != content.Size {
+			return nil, fmt.Errorf("se escribieron %d bytes y se esperaban %d", written.n, content.Size)
+		}
+
+		next := &meta.FileMeta{
+			Version: 1,
+			Size:    written.n,
+			Hash:    hex.EncodeToString(hash.Sum(nil)),
+			ModTime: time.Now().Unix(),
+			Device:  device,
+			Attrs:   attrs,
+			Keys:    keys,
+		}
+		if current != nil {
+			next.Version = current.Version + 1
+			if !current.Deleted {
+				action = "modified"
+				next.Shares = current.Shares
+			} else {
+				// Un archivo creado de nuevo sobre uno borrado no hereda sus accesos compartidos
+				next.Keys = map[string]string{owner: keys[owner]}
+			}
+		}
+		return next, nil
+	}, func(next *meta.FileMeta) {
+		s.publishChange(owner, next, action)
+	})
+}
+
+// Eliminar un archivo del espacio de owner (lo pide username, el dueño o un usuario con permiso de escritura)
+// dejando una marca de borrado con una nueva versión en los metadatos. La marca conserva la clave del archivo
+// (para leer su historial) y los accesos compartidos (para avisar del borrado a esos usuarios).
+// Devuelve os.ErrNotExist si el archivo no existe, errForbidden si username no puede borrarlo
+// y *versionConflictError si la versión base no es la vigente. El borrado se publica como commitFile.
+func (s *SyncServer) removeFile(owner, path, username string, device string, baseVersion *int64) (*meta.FileMeta, error) {
+	return s.meta.UpdateThen(owner, path, func(current *meta.FileMeta) (*meta.FileMeta, error) {
+		if err := s.checkAccess(location{Owner: owner, Path: path}, username, current, permWrite); err != nil {
+			return nil, err
+		}
+		if current != nil && !current.Deleted {
+			if err := checkBaseVersion(current, baseVersion); err != nil {
+				return nil, err
+			}
+			if err := archiveVersion(owner, path, current.Version); err != nil {
+				return nil, err
+			}
+		}
+		if err := os.Remove(userFilePath(owner, path)); err != nil {
+			return nil, err
+		}
+
+		next := &meta.FileMeta{Version: 1, Deleted: true, ModTime: time.Now().Unix(), Device: device}
+		if current != nil {
+			next.Version = current.Version + 1
+			next.Keys, next.Shares = current.Keys, current.Shares
+		}
+		return next, nil
+	}, func(next *meta.FileMeta) {
+		s.publishChange(owner, next, "deleted")
+	})
+}
+
+// Error de un movimiento cuyo destino ya existe
+var errDestinationExists = errors.New("el destino ya existe")
+
+// Mover un archivo del espacio de owner a otra ruta sin volver a cifrarlo (lo pide username: el dueño o un miembro
+// del grupo con permiso de escritura): se renombra en el disco junto con su historial (con su clave y sus accesos
+// compartidos) y la ruta anterior queda con una marca de borrado. Devuelve los metadatos del destino, os.ErrNotExist
+// si el origen no existe, errForbidden si username no puede modificarlo, errDestinationExists si el destino ya existe
+// y *versionConflictError si la versión base no es la vigente. El movimiento se publica como commitFile.
+func (s *SyncServer) moveFile(owner, from, to, username, device string, baseVersion *int64) (*meta.FileMeta, error) {
+	_, entry, err := s.meta.MoveThen(owner, from, to, func(src, dst *meta.FileMeta) (*meta.FileMeta, *meta.FileMeta, error) {
+		if err := s.checkAccess(location{Owner: owner, Path: from}, username, src, permWrite); err != nil {
+			return nil, nil, err
+		}
+		if src == nil || src.Deleted {
+			return nil, nil, os.ErrNotExist
+		}
+		if err := checkBaseVersion(src, baseVersion); err != nil {
+			return nil, nil, err
+		}
+		if dst != nil && !dst.Deleted {
+			return nil, nil, errDestinationExists
+		}
+
+		target := userFilePath(owner, to)
+		if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+			return nil, nil, err
+		}
+		if err := os.Rename(userFilePath(owner, from), target); err != nil {
+			return nil, nil, err
+		}
+		if err := moveHistory(owner, from, to, src.Version); err != nil {
+			return nil, nil, err
+		}
+
+		// El destino sigue la numeración del origen para que su historial conserve las mismas versiones
+		// (y sea mayor que la de una marca de borrado anterior en el destino)
+		now := time.Now().Unix()
+		nextSrc := &meta.FileMeta{Version: src.Version + 1, Deleted: true, ModTime: now, Device: device, Keys: src.Keys}
+		nextDst := &meta.FileMeta{Version: src.Version, Size: src.Size, Hash: src.Hash, ModTime: now, Device: device, Attrs: src.Attrs, Keys: src.Keys, Shares: src.Shares}
+		if dst != nil {
+			nextDst.Version = max(src.Version, dst.Version+1)
+		}
+		return nextSrc, nextDst, nil
+	}, func(_, dst *meta.FileMeta) {
+		s.publishMove(owner, dst, from)
+	})
+	return entry, err
+}
+
+// Normalizar una ruta relativa enviada por un cliente ("dir/archivo.txt").
+// Se rechazan rutas absolutas o que intenten salir del espacio del usuario.
+func cleanPath(p string) (string, error) {
+	p = strings.ReplaceAll(p, "\\", "/")
+	if strings.HasPrefix(p, "/") {
+		return "", fmt.Errorf("la ruta debe ser relativa: %s", p)
+	}
+	for _, part := range strings.Split(p, "/") {
+		if part == ".." {
+			return "", fmt.Errorf("la ruta no puede contener '..': %s", p)
+		}
+	}
+	p = path.Clean(p)
+	if p == "." || p == "" {
+		return "", fmt.Errorf("ruta vacía")
+	}
+	return p, nil
+}
+
+// Registrar en los metadatos los archivos guardados antes de que existieran (o copiados a mano con el servidor apagado)
+func (s *SyncServer) indexUntrackedFiles() {
+	filepath.WalkDir(storageDir, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(d.Name(), ".enc") || strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+		rel, err := filepath.Rel(storageDir, filePath)
+		if err != nil {
+			return nil
+		}
+		parts := strings.SplitN(filepath.ToSlash(rel), "/", 2)
+		if len(parts) != 2 {
+			return nil
+		}
+		username, path := parts[0], strings.TrimSuffix(parts[1], ".enc")
+		if _, ok, err := s.meta.Get(username, path); err == nil && !ok {
+			s.reconcileExternalChange(username, path)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+// Al mover un archivo, sus versiones anteriores se mueven con él y siguen legibles con el mismo número
+func TestMoveKeepsHistory(t *testing.T) {
+	s := newTestServer(t)
+	if err := ensureUserKey("alice"); err != nil {
+		t.Fatal(err)
+	}
+	contents := []string{"uno", "dos", "tres"}
+	for _, content := range contents {
+		if _, err := s.commitFile("alice", "a/doc.txt", "alice", bytesContent([]byte(content)), "", nil, uploadAttrs(0644, 0, "")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entry, err := s.moveFile("alice", "a/doc.txt", "b/nuevo.txt", "alice", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Version != int64(len(contents)) {
+		t.Fatalf("versión %d en el destino, se esperaba %d", entry.Version, len(contents))
+	}
+
+	for version := int64(1); version < entry.Version; version++ {
+		if _, err := os.Stat(historyFilePath("alice", "a/doc.txt", version)); !os.IsNotExist(err) {
+			t.Fatalf("la versión %d sigue en la ruta anterior", version)
+		}
+		data, err := os.ReadFile(historyFilePath("alice", "b/nuevo.txt", version))
+		if err != nil {
+			t.Fatalf("falta la versión %d en la nueva ruta: %v", version, err)
+		}
+		plain, err := decryptFor("alice", "alice", entry, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(plain) != contents[version-1] {
+			t.Fatalf("versión %d: %q, se esperaba %q", version, plain, contents[version-1])
+		}
+	}
+}
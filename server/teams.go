@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	pb "github.com/FelipeMarchantVargas/sync-service/proto"
+	"github.com/FelipeMarchantVargas/sync-service/server/groups"
+	"github.com/FelipeMarchantVargas/sync-service/server/policy"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ------------------------ GRUPOS ------------------------
+
+// Prefijo del espacio de archivos de un grupo: sus archivos se guardan con el dueño "team:<grupo>"
+// (storage/team:<grupo>, meta/team:<grupo>.json, keys/team:<grupo>.key) y sus miembros los ven como "team:<grupo>/<ruta>"
+const teamPrefix = "team:"
+
+// Error de una escritura que haría superar la cuota de un grupo
+var errQuotaExceeded = errors.New("se superó la cuota del grupo")
+
+// Indicar si el dueño de un espacio es un grupo
+func isTeam(owner string) bool {
+	return strings.HasPrefix(owner, teamPrefix)
+}
+
+// Nombre del grupo dueño de un espacio ("team:<grupo>")
+func teamName(owner string) (string, bool) {
+	if !isTeam(owner) {
+		return "", false
+	}
+	return strings.TrimPrefix(owner, teamPrefix), true
+}
+
+// Bytes que ocupan los archivos vigentes de un espacio, sin contar el de la ruta indicada
+func (s *SyncServer) spaceUsage(owner, except string) (int64, error) {
+	entries, err := s.meta.List(owner, false)
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, entry := range entries {
+		if entry.Path != except {
+			total += entry.Size
+		}
+	}
+	return total, nil
+}
+
+// Verificar que guardar size bytes en una ruta de un espacio de grupo no supere su cuota.
+// Se llama con el índice del espacio tomado (dentro de meta.Update), así dos subidas simultáneas no pueden
+// pasar la revisión con el mismo uso y superar juntas la cuota.
+func (s *SyncServer) checkQuota(owner, path string, size int64) error {
+	team, ok := teamName(owner)
+	if !ok {
+		return nil
+	}
+	group, ok := s.groups.Get(team)
+	if !ok || group.Quota <= 0 {
+		return nil
+	}
+	used, err := s.meta.UsageLocked(owner, path)
+	if err != nil {
+		return err
+	}
+	if used+size > group.Quota {
+		return errQuotaExceeded
+	}
+	return nil
+}
+
+// Convertir una cuota superada en el error gRPC que recibe el cliente (nil si err no lo es)
+func quotaStatus(path string, err error) error {
+	if !errors.Is(err, errQuotaExceeded) {
+		return nil
+	}
+	return status.Errorf(codes.ResourceExhausted, "No se pudo guardar %s: se superó la cuota del grupo", path)
+}
+
+// Archivos vigentes de los grupos de un usuario, con la ruta con que los ve ("team:<grupo>/<ruta>")
+func (s *SyncServer) teamFiles(username string) ([]*pb.FileInfo, error) {
+	var files []*pb.FileInfo
+	for _, group := range s.groups.ForMember(username) {
+		owner := teamPrefix + group.Name
+		entries, err := s.meta.List(owner, false)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			info := fileInfo(entry)
+			info.Filename = externalPath(owner, entry.Path)
+			files = append(files, info)
+		}
+	}
+	return files, nil
+}
+
+// Avisar a un usuario que entró ("shared") o salió ("unshared") de un grupo con cada archivo del grupo,
+// para que sus clientes los descarguen o borren sus copias
+func (s *SyncServer) publishTeamAccess(team, username, action string) {
+	owner := teamPrefix + team
+	entries, err := s.meta.List(owner, false)
+	if err != nil {
+		log.Printf("[ERROR] No se pudo leer los archivos del grupo %s: %v", team, err)
+		return
+	}
+	for _, entry := range entries {
+		s.publishShare(owner, username, entry, action)
+	}
+}
+
+// Servicio de grupos. Es un tipo aparte porque cada servicio gRPC necesita su propia implementación
+// "Unimplemented" embebida; comparte el estado del servidor de sincronización.
+type GroupServer struct {
+	pb.UnimplementedGroupServiceServer
+	sync  *SyncServer
+	quota int64 // Cuota con la que se crean los grupos (bytes, 0 = sin límite)
+}
+
+// Convertir los errores de los grupos en el error gRPC que recibe el cliente
+func groupStatus(name string, err error) error {
+	switch {
+	case errors.Is(err, groups.ErrNotFound):
+		return status.Errorf(codes.NotFound, "El grupo %s no existe", name)
+	case errors.Is(err, groups.ErrExists):
+		return status.Errorf(codes.AlreadyExists, "El grupo %s ya existe", name)
+	case errors.Is(err, groups.ErrNotAllowed):
+		return status.Errorf(codes.PermissionDenied, "Solo un dueño del grupo %s puede hacer esto", name)
+	case errors.Is(err, groups.ErrNotMember):
+		return status.Errorf(codes.NotFound, "El usuario no es miembro del grupo %s", name)
+	case errors.Is(err, groups.ErrLastOwner):
+		return status.Errorf(codes.FailedPrecondition, "El grupo %s debe tener al menos un dueño", name)
+	}
+	log.Printf("[ERROR] Error en el grupo %s: %v", name, err)
+	return status.Errorf(codes.Internal, "Error actualizando el grupo %s", name)
+}
+
+// Convertir un grupo al mensaje del protocolo, con lo que ocupan hoy sus archivos
+func (g *GroupServer) groupInfo(group *groups.Group) *pb.Group {
+	info := &pb.Group{Name: group.Name, Quota: group.Quota}
+	for _, username := range group.Usernames() {
+		info.Members = append(info.Members, &pb.GroupMember{Username: username, Role: group.Members[username]})
+	}
+	if usage, err := g.sync.spaceUsage(teamPrefix+group.Name, ""); err == nil {
+		info.Usage = usage
+	}
+	return info
+}
+
+// Crear un grupo con quien lo pide como dueño
+func (g *GroupServer) CreateGroup(ctx context.Context, req *pb.GroupRequest) (*pb.Group, error) {
+	username, err := authorize(ctx, policy.Groups)
+	if err != nil {
+		return nil, err
+	}
+	if err := groups.ValidName(req.Name); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Nombre inválido: %v", err)
+	}
+
+	// 1️⃣ Crear la clave del grupo, con la que se envuelven las claves de sus archivos
+	if err := ensureUserKey(teamPrefix + req.Name); err != nil {
+		return nil, status.Errorf(codes.Internal, "Error generando clave de cifrado")
+	}
+
+	// 2️⃣ Registrar el grupo
+	group, err := g.sync.groups.Create(req.Name, username, g.quota)
+	if err != nil {
+		return nil, groupStatus(req.Name, err)
+	}
+
+	log.Printf("[SUCCESS] (%s) %s creó el grupo %s", time.Now().Format("15:04:05"), username, req.Name)
+	return g.groupInfo(group), nil
+}
+
+// Agregar un miembro a un grupo o cambiar su rol (solo un dueño del grupo)
+func (g *GroupServer) AddMember(ctx context.Context, req *pb.MemberRequest) (*pb.Group, error) {
+	username, err := authorize(ctx, policy.Groups)
+	if err != nil {
+		return nil, err
+	}
+
+	role := req.Role
+	if role == "" {
+		role = groups.RoleMember
+	}
+	if !groups.ValidRole(role) {
+		return nil, status.Errorf(codes.InvalidArgument, "Rol no soportado: %s (usa owner, member o viewer)", role)
+	}
+	if !g.sync.users.Exists(req.Username) {
+		return nil, status.Errorf(codes.NotFound, "El usuario %s no existe", req.Username)
+	}
+
+	wasMember := g.sync.groups.Role(req.Group, req.Username) != ""
+	group, err := g.sync.groups.SetMember(req.Group, username, req.Username, role)
+	if err != nil {
+		return nil, groupStatus(req.Group, err)
+	}
+
+	// Un miembro nuevo recibe los archivos del grupo
+	if !wasMember {
+		g.sync.publishTeamAccess(req.Group, req.Username, "shared")
+	}
+
+	log.Printf("[SUCCESS] (%s) %s agregó a %s al grupo %s (%s)", time.Now().Format("15:04:05"), username, req.Username, req.Group, role)
+	return g.groupInfo(group), nil
+}
+
+// Quitar un miembro de un grupo (un dueño del grupo, o el propio miembro para salir)
+func (g *GroupServer) RemoveMember(ctx context.Context, req *pb.MemberRequest) (*pb.Group, error) {
+	username, err := authorize(ctx, policy.Groups)
+	if err != nil {
+		return nil, err
+	}
+
+	group, err := g.sync.groups.RemoveMember(req.Group, username, req.Username)
+	if err != nil {
+		return nil, groupStatus(req.Group, err)
+	}
+
+	// Los clientes del ex miembro borran sus copias de los archivos del grupo
+	g.sync.publishTeamAccess(req.Group, req.Username, "unshared")
+
+	log.Printf("[SUCCESS] (%s) %s quitó a %s del grupo %s", time.Now().Format("15:04:05"), username, req.Username, req.Group)
+	return g.groupInfo(group), nil
+}
+
+// Listar los grupos de los que el usuario es miembro
+func (g *GroupServer) ListGroups(ctx context.Context, req *pb.Empty) (*pb.GroupList, error) {
+	username, err := authorize(ctx, policy.Read)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.GroupList{}
+	for _, group := range g.sync.groups.ForMember(username) {
+		resp.Groups = append(resp.Groups, g.groupInfo(group))
+	}
+	return resp, nil
+}
+
+// Verificar que un movimiento quede dentro de un mismo espacio: el propio o el de un grupo (los archivos
+// compartidos por otro usuario solo los mueve su dueño)
+func movableSpace(from, to location, username string) error {
+	if from.Owner != to.Owner {
+		return status.Errorf(codes.InvalidArgument, "No se puede mover un archivo entre espacios distintos")
+	}
+	if from.Owner != username && !isTeam(from.Owner) {
+		return status.Errorf(codes.PermissionDenied, "Solo el dueño puede mover un archivo compartido")
+	}
+	return nil
+}
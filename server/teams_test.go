@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// Subidas simultáneas a un espacio de grupo: entre todas nunca superan la cuota
+func TestConcurrentUploadsRespectQuota(t *testing.T) {
+	s := newTestServer(t)
+	const quota, size = 1000, 100
+	if _, err := s.groups.Create("equipo", "alice", quota); err != nil {
+		t.Fatal(err)
+	}
+	owner := teamPrefix + "equipo"
+	if err := ensureUserKey(owner); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	accepted := 0
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := s.commitFile(owner, fmt.Sprintf("archivo%d", i), "alice", bytesContent(make([]byte, size)), "", nil, uploadAttrs(0644, 0, ""))
+			if err != nil && !errors.Is(err, errQuotaExceeded) {
+				t.Error(err)
+				return
+			}
+			if err == nil {
+				mu.Lock()
+				accepted++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if accepted != quota/size {
+		t.Fatalf("se aceptaron %d subidas, se esperaban %d", accepted, quota/size)
+	}
+	used, err := s.spaceUsage(owner, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if used > quota {
+		t.Fatalf("el grupo usa %d bytes con una cuota de %d", used, quota)
+	}
+}
@@ -0,0 +1,155 @@
+package throttle
+
+import (
+	"sync"
+	"time"
+)
+
+// Reloj que usan los limitadores; se puede reemplazar para probarlos sin esperar
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// Reloj del sistema
+var SystemClock Clock = systemClock{}
+
+// Cantidad de claves a partir de la cual se descartan las que ya no están bloqueadas ni tienen fallos recientes
+const pruneThreshold = 10000
+
+// ------------------------ BLOQUEO POR INTENTOS FALLIDOS ------------------------
+
+// Intentos fallidos de una clave (un usuario o una dirección)
+type attempts struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// Bloqueo exponencial por clave: después de threshold fallos seguidos la clave queda bloqueada por base,
+// y cada fallo siguiente duplica el bloqueo hasta max. Los fallos se olvidan tras resetAfter sin fallar.
+type Lockout struct {
+	clock      Clock
+	threshold  int
+	base       time.Duration
+	max        time.Duration
+	resetAfter time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*attempts
+}
+
+// Crear un bloqueo exponencial
+func NewLockout(clock Clock, threshold int, base, max, resetAfter time.Duration) *Lockout {
+	return &Lockout{clock: clock, threshold: threshold, base: base, max: max, resetAfter: resetAfter, entries: make(map[string]*attempts)}
+}
+
+// Intentos vigentes de una clave (nil si no tiene o ya se olvidaron; debe llamarse con l.mu tomado)
+func (l *Lockout) current(key string, now time.Time) *attempts {
+	entry, ok := l.entries[key]
+	if !ok {
+		return nil
+	}
+	if now.After(entry.lockedUntil) && now.Sub(entry.lastFailure) > l.resetAfter {
+		delete(l.entries, key)
+		return nil
+	}
+	return entry
+}
+
+// Indicar si una clave está bloqueada y por cuánto tiempo más
+func (l *Lockout) Locked(key string) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.clock.Now()
+	entry := l.current(key, now)
+	if entry == nil || !now.Before(entry.lockedUntil) {
+		return 0, false
+	}
+	return entry.lockedUntil.Sub(now), true
+}
+
+// Registrar un intento fallido. Devuelve por cuánto tiempo quedó bloqueada la clave (0 si no se bloqueó).
+func (l *Lockout) Failure(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.clock.Now()
+	if len(l.entries) >= pruneThreshold {
+		l.prune(now)
+	}
+
+	entry := l.current(key, now)
+	if entry == nil {
+		entry = &attempts{}
+		l.entries[key] = entry
+	}
+	entry.failures++
+	entry.lastFailure = now
+	if entry.failures < l.threshold {
+		return 0
+	}
+
+	lock := l.base
+	for i := l.threshold; i < entry.failures && lock < l.max; i++ {
+		lock *= 2
+	}
+	if lock > l.max {
+		lock = l.max
+	}
+	entry.lockedUntil = now.Add(lock)
+	return lock
+}
+
+// Olvidar los fallos de una clave (después de un intento correcto)
+func (l *Lockout) Success(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.entries, key)
+}
+
+// Descartar las claves que ya no están bloqueadas ni tienen fallos recientes (debe llamarse con l.mu tomado)
+func (l *Lockout) prune(now time.Time) {
+	for key := range l.entries {
+		l.current(key, now)
+	}
+}
+
+// ------------------------ LÍMITE GLOBAL ------------------------
+
+// Token bucket: admite ráfagas de hasta burst pedidos y, en promedio, rate pedidos por segundo
+type Bucket struct {
+	clock Clock
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// Crear un token bucket lleno
+func NewBucket(clock Clock, rate float64, burst int) *Bucket {
+	return &Bucket{clock: clock, rate: rate, burst: float64(burst), tokens: float64(burst), last: clock.Now()}
+}
+
+// Consumir un token si hay; devuelve false si hay que rechazar el pedido
+func (b *Bucket) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.clock.Now()
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
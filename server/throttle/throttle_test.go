@@ -0,0 +1,126 @@
+package throttle
+
+import (
+	"testing"
+	"time"
+)
+
+// Reloj que solo avanza cuando la prueba lo pide
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+}
+
+func TestLockoutExponential(t *testing.T) {
+	clock := newFakeClock()
+	l := NewLockout(clock, 3, 30*time.Second, 4*time.Minute, 15*time.Minute)
+
+	// Los fallos bajo el umbral no bloquean; desde el umbral cada fallo duplica el bloqueo hasta el máximo
+	expected := []time.Duration{0, 0, 30 * time.Second, time.Minute, 2 * time.Minute, 4 * time.Minute, 4 * time.Minute}
+	for i, want := range expected {
+		if got := l.Failure("maria"); got != want {
+			t.Fatalf("fallo %d: bloqueo de %s, se esperaba %s", i+1, got, want)
+		}
+	}
+
+	wait, locked := l.Locked("maria")
+	if !locked || wait != 4*time.Minute {
+		t.Fatalf("se esperaba un bloqueo de 4m, se obtuvo %s (%v)", wait, locked)
+	}
+	if _, locked := l.Locked("otro"); locked {
+		t.Fatal("una clave sin fallos quedó bloqueada")
+	}
+
+	clock.Advance(time.Minute)
+	if wait, _ := l.Locked("maria"); wait != 3*time.Minute {
+		t.Fatalf("quedan %s de bloqueo, se esperaban 3m", wait)
+	}
+	clock.Advance(3 * time.Minute)
+	if _, locked := l.Locked("maria"); locked {
+		t.Fatal("el bloqueo sigue después de expirar")
+	}
+
+	// Terminado el bloqueo, los fallos siguen contando hasta resetAfter
+	if got := l.Failure("maria"); got != 4*time.Minute {
+		t.Fatalf("fallo tras el bloqueo: %s, se esperaba 4m", got)
+	}
+}
+
+func TestLockoutReset(t *testing.T) {
+	clock := newFakeClock()
+	l := NewLockout(clock, 3, 30*time.Second, time.Hour, 15*time.Minute)
+
+	// Los fallos se olvidan tras resetAfter sin fallar
+	l.Failure("maria")
+	l.Failure("maria")
+	clock.Advance(15*time.Minute + time.Second)
+	if got := l.Failure("maria"); got != 0 {
+		t.Fatalf("los fallos antiguos siguen contando: bloqueo de %s", got)
+	}
+	l.Failure("maria")
+	if got := l.Failure("maria"); got != 30*time.Second {
+		t.Fatalf("se esperaba el bloqueo base, se obtuvo %s", got)
+	}
+
+	// Un bloqueo más largo que resetAfter (16m) no se olvida mientras dure
+	for i := 0; i < 5; i++ {
+		l.Failure("maria")
+	}
+	clock.Advance(15*time.Minute + 30*time.Second)
+	if _, locked := l.Locked("maria"); !locked {
+		t.Fatal("el bloqueo se olvidó antes de expirar")
+	}
+
+	// Un intento correcto olvida los fallos
+	l.Success("maria")
+	if _, locked := l.Locked("maria"); locked {
+		t.Fatal("la clave sigue bloqueada después de Success")
+	}
+	if got := l.Failure("maria"); got != 0 {
+		t.Fatalf("los fallos siguen contando después de Success: bloqueo de %s", got)
+	}
+}
+
+func TestBucketRefill(t *testing.T) {
+	clock := newFakeClock()
+	b := NewBucket(clock, 2, 3)
+
+	allowed := func(n int) int {
+		count := 0
+		for i := 0; i < n; i++ {
+			if b.Allow() {
+				count++
+			}
+		}
+		return count
+	}
+
+	if got := allowed(5); got != 3 {
+		t.Fatalf("se admitieron %d pedidos de una ráfaga, se esperaban 3", got)
+	}
+	clock.Advance(500 * time.Millisecond)
+	if got := allowed(5); got != 1 {
+		t.Fatalf("se admitieron %d pedidos tras medio segundo a 2/s, se esperaba 1", got)
+	}
+	clock.Advance(250 * time.Millisecond)
+	if got := allowed(1); got != 0 {
+		t.Fatal("se admitió un pedido con medio token")
+	}
+	clock.Advance(250 * time.Millisecond)
+	if got := allowed(1); got != 1 {
+		t.Fatal("no se acumuló el token de dos esperas parciales")
+	}
+
+	// La recarga no supera la ráfaga
+	clock.Advance(time.Minute)
+	if got := allowed(10); got != 3 {
+		t.Fatalf("se admitieron %d pedidos tras una pausa larga, se esperaban 3", got)
+	}
+}
@@ -0,0 +1,82 @@
+package totp
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+// Secreto de los vectores de prueba del RFC 6238 para HMAC-SHA1 ("12345678901234567890")
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+// Vectores del apéndice B del RFC 6238 (SHA-1). El RFC usa 8 dígitos; con 6 son los últimos 6.
+func TestCodeRFC6238(t *testing.T) {
+	vectors := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, v := range vectors {
+		got, err := Code(rfcSecret, Step(time.Unix(v.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != v.want {
+			t.Errorf("T=%d: código %s, se esperaba %s", v.unix, got, v.want)
+		}
+	}
+	if _, err := Code("no es base32!", 1); err == nil {
+		t.Fatal("se esperaba un error con un secreto inválido")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+	code := func(step int64) string {
+		c, err := Code(rfcSecret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	// Se aceptan el paso actual y los vecinos dentro de Skew, y se devuelve el paso que coincidió
+	for _, step := range []int64{current - Skew, current, current + Skew} {
+		if got, ok := Verify(rfcSecret, code(step), now, 0); !ok || got != step {
+			t.Errorf("paso %d (actual %d): Verify = %d, %v", step, current, got, ok)
+		}
+	}
+	for _, step := range []int64{current - Skew - 1, current + Skew + 1} {
+		if _, ok := Verify(rfcSecret, code(step), now, 0); ok {
+			t.Errorf("paso %d fuera de la tolerancia aceptado (actual %d)", step, current)
+		}
+	}
+
+	// Los espacios alrededor se ignoran; un código de otro largo se rechaza
+	if _, ok := Verify(rfcSecret, " "+code(current)+"\n", now, 0); !ok {
+		t.Error("código con espacios rechazado")
+	}
+	for _, wrong := range []string{"", "12345", "1234567", code(current) + "0", code(current)[1:]} {
+		if _, ok := Verify(rfcSecret, wrong, now, 0); ok {
+			t.Errorf("código %q de largo incorrecto aceptado", wrong)
+		}
+	}
+
+	// Los pasos menores o iguales al último aceptado no se aceptan de nuevo
+	if _, ok := Verify(rfcSecret, code(current), now, current); ok {
+		t.Error("código ya usado aceptado")
+	}
+	if _, ok := Verify(rfcSecret, code(current-Skew), now, current-Skew); ok {
+		t.Error("código anterior al último aceptado aceptado")
+	}
+	if got, ok := Verify(rfcSecret, code(current+Skew), now, current); !ok || got != current+Skew {
+		t.Errorf("código posterior al último aceptado: Verify = %d, %v", got, ok)
+	}
+}
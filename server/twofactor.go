@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	pb "github.com/FelipeMarchantVargas/sync-service/proto"
+	"github.com/FelipeMarchantVargas/sync-service/server/totp"
+	"github.com/FelipeMarchantVargas/sync-service/server/users"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ------------------------ SEGUNDO FACTOR ------------------------
+
+// Emisor con que aparece la cuenta en las aplicaciones de autenticación
+const totpIssuer = "sync-service"
+
+// Convertir los errores del segundo factor en el error gRPC que recibe el cliente
+func totpStatus(username string, err error) error {
+	switch {
+	case errors.Is(err, users.ErrTOTPEnabled):
+		return status.Errorf(codes.FailedPrecondition, "El segundo factor ya está activado")
+	case errors.Is(err, users.ErrTOTPNotEnabled):
+		return status.Errorf(codes.FailedPrecondition, "El segundo factor no está activado")
+	case errors.Is(err, users.ErrTOTPNotPending):
+		return status.Errorf(codes.FailedPrecondition, "Primero hay que empezar la activación del segundo factor")
+	case errors.Is(err, users.ErrInvalidCode):
+		return status.Errorf(codes.Unauthenticated, "Código de verificación incorrecto")
+	}
+	return userStatus(username, err)
+}
+
+// Empezar a activar el segundo factor: entrega el secreto y su URI otpauth:// (para un código QR)
+func (s *AuthServer) EnrollTotp(ctx context.Context, req *pb.Empty) (*pb.TotpEnrollment, error) {
+	username, _, err := apiKeyOwner(ctx)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := s.users.BeginTOTP(username)
+	if err != nil {
+		return nil, totpStatus(username, err)
+	}
+
+	log.Printf("[INFO] (%s) %s empezó a activar el segundo factor", time.Now().Format("15:04:05"), username)
+	return &pb.TotpEnrollment{Secret: secret, Uri: totp.URI(totpIssuer, username, secret)}, nil
+}
+
+// Activar el segundo factor con un código de la aplicación y entregar los códigos de recuperación
+func (s *AuthServer) ConfirmTotp(ctx context.Context, req *pb.TotpRequest) (*pb.RecoveryCodes, error) {
+	username, _, err := apiKeyOwner(ctx)
+	if err != nil {
+		return nil, err
+	}
+	recoveryCodes, err := s.users.ConfirmTOTP(username, req.Code, time.Now())
+	if err != nil {
+		return nil, totpStatus(username, err)
+	}
+
+	log.Printf("[SUCCESS] (%s) %s activó el segundo factor", time.Now().Format("15:04:05"), username)
+	return &pb.RecoveryCodes{Codes: recoveryCodes}, nil
+}
+
+// Desactivar el segundo factor con un código TOTP o de recuperación
+func (s *AuthServer) DisableTotp(ctx context.Context, req *pb.TotpRequest) (*pb.Empty, error) {
+	username, _, err := apiKeyOwner(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.users.DisableTOTP(username, req.Code, time.Now()); err != nil {
+		return nil, totpStatus(username, err)
+	}
+
+	log.Printf("[SUCCESS] (%s) %s desactivó el segundo factor", time.Now().Format("15:04:05"), username)
+	return &pb.Empty{}, nil
+}
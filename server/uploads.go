@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	pb "github.com/FelipeMarchantVargas/sync-service/proto"
+	"github.com/FelipeMarchantVargas/sync-service/server/auth"
+	"github.com/FelipeMarchantVargas/sync-service/server/policy"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Directorio donde se guardan (cifradas) las partes de las subidas en curso
+const uploadsDir = "./uploads"
+
+// Límites de las transferencias en partes
+const (
+	maxUploadParts           = 10000
+	defaultTransferChunkSize = 64 * 1024
+	maxTransferChunkSize     = 2 * 1024 * 1024
+	staleUploadAge           = 24 * time.Hour
+)
+
+// ------------------------ SUBIDAS EN PARTES ------------------------
+
+// Validar que el identificador de subida sea hexadecimal (evita rutas arbitrarias en el disco)
+func validUploadID(uploadID string) bool {
+	if len(uploadID) < 16 || len(uploadID) > 64 {
+		return false
+	}
+	_, err := hex.DecodeString(uploadID)
+	return err == nil
+}
+
+func uploadStagingDir(username, uploadID string) string {
+	return filepath.Join(uploadsDir, username, uploadID)
+}
+
+func partPath(username, uploadID string, part int32) string {
+	return filepath.Join(uploadStagingDir(username, uploadID), fmt.Sprintf("%05d.part", part))
+}
+
+// Guardar una parte recibida, cifrada con la clave del usuario
+func stageUploadPart(username, uploadID string, part int32, data []byte, key []byte) error {
+	if !validUploadID(uploadID) {
+		return status.Errorf(codes.InvalidArgument, "Identificador de subida inválido")
+	}
+	if part < 0 || part >= maxUploadParts {
+		return status.Errorf(codes.InvalidArgument, "Índice de parte fuera de rango: %d", part)
+	}
+
+	if err := os.MkdirAll(uploadStagingDir(username, uploadID), os.ModePerm); err != nil {
+		log.Printf("[ERROR] No se pudo crear el directorio de la subida %s: %v", uploadID, err)
+		return status.Errorf(codes.Internal, "Error preparando la subida")
+	}
+
+	encryptedData, err := auth.EncryptData(data, key)
+	if err != nil {
+		log.Printf("[ERROR] Error cifrando la parte %d de la subida %s: %v", part, uploadID, err)
+		return status.Errorf(codes.Internal, "Error cifrando la parte")
+	}
+
+	if err := writeFileAtomic(partPath(username, uploadID, part), encryptedData); err != nil {
+		log.Printf("[ERROR] Error guardando la parte %d de la subida %s: %v", part, uploadID, err)
+		return status.Errorf(codes.Internal, "Error guardando la parte")
+	}
+	return nil
+}
+
+// Escribir el contenido descifrado de una parte guardada
+func copyUploadPart(w io.Writer, username, uploadID string, part int32, key []byte) error {
+	file, err := os.Open(partPath(username, uploadID, part))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader, err := auth.NewDecryptReader(bufio.NewReader(file), key)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, reader)
+	return err
+}
+
+// Unir las partes en orden y guardar el archivo final de forma atómica
+func (s *SyncServer) CommitUpload(ctx context.Context, req *pb.CommitRequest) (*pb.UploadResponse, error) {
+	username, err := authorize(ctx, policy.Write)
+	if err != nil {
+		return nil, err
+	}
+	if err := authenticate(ctx); err != nil {
+		return nil, err
+	}
+
+	if !validUploadID(req.UploadId) {
+		return nil, status.Errorf(codes.InvalidArgument, "Identificador de subida inválido")
+	}
+	if req.Parts <= 0 || req.Parts > maxUploadParts {
+		return nil, status.Errorf(codes.InvalidArgument, "Cantidad de partes inválida: %d", req.Parts)
+	}
+	loc, err := resolvePath(username, req.Filename)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Ruta inválida: %v", err)
+	}
+	filename := loc.Name
+
+	// Las partes se cifraron con la clave de quien sube el archivo
+	key, err := auth.GetAESKey(username)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Error obteniendo clave de cifrado")
+	}
+
+	startTime := time.Now()
+
+	// 1️⃣ Verificar que estén todas las partes y calcular el tamaño del archivo
+	var size int64
+	for part := int32(0); part < req.Parts; part++ {
+		info, err := os.Stat(partPath(username, req.UploadId, part))
+		if os.IsNotExist(err) {
+			return nil, status.Errorf(codes.FailedPrecondition, "Falta la parte %d de la subida", part)
+		}
+		if err != nil {
+			log.Printf("[ERROR] No se pudo leer la parte %d de la subida %s: %v", part, req.UploadId, err)
+			return nil, status.Errorf(codes.Internal, "Error leyendo la parte %d", part)
+		}
+		size += auth.DecryptedSize(info.Size())
+	}
+
+	// 2️⃣ Descifrar las partes en orden a medida que se cifra el archivo completo, y reemplazar el anterior de forma atómica
+	content := fileContent{Size: size, Write: func(w io.Writer) error {
+		for part := int32(0); part < req.Parts; part++ {
+			if err := copyUploadPart(w, username, req.UploadId, part, key); err != nil {
+				log.Printf("[ERROR] No se pudo descifrar la parte %d de la subida %s: %v", part, req.UploadId, err)
+				return err
+			}
+		}
+		return nil
+	}}
+	entry, err := s.commitFile(loc.Owner, loc.Path, username, content, getDeviceFromContext(ctx), req.BaseVersion, uploadAttrs(req.Mode, req.Mtime, ""))
+	if conflict := conflictStatus(filename, err); conflict != nil {
+		os.RemoveAll(uploadStagingDir(username, req.UploadId))
+		return nil, conflict
+	}
+	if forbidden := forbiddenStatus(filename, err); forbidden != nil {
+		os.RemoveAll(uploadStagingDir(username, req.UploadId))
+		return nil, forbidden
+	}
+	if quota := quotaStatus(filename, err); quota != nil {
+		os.RemoveAll(uploadStagingDir(username, req.UploadId))
+		return nil, quota
+	}
+	if os.IsNotExist(err) {
+		os.RemoveAll(uploadStagingDir(username, req.UploadId))
+		return nil, status.Errorf(codes.NotFound, "El archivo no existe o no tienes permiso")
+	}
+	if err != nil {
+		log.Printf("[ERROR] Error al guardar archivo %s: %v", filename, err)
+		return nil, status.Errorf(codes.Internal, "Error guardando el archivo")
+	}
+
+	// 3️⃣ Eliminar las partes temporales
+	os.RemoveAll(uploadStagingDir(username, req.UploadId))
+
+	log.Printf("[SUCCESS] (%s) %s ensamblado desde %d partes (%d KB) como versión %d en %.2f s", time.Now().Format("15:04:05"), filename, req.Parts, size/1024, entry.Version, time.Since(startTime).Seconds())
+
+	return &pb.UploadResponse{Message: "Archivo ensamblado y cifrado con éxito", Version: entry.Version, Hash: entry.Hash}, nil
+}
+
+// Escribir un archivo de forma atómica (archivo temporal + rename)
+func writeFileAtomic(path string, data []byte) error {
+	return writeFileAtomicWith(path, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// Escribir un archivo de forma atómica con lo que write escriba en él (si falla, el archivo anterior queda igual)
+func writeFileAtomicWith(path string, write func(w io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	buffered := bufio.NewWriterSize(tmp, 256*1024)
+	if err := write(buffered); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := buffered.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Eliminar subidas abandonadas hace más de staleUploadAge
+func cleanStaleUploads() {
+	users, err := os.ReadDir(uploadsDir)
+	if err != nil {
+		return
+	}
+	for _, user := range users {
+		userDir := filepath.Join(uploadsDir, user.Name())
+		uploads, err := os.ReadDir(userDir)
+		if err != nil {
+			continue
+		}
+		for _, upload := range uploads {
+			info, err := upload.Info()
+			if err != nil || time.Since(info.ModTime()) < staleUploadAge {
+				continue
+			}
+			log.Printf("[INFO] Eliminando subida abandonada %s de %s", upload.Name(), user.Name())
+			os.RemoveAll(filepath.Join(userDir, upload.Name()))
+		}
+	}
+}
+
+// Tamaño de fragmento pedido por el cliente, acotado a los límites del servidor
+func transferChunkSize(requested int32) int {
+	if requested <= 0 {
+		return defaultTransferChunkSize
+	}
+	if requested > maxTransferChunkSize {
+		return maxTransferChunkSize
+	}
+	return int(requested)
+}
@@ -0,0 +1,157 @@
+package users
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/FelipeMarchantVargas/sync-service/server/totp"
+)
+
+// Cantidad de códigos de recuperación que se entregan al activar el segundo factor
+const recoveryCodeCount = 10
+
+// Caracteres de los códigos de recuperación (sin 0/o ni 1/l, para copiarlos a mano sin confusiones)
+const recoveryAlphabet = "abcdefghijkmnpqrstuvwxyz23456789"
+
+var (
+	ErrTOTPEnabled    = errors.New("el segundo factor ya está activado")
+	ErrTOTPNotEnabled = errors.New("el segundo factor no está activado")
+	ErrTOTPNotPending = errors.New("no hay una activación del segundo factor en curso")
+	ErrInvalidCode    = errors.New("código de verificación incorrecto")
+)
+
+// Hash con que se guarda un código de recuperación
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(code))))
+	return hex.EncodeToString(sum[:])
+}
+
+// Generar los códigos de recuperación: devuelve los códigos y sus hashes
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw := make([]byte, 10)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, nil, err
+		}
+		var code strings.Builder
+		for j, b := range raw {
+			if j == 5 {
+				code.WriteByte('-')
+			}
+			code.WriteByte(recoveryAlphabet[int(b)%len(recoveryAlphabet)])
+		}
+		codes = append(codes, code.String())
+		hashes = append(hashes, hashRecoveryCode(code.String()))
+	}
+	return codes, hashes, nil
+}
+
+// Empezar a activar el segundo factor: genera un secreto que queda pendiente hasta confirmarlo con un código
+func (s *Store) BeginTOTP(username string) (string, error) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", err
+	}
+	err = s.update(username, func(user *User) error {
+		if user.TOTPSecret != "" {
+			return ErrTOTPEnabled
+		}
+		user.TOTPPending = secret
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// Confirmar la activación con un código del secreto pendiente. Devuelve los códigos de recuperación,
+// que no se vuelven a poder obtener.
+func (s *Store) ConfirmTOTP(username, code string, now time.Time) ([]string, error) {
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	err = s.update(username, func(user *User) error {
+		if user.TOTPSecret != "" {
+			return ErrTOTPEnabled
+		}
+		if user.TOTPPending == "" {
+			return ErrTOTPNotPending
+		}
+		step, ok := totp.Verify(user.TOTPPending, code, now, 0)
+		if !ok {
+			return ErrInvalidCode
+		}
+		user.TOTPSecret = user.TOTPPending
+		user.TOTPPending = ""
+		user.TOTPLastStep = step
+		user.RecoveryCodes = hashes
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Verificar el segundo factor de una cuenta con un código TOTP o un código de recuperación (que se consume).
+// Un código TOTP ya aceptado no se acepta de nuevo.
+func (s *Store) CheckSecondFactor(username, code string, now time.Time) error {
+	return s.update(username, func(user *User) error {
+		return checkSecondFactor(user, code, now)
+	})
+}
+
+// Desactivar el segundo factor, pidiendo un código TOTP o de recuperación
+func (s *Store) DisableTOTP(username, code string, now time.Time) error {
+	return s.update(username, func(user *User) error {
+		if err := checkSecondFactor(user, code, now); err != nil {
+			return err
+		}
+		user.TOTPSecret = ""
+		user.TOTPLastStep = 0
+		user.RecoveryCodes = nil
+		return nil
+	})
+}
+
+// Desactivar el segundo factor sin pedir código (lo hace un administrador desde el servidor)
+func (s *Store) ResetTOTP(username string) error {
+	return s.update(username, func(user *User) error {
+		user.TOTPSecret = ""
+		user.TOTPPending = ""
+		user.TOTPLastStep = 0
+		user.RecoveryCodes = nil
+		return nil
+	})
+}
+
+// Verificar un código sobre una copia de la cuenta, registrando el paso aceptado o el código de recuperación usado
+func checkSecondFactor(user *User, code string, now time.Time) error {
+	if user.TOTPSecret == "" {
+		return ErrTOTPNotEnabled
+	}
+	if step, ok := totp.Verify(user.TOTPSecret, code, now, user.TOTPLastStep); ok {
+		user.TOTPLastStep = step
+		return nil
+	}
+
+	hash := hashRecoveryCode(code)
+	for i, stored := range user.RecoveryCodes {
+		if subtle.ConstantTimeCompare([]byte(stored), []byte(hash)) == 1 {
+			remaining := make([]string, 0, len(user.RecoveryCodes)-1)
+			remaining = append(remaining, user.RecoveryCodes[:i]...)
+			user.RecoveryCodes = append(remaining, user.RecoveryCodes[i+1:]...)
+			return nil
+		}
+	}
+	return ErrInvalidCode
+}
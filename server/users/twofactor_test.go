@@ -0,0 +1,102 @@
+package users
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/FelipeMarchantVargas/sync-service/server/totp"
+)
+
+// Cuenta con el segundo factor activado en el instante now; devuelve el almacén, el secreto y los códigos de recuperación
+func newTOTPUser(t *testing.T, now time.Time) (*Store, string, []string) {
+	t.Helper()
+	s, err := Open(filepath.Join(t.TempDir(), "users.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add("maria", "clave-segura", RoleUser); err != nil {
+		t.Fatal(err)
+	}
+	secret, err := s.BeginTOTP("maria")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := totp.Code(secret, totp.Step(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	recovery, err := s.ConfirmTOTP("maria", code, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, secret, recovery
+}
+
+func TestCheckSecondFactorRejectsReplay(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	s, secret, _ := newTOTPUser(t, now)
+	code := func(at time.Time) string {
+		c, err := totp.Code(secret, totp.Step(at))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	// El código con que se confirmó la activación ya se usó
+	if err := s.CheckSecondFactor("maria", code(now), now); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("código de la activación: se esperaba ErrInvalidCode, se obtuvo %v", err)
+	}
+
+	later := now.Add(totp.Period)
+	if err := s.CheckSecondFactor("maria", code(later), later); err != nil {
+		t.Fatalf("código del paso siguiente rechazado: %v", err)
+	}
+	if err := s.CheckSecondFactor("maria", code(later), later); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("código repetido: se esperaba ErrInvalidCode, se obtuvo %v", err)
+	}
+	// Un código anterior sigue dentro de la tolerancia del reloj, pero es de un paso ya superado
+	if err := s.CheckSecondFactor("maria", code(now), later); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("código de un paso anterior: se esperaba ErrInvalidCode, se obtuvo %v", err)
+	}
+
+	user, _ := s.Get("maria")
+	if user.TOTPLastStep != totp.Step(later) {
+		t.Fatalf("TOTPLastStep = %d, se esperaba %d", user.TOTPLastStep, totp.Step(later))
+	}
+}
+
+func TestCheckSecondFactorRecoveryCodes(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	s, _, recovery := newTOTPUser(t, now)
+
+	// Un código de recuperación sirve una sola vez (sin importar mayúsculas ni espacios)
+	if err := s.CheckSecondFactor("maria", " "+recovery[0]+" ", now); err != nil {
+		t.Fatalf("código de recuperación rechazado: %v", err)
+	}
+	if err := s.CheckSecondFactor("maria", recovery[0], now); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("código de recuperación repetido: se esperaba ErrInvalidCode, se obtuvo %v", err)
+	}
+	if err := s.CheckSecondFactor("maria", recovery[1], now); err != nil {
+		t.Fatalf("segundo código de recuperación rechazado: %v", err)
+	}
+	user, _ := s.Get("maria")
+	if len(user.RecoveryCodes) != len(recovery)-2 {
+		t.Fatalf("quedan %d códigos de recuperación, se esperaban %d", len(user.RecoveryCodes), len(recovery)-2)
+	}
+
+	for _, wrong := range []string{"", "12345", "1234567", "abcde-fghij"} {
+		if err := s.CheckSecondFactor("maria", wrong, now); !errors.Is(err, ErrInvalidCode) {
+			t.Errorf("código %q: se esperaba ErrInvalidCode, se obtuvo %v", wrong, err)
+		}
+	}
+
+	if err := s.ResetTOTP("maria"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CheckSecondFactor("maria", recovery[2], now); !errors.Is(err, ErrTOTPNotEnabled) {
+		t.Fatalf("sin segundo factor: se esperaba ErrTOTPNotEnabled, se obtuvo %v", err)
+	}
+}
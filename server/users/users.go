@@ -0,0 +1,335 @@
+package users
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Archivo por defecto donde se guardan las cuentas de usuario
+const DefaultFile = "./users.json"
+
+// Largo máximo de un nombre de usuario
+const maxUsernameLength = 64
+
+// Roles de las cuentas
+const (
+	RoleAdmin    = "admin"     // Todo, incluidas las operaciones de administración
+	RoleUser     = "user"      // Sus archivos, compartirlos y sus grupos
+	RoleReadOnly = "read-only" // Solo leer (p. ej. bots de CI que descargan)
+	RoleService  = "service"   // Leer y escribir archivos, sin compartir ni administrar grupos
+)
+
+// Indicar si un rol es válido
+func ValidRole(role string) bool {
+	return role == RoleAdmin || role == RoleUser || role == RoleReadOnly || role == RoleService
+}
+
+var (
+	ErrExists             = errors.New("el usuario ya existe")
+	ErrNotFound           = errors.New("el usuario no existe")
+	ErrInvalidCredentials = errors.New("credenciales incorrectas")
+)
+
+// Cuenta de usuario (la contraseña se guarda solo como hash bcrypt)
+type User struct {
+	Username     string `json:"username"`
+	PasswordHash string `json:"password_hash"`
+	Role         string `json:"role"`
+	Disabled     bool   `json:"disabled,omitempty"`      // Cuenta deshabilitada: no puede iniciar sesión ni usar sus tokens
+	TokenVersion int64  `json:"token_version,omitempty"` // Versión de sus tokens: al aumentarla se invalidan los emitidos antes
+	Created      int64  `json:"created"`                 // Momento de creación (Unix, segundos)
+
+	// Segundo factor (TOTP): secreto activo, secreto por confirmar, último paso aceptado y hash SHA-256
+	// de los códigos de recuperación sin usar
+	TOTPSecret    string   `json:"totp_secret,omitempty"`
+	TOTPPending   string   `json:"totp_pending,omitempty"`
+	TOTPLastStep  int64    `json:"totp_last_step,omitempty"`
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+
+	// Cuentas de un proveedor OIDC: emisor que las creó (no tienen contraseña) y grupos que les dio en su último login
+	Provider       string   `json:"provider,omitempty"`
+	ExternalGroups []string `json:"external_groups,omitempty"`
+}
+
+// Cuentas de usuario guardadas en un archivo JSON
+type Store struct {
+	file  string
+	mu    sync.Mutex
+	users map[string]*User
+}
+
+// Abrir (o crear vacío) el archivo de usuarios
+func Open(file string) (*Store, error) {
+	s := &Store{file: file, users: make(map[string]*User)}
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var list []*User
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+	for _, user := range list {
+		// Las cuentas creadas antes de los roles son cuentas normales
+		if user.Role == "" {
+			user.Role = RoleUser
+		}
+		s.users[user.Username] = user
+	}
+	return s, nil
+}
+
+// Guardar las cuentas de forma atómica (debe llamarse con s.mu tomado)
+func (s *Store) save() error {
+	list := make([]*User, 0, len(s.users))
+	for _, user := range s.users {
+		list = append(list, user)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Username < list[j].Username })
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(s.file); dir != "." {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+	}
+	tmp := s.file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.file)
+}
+
+// Validar un nombre de usuario: letras, dígitos, '.', '_' y '-' (se usa como nombre de carpeta
+// y no puede contener ':', que distingue los espacios compartidos en las rutas)
+func ValidUsername(username string) error {
+	if username == "" || len(username) > maxUsernameLength {
+		return fmt.Errorf("el nombre de usuario debe tener entre 1 y %d caracteres", maxUsernameLength)
+	}
+	if username == "." || username == ".." {
+		return fmt.Errorf("nombre de usuario inválido: %s", username)
+	}
+	for _, r := range username {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+		default:
+			return fmt.Errorf("nombre de usuario inválido: %s (usa letras, dígitos, '.', '_' o '-')", username)
+		}
+	}
+	return nil
+}
+
+// Crear una cuenta nueva con un rol
+func (s *Store) Add(username, password, role string) error {
+	if err := ValidUsername(username); err != nil {
+		return err
+	}
+	if !ValidRole(role) {
+		return fmt.Errorf("rol no soportado: %s (usa admin, user, read-only o service)", role)
+	}
+	if password == "" {
+		return fmt.Errorf("la contraseña no puede estar vacía")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[username]; ok {
+		return ErrExists
+	}
+	s.users[username] = &User{Username: username, PasswordHash: string(hash), Role: role, Created: time.Now().Unix()}
+	if err := s.save(); err != nil {
+		delete(s.users, username)
+		return err
+	}
+	return nil
+}
+
+// Crear una cuenta sin contraseña vinculada a un proveedor OIDC (solo puede iniciar sesión por el proveedor)
+func (s *Store) AddExternal(username, role, provider string) error {
+	if err := ValidUsername(username); err != nil {
+		return err
+	}
+	if !ValidRole(role) {
+		return fmt.Errorf("rol no soportado: %s (usa admin, user, read-only o service)", role)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[username]; ok {
+		return ErrExists
+	}
+	s.users[username] = &User{Username: username, Role: role, Provider: provider, Created: time.Now().Unix()}
+	if err := s.save(); err != nil {
+		delete(s.users, username)
+		return err
+	}
+	return nil
+}
+
+// Guardar los grupos que el proveedor OIDC le dio a una cuenta
+func (s *Store) SetExternalGroups(username string, groups []string) error {
+	return s.update(username, func(user *User) error {
+		user.ExternalGroups = append([]string(nil), groups...)
+		return nil
+	})
+}
+
+// Verificar usuario y contraseña. Devuelve ErrInvalidCredentials si no coinciden (o el usuario no existe).
+func (s *Store) Authenticate(username, password string) (*User, error) {
+	s.mu.Lock()
+	user, ok := s.users[username]
+	s.mu.Unlock()
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	copied := *user
+	return &copied, nil
+}
+
+// Indicar si existe un usuario
+func (s *Store) Exists(username string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.users[username]
+	return ok
+}
+
+// Cantidad de cuentas registradas
+func (s *Store) Count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.users)
+}
+
+// Rol de una cuenta (vacío si no existe)
+func (s *Store) Role(username string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if user, ok := s.users[username]; ok {
+		return user.Role
+	}
+	return ""
+}
+
+// Cambiar el rol de una cuenta
+func (s *Store) SetRole(username, role string) error {
+	if !ValidRole(role) {
+		return fmt.Errorf("rol no soportado: %s (usa admin, user, read-only o service)", role)
+	}
+	return s.update(username, func(user *User) error {
+		user.Role = role
+		return nil
+	})
+}
+
+// Cantidad de cuentas con un rol
+func (s *Store) CountRole(role string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := 0
+	for _, user := range s.users {
+		if user.Role == role {
+			count++
+		}
+	}
+	return count
+}
+
+// Obtener una cuenta
+func (s *Store) Get(username string) (*User, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[username]
+	if !ok {
+		return nil, false
+	}
+	copied := *user
+	return &copied, true
+}
+
+// Listar las cuentas ordenadas por nombre
+func (s *Store) List() []*User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]*User, 0, len(s.users))
+	for _, user := range s.users {
+		copied := *user
+		list = append(list, &copied)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Username < list[j].Username })
+	return list
+}
+
+// Modificar una cuenta de forma atómica (fn recibe la cuenta y la modifica)
+func (s *Store) update(username string, fn func(user *User) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, ok := s.users[username]
+	if !ok {
+		return ErrNotFound
+	}
+	next := *current
+	if err := fn(&next); err != nil {
+		return err
+	}
+	s.users[username] = &next
+	if err := s.save(); err != nil {
+		s.users[username] = current
+		return err
+	}
+	return nil
+}
+
+// Habilitar o deshabilitar una cuenta
+func (s *Store) SetDisabled(username string, disabled bool) error {
+	return s.update(username, func(user *User) error {
+		user.Disabled = disabled
+		return nil
+	})
+}
+
+// Invalidar todos los tokens emitidos hasta ahora para una cuenta (cerrar sus sesiones)
+func (s *Store) RevokeTokens(username string) error {
+	return s.update(username, func(user *User) error {
+		user.TokenVersion++
+		return nil
+	})
+}
+
+// Cambiar la contraseña de una cuenta, cerrando sus sesiones
+func (s *Store) SetPassword(username, password string) error {
+	if password == "" {
+		return fmt.Errorf("la contraseña no puede estar vacía")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	return s.update(username, func(user *User) error {
+		user.PasswordHash = string(hash)
+		user.TokenVersion++
+		return nil
+	})
+}